@@ -0,0 +1,38 @@
+package constants
+
+// 审计资源类型
+const (
+	AuditResourceSpider     = "spider"
+	AuditResourceSchedule   = "schedule"
+	AuditResourceTask       = "task"
+	AuditResourceUser       = "user"
+	AuditResourceVariable   = "variable"
+	AuditResourceToken      = "token"
+	AuditResourceProject    = "project"
+	AuditResourceWorkflow   = "workflow"
+	AuditResourceNode       = "node"
+	AuditResourceEnvProfile = "env_profile"
+)
+
+// 审计操作类型
+const (
+	AuditActionCreate   = "create"
+	AuditActionUpdate   = "update"
+	AuditActionDelete   = "delete"
+	AuditActionRun      = "run"
+	AuditActionCancel   = "cancel"
+	AuditActionRestart  = "restart"
+	AuditActionUpload   = "upload"
+	AuditActionPublish  = "publish"
+	AuditActionCopy     = "copy"
+	AuditActionRollback = "rollback"
+	AuditActionEnable   = "enable"
+	AuditActionDisable  = "disable"
+	AuditActionInstall  = "install"
+	AuditActionRetry    = "retry"
+)
+
+const (
+	AuditRetentionDaysDefault = 90   // 审计日志默认保留天数
+	AuditDetailMaxLength      = 2000 // 请求参数最大记录长度
+)
@@ -6,4 +6,6 @@ const (
 	ChannelWorkerNode = "nodes:"
 
 	ChannelMasterNode = "nodes:master"
+
+	ChannelTaskLog = "tasks:log:"
 )
@@ -0,0 +1,21 @@
+package constants
+
+const (
+	// 依赖安装任务类型
+	DepJobTypeInstallDep   = "install_dep"
+	DepJobTypeUninstallDep = "uninstall_dep"
+	DepJobTypeInstallLang  = "install_lang"
+)
+
+const (
+	// 依赖安装任务状态
+	DepJobStatusPending  = "pending"
+	DepJobStatusRunning  = "running"
+	DepJobStatusFinished = "finished"
+	DepJobStatusError    = "error"
+)
+
+const (
+	DepJobTimeoutDefault = 1800      // 单个节点安装超时（秒）
+	DepJobOutputMaxSize  = 64 * 1024 // 保存的输出长度上限（字节）
+)
@@ -0,0 +1,5 @@
+package constants
+
+const (
+	EnvProfileReconcileIntervalSeconds = 600 // 自动修复环境偏差的检查间隔（秒）
+)
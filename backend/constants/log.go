@@ -3,3 +3,35 @@ package constants
 const (
 	ErrorRegexPattern = "(?:[ :,.]|^)((?:error|exception|traceback)s?)(?:[ :,.]|$)"
 )
+
+const (
+	// 实时日志缓存，用于补齐尚未写入数据库的日志
+	TaskLogTailKey    = "tasks:log:tail:"
+	TaskLogTailSize   = 1000
+	TaskLogTailExpire = 3600 // 秒
+
+	// 实时日志消息类型
+	TaskLogStreamLog = "log"
+	TaskLogStreamEnd = "end"
+)
+
+const (
+	// 日志输出流
+	LogStreamStdout = "stdout"
+	LogStreamStderr = "stderr"
+
+	// 日志级别
+	LogLevelDebug    = "debug"
+	LogLevelInfo     = "info"
+	LogLevelWarning  = "warning"
+	LogLevelError    = "error"
+	LogLevelCritical = "critical"
+)
+
+const (
+	// 任务日志存储方式
+	LogSinkMongo = "mongo"
+	LogSinkFile  = "file"
+	LogSinkEs    = "es"
+	LogSinkLoki  = "loki"
+)
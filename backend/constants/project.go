@@ -0,0 +1,23 @@
+package constants
+
+// 项目角色
+const (
+	ProjectRoleViewer    = "viewer"
+	ProjectRoleDeveloper = "developer"
+	ProjectRoleOperator  = "operator"
+	ProjectRoleAdmin     = "project-admin"
+)
+
+// 权限
+const (
+	PermissionSpiderView     = "spider:view"
+	PermissionSpiderEdit     = "spider:edit"
+	PermissionSpiderRun      = "spider:run"
+	PermissionSpiderDelete   = "spider:delete"
+	PermissionScheduleManage = "schedule:manage"
+	PermissionNodeDepInstall = "node:dep_install"
+	PermissionVariableManage = "variable:manage"
+	PermissionProjectManage  = "project:manage"
+	PermissionNodeManage     = "node:manage"
+	PermissionUserManage     = "user:manage"
+)
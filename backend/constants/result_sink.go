@@ -0,0 +1,25 @@
+package constants
+
+const (
+	// 结果投递目标类型
+	ResultSinkPostgres = "postgres"
+	ResultSinkMysql    = "mysql"
+	ResultSinkKafka    = "kafka"
+	ResultSinkS3       = "s3"
+)
+
+const (
+	// 结果投递状态
+	DeliveryStatusPending = "pending"
+	DeliveryStatusRunning = "running"
+	DeliveryStatusSuccess = "success"
+	DeliveryStatusError   = "error"
+)
+
+const (
+	ResultSinkBatchSizeDefault   = 500
+	DeliveryMaxAttemptsDefault   = 5
+	DeliveryBackoffSecondsBase   = 60
+	DeliveryRetryIntervalSeconds = 60
+	DeliveryStaleTimeoutSeconds  = 600
+)
@@ -7,4 +7,6 @@ const (
 	RpcGetInstalledDepList = "get_installed_dep_list"
 	RpcGetLang             = "get_lang"
 	RpcGetNodeStats        = "get_node_stats"
+	RpcGetDepCacheFiles    = "get_dep_cache_files"
+	RpcGetDepCacheFile     = "get_dep_cache_file"
 )
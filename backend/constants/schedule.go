@@ -8,3 +8,31 @@ const (
 	ScheduleStatusErrorNotFoundNode   = "Not Found Node"
 	ScheduleStatusErrorNotFoundSpider = "Not Found Spider"
 )
+
+const (
+	// 允许同时运行
+	ScheduleOverlapAllow = "allow"
+	// 上次任务未结束时跳过
+	ScheduleOverlapSkip = "skip"
+	// 上次任务未结束时排队（最多一个）
+	ScheduleOverlapQueue = "queue"
+	// 取消上次任务并重新运行
+	ScheduleOverlapReplace = "replace"
+)
+
+const (
+	// 定时任务保留的跳过记录数
+	ScheduleSkippedTicksMax = 50
+
+	ScheduleSkippedReasonRunning = "previous run is still running"
+	ScheduleSkippedReasonQueued  = "a run is already queued"
+)
+
+const (
+	// 详情页默认展示的下次运行时间数
+	ScheduleNextRunCountDefault = 5
+	ScheduleNextRunCountMax     = 100
+
+	// 重启后最多补跑的次数
+	ScheduleCatchUpMax = 10
+)
@@ -13,6 +13,8 @@ const (
 	StatusCancelled string = "cancelled"
 	// 节点重启导致的异常终止
 	StatusAbnormal string = "abnormal"
+	// 运行超时
+	StatusTimeout string = "timeout"
 )
 
 const (
@@ -25,3 +27,33 @@ const (
 	RunTypeRandom        string = "random"
 	RunTypeSelectedNodes string = "selected-nodes"
 )
+
+const (
+	RetryBackoffFixed       string = "fixed"
+	RetryBackoffExponential string = "exponential"
+)
+
+const (
+	// 非零退出码
+	RetryOnExitCode string = "exit_code"
+	// 运行超时
+	RetryOnTimeout string = "timeout"
+	// 节点异常导致的终止
+	RetryOnAbnormal string = "abnormal"
+)
+
+const (
+	// 任务优先级，数值越大越优先
+	TaskPriorityLowest  int = 1
+	TaskPriorityDefault int = 5
+	TaskPriorityHighest int = 10
+)
+
+const (
+	// 工作协程等待任务信号的超时时间（秒）
+	TaskSignalTimeout = 5
+	// 任务信号列表的过期时间（秒）
+	TaskSignalExpire = 600
+	// 爬虫达到并发上限时，任务延迟重新入队的时间（秒）
+	TaskConcurrencyWaitInterval = 5
+)
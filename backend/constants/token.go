@@ -0,0 +1,20 @@
+package constants
+
+// JWT 类型
+const (
+	TokenTypeAccess  = "access"  // 登录 token
+	TokenTypeRefresh = "refresh" // 刷新 token
+	TokenTypeApi     = "api"     // 个人 API Token
+)
+
+// API Token 权限范围
+const (
+	TokenScopeRead         = "read"   // 只读
+	TokenScopeRun          = "run"    // 运行任务
+	TokenScopeSpiderManage = "spider" // 管理爬虫
+)
+
+const (
+	TokenExpireDefault        = 24 * 60 * 60     // 登录 token 默认有效期（秒）
+	TokenRefreshExpireDefault = 7 * 24 * 60 * 60 // 刷新 token 默认有效期（秒）
+)
@@ -0,0 +1,25 @@
+package constants
+
+const (
+	WorkflowRunStatusRunning   = "running"
+	WorkflowRunStatusFinished  = "finished"
+	WorkflowRunStatusError     = "error"
+	WorkflowRunStatusCancelled = "cancelled"
+)
+
+const (
+	WorkflowStepStatusPending  = "pending"
+	WorkflowStepStatusRunning  = "running"
+	WorkflowStepStatusFinished = "finished"
+	WorkflowStepStatusError    = "error"
+	WorkflowStepStatusSkipped  = "skipped"
+)
+
+const (
+	// 所有上游步骤成功
+	WorkflowConditionSuccess = "success"
+	// 任一上游步骤失败
+	WorkflowConditionFailure = "failure"
+	// 所有上游步骤结束
+	WorkflowConditionAlways = "always"
+)
@@ -86,6 +86,45 @@ func (r *Redis) Subscribe(ctx context.Context, consume ConsumeFunc, channel ...s
 	}()
 	return nil
 }
+
+// 订阅频道，订阅成功后返回，不自动重连，ctx 结束时取消订阅
+func (r *Redis) SubscribeOnce(ctx context.Context, consume ConsumeFunc, channel ...string) error {
+	psc := redis.PubSubConn{Conn: r.pool.Get()}
+	if err := psc.Subscribe(redis.Args{}.AddFlat(channel)...); err != nil {
+		utils.Close(psc)
+		return err
+	}
+	// 等待订阅确认
+	switch msg := psc.Receive().(type) {
+	case error:
+		utils.Close(psc)
+		return fmt.Errorf("redis pubsub receive err: %v", msg)
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = psc.Unsubscribe()
+	}()
+	go func() {
+		defer utils.Close(psc)
+		for {
+			switch msg := psc.Receive().(type) {
+			case error:
+				return
+			case redis.Message:
+				if err := consume(msg); err != nil {
+					log.Errorf("redis pubsub consume message err: %v", err)
+				}
+			case redis.Subscription:
+				if msg.Count == 0 {
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
 func (r *Redis) Publish(channel, message string) (n int, err error) {
 	conn := r.pool.Get()
 	defer utils.Close(conn)
@@ -131,6 +131,220 @@ func (r *Redis) BRPop(collection string, timeout int) (string, error) {
 	return values[1], nil
 }
 
+// 阻塞弹出多个列表中第一个非空列表的元素，返回列表名称，超时返回 redis.ErrNil，
+// ctx 结束时中断等待并返回 ctx.Err()
+func (r *Redis) BLPop(ctx context.Context, collections []string, timeout int) (string, error) {
+	if timeout <= 0 {
+		timeout = 60
+	}
+
+	// 使用独立连接（不放回连接池），ctx 结束时关闭连接以中断阻塞
+	c, err := r.pool.Dial()
+	if err != nil {
+		return "", err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		utils.Close(c)
+	}()
+
+	args := redis.Args{}.AddFlat(collections).Add(timeout)
+	values, err := redis.Strings(c.Do("BLPOP", args...))
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", err
+	}
+	return values[0], nil
+}
+
+// 追加元素并只保留最后 size 个，同时设置过期时间
+func (r *Redis) RPushCapped(collection string, value interface{}, size int, expire time.Duration) error {
+	c := r.pool.Get()
+	defer utils.Close(c)
+
+	_ = c.Send("MULTI")
+	_ = c.Send("RPUSH", collection, value)
+	_ = c.Send("LTRIM", collection, -size, -1)
+	_ = c.Send("EXPIRE", collection, int(expire.Seconds()))
+	if _, err := c.Do("EXEC"); err != nil {
+		log.Error(err.Error())
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
+func (r *Redis) LRange(collection string, start int, stop int) ([]string, error) {
+	c := r.pool.Get()
+	defer utils.Close(c)
+
+	values, err := redis.Strings(c.Do("LRANGE", collection, start, stop))
+	if err != nil {
+		return []string{}, err
+	}
+	return values, nil
+}
+
+func (r *Redis) ZAdd(collection string, score float64, value interface{}) error {
+	c := r.pool.Get()
+	defer utils.Close(c)
+
+	if _, err := c.Do("ZADD", collection, score, value); err != nil {
+		log.Error(err.Error())
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
+// 有序集合的元素数量
+func (r *Redis) ZCard(collection string) (int, error) {
+	c := r.pool.Get()
+	defer utils.Close(c)
+
+	return redis.Int(c.Do("ZCARD", collection))
+}
+
+// 弹出有序集合中分数最小的元素，并放入哈希表（值为分数），两步在同一脚本中原子执行
+var zPopMinToHashScript = redis.NewScript(2, `
+local values = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if #values == 0 then
+	return false
+end
+redis.call('ZREM', KEYS[1], values[1])
+redis.call('HSET', KEYS[2], values[1], values[2])
+return values[1]
+`)
+
+// 弹出分数最小的元素并放入哈希表，集合为空时返回 redis.ErrNil
+func (r *Redis) ZPopMinToHash(collection string, hash string) (string, error) {
+	c := r.pool.Get()
+	defer utils.Close(c)
+
+	return redis.String(zPopMinToHashScript.Do(c, collection, hash))
+}
+
+// 将延迟集合中到期（分数不大于 ARGV[1]）的元素移回目标有序集合，元素为 JSON：{"key", "score", "value"}
+var zMoveDueScript = redis.NewScript(1, `
+local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+local keys = {}
+for _, item in ipairs(items) do
+	redis.call('ZREM', KEYS[1], item)
+	local d = cjson.decode(item)
+	redis.call('ZADD', d.key, d.score, d.value)
+	table.insert(keys, d.key)
+end
+return keys
+`)
+
+// 移回延迟集合中到期的元素（每次最多 limit 个），返回目标有序集合名称
+func (r *Redis) ZMoveDue(collection string, due float64, limit int) ([]string, error) {
+	c := r.pool.Get()
+	defer utils.Close(c)
+
+	keys, err := redis.Strings(zMoveDueScript.Do(c, collection, due, limit))
+	if err != nil {
+		log.Errorf("move due members error: %s, collection: %s", err.Error(), collection)
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *Redis) HGetAll(collection string) (map[string]string, error) {
+	c := r.pool.Get()
+	defer utils.Close(c)
+
+	value, err := redis.StringMap(c.Do("HGETALL", collection))
+	if err != nil {
+		log.Error(err.Error())
+		debug.PrintStack()
+		return value, err
+	}
+	return value, nil
+}
+
+func (r *Redis) Type(key string) (string, error) {
+	c := r.pool.Get()
+	defer utils.Close(c)
+
+	value, err := redis.String(c.Do("TYPE", key))
+	if err != nil {
+		log.Error(err.Error())
+		debug.PrintStack()
+		return value, err
+	}
+	return value, nil
+}
+
+// 获取信号量槽位：清理过期成员后，若成员数小于上限则加入成员（分数为过期时间戳）
+var acquireSlotScript = redis.NewScript(1, `
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if redis.call('ZSCORE', KEYS[1], ARGV[4]) then
+	redis.call('ZADD', KEYS[1], ARGV[2], ARGV[4])
+	return 1
+end
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+return 1
+`)
+
+// 获取信号量槽位，成员在ttl时间内未刷新将自动释放
+func (r *Redis) AcquireSlot(key string, member string, limit int, ttl time.Duration) (bool, error) {
+	c := r.pool.Get()
+	defer utils.Close(c)
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	ttlMs := int64(ttl / time.Millisecond)
+	ok, err := redis.Int(acquireSlotScript.Do(c, key, now, now+ttlMs, limit, member, ttlMs))
+	if err != nil {
+		log.Errorf("acquire slot error: %s, key: %s", err.Error(), key)
+		debug.PrintStack()
+		return false, err
+	}
+	return ok == 1, nil
+}
+
+// 刷新信号量槽位过期时间
+func (r *Redis) RefreshSlot(key string, member string, ttl time.Duration) error {
+	c := r.pool.Get()
+	defer utils.Close(c)
+
+	ttlMs := int64(ttl / time.Millisecond)
+	expireTs := time.Now().UnixNano()/int64(time.Millisecond) + ttlMs
+	if _, err := c.Do("ZADD", key, "XX", expireTs, member); err != nil {
+		log.Errorf("refresh slot error: %s, key: %s", err.Error(), key)
+		return err
+	}
+	if _, err := c.Do("PEXPIRE", key, ttlMs); err != nil {
+		log.Errorf("refresh slot error: %s, key: %s", err.Error(), key)
+		return err
+	}
+	return nil
+}
+
+// 释放信号量槽位
+func (r *Redis) ReleaseSlot(key string, member string) error {
+	c := r.pool.Get()
+	defer utils.Close(c)
+
+	if _, err := c.Do("ZREM", key, member); err != nil {
+		log.Errorf("release slot error: %s, key: %s", err.Error(), key)
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
 func NewRedisPool() *redis.Pool {
 	var address = viper.GetString("redis.address")
 	var port = viper.GetString("redis.port")
@@ -15,3 +15,11 @@ type ScrapyItem struct {
 	Name   string   `json:"name"`
 	Fields []string `json:"fields"`
 }
+
+type SpiderVersionDiff struct {
+	From     int      `json:"from"`
+	To       int      `json:"to"`
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Modified []string `json:"modified"`
+}
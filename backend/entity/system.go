@@ -1,11 +1,21 @@
 package entity
 
+import "time"
+
 type SystemInfo struct {
 	ARCH        string       `json:"arch"`
 	OS          string       `json:"os"`
 	Hostname    string       `json:"host_name"`
 	NumCpu      int          `json:"num_cpu"`
 	Executables []Executable `json:"executables"`
+	Workers     WorkerStats  `json:"workers"`
+}
+
+type WorkerStats struct {
+	Total    int       `json:"total"`
+	Busy     int       `json:"busy"`
+	Idle     int       `json:"idle"`
+	UpdateTs time.Time `json:"update_ts"`
 }
 
 type Executable struct {
@@ -33,6 +43,19 @@ type Dependency struct {
 	Installed   bool   `json:"installed"`
 }
 
+// 命令输出
+type CmdOutput struct {
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+}
+
+// 离线依赖缓存中的文件
+type DepCacheFile struct {
+	Path string `json:"path"` // 相对缓存目录的路径
+	Size int64  `json:"size"`
+	Md5  string `json:"md5"`
+}
+
 type PackageJson struct {
 	Dependencies map[string]string `json:"dependencies"`
 }
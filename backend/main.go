@@ -11,6 +11,7 @@ import (
 	"crawlab/routes"
 	"crawlab/services"
 	"crawlab/services/challenge"
+	"crawlab/services/result_sink"
 	"crawlab/services/rpc"
 	"github.com/apex/log"
 	"github.com/gin-gonic/gin"
@@ -109,6 +110,30 @@ func main() {
 			panic(err)
 		}
 		log.Info("initialized clean service successfully")
+
+		// 初始化审计日志服务
+		if err := services.InitAuditService(); err != nil {
+			log.Error("init audit service error:" + err.Error())
+			debug.PrintStack()
+			panic(err)
+		}
+		log.Info("initialized audit service successfully")
+
+		// 初始化结果投递服务
+		if err := result_sink.InitResultDeliveryService(); err != nil {
+			log.Error("init result delivery service error:" + err.Error())
+			debug.PrintStack()
+			panic(err)
+		}
+		log.Info("initialized result delivery service successfully")
+
+		// 初始化环境配置服务
+		if err := services.InitEnvProfileService(); err != nil {
+			log.Error("init env profile service error:" + err.Error())
+			debug.PrintStack()
+			panic(err)
+		}
+		log.Info("initialized env profile service successfully")
 	}
 
 	// 初始化任务执行器
@@ -155,18 +180,20 @@ func main() {
 			app.Use(middlewares.EsLog(ctx, esClient))
 		}
 		app.Use(middlewares.CORSMiddleware())
-		anonymousGroup := app.Group("/")
+		anonymousGroup := app.Group("/", middlewares.AuditMiddleware())
 		{
-			anonymousGroup.POST("/login", routes.Login)       // 用户登录
-			anonymousGroup.PUT("/users", routes.PutUser)      // 添加用户
-			anonymousGroup.GET("/setting", routes.GetSetting) // 获取配置信息
+			anonymousGroup.POST("/login", routes.Login)                // 用户登录
+			anonymousGroup.POST("/login/refresh", routes.RefreshToken) // 刷新登录 token
+			anonymousGroup.POST("/logout", routes.Logout)              // 登出
+			anonymousGroup.PUT("/users", routes.PutUser)               // 添加用户
+			anonymousGroup.GET("/setting", routes.GetSetting)          // 获取配置信息
 			// release版本
 			anonymousGroup.GET("/version", routes.GetVersion)               // 获取发布的版本
 			anonymousGroup.GET("/releases/latest", routes.GetLatestRelease) // 获取最近发布的版本
 			// 文档
 			anonymousGroup.GET("/docs", routes.GetDocs) // 获取文档数据
 		}
-		authGroup := app.Group("/", middlewares.AuthorizationMiddleware())
+		authGroup := app.Group("/", middlewares.AuthorizationMiddleware(), middlewares.AuditMiddleware(), middlewares.PermissionMiddleware())
 		{
 			// 节点
 			{
@@ -182,6 +209,7 @@ func main() {
 				authGroup.POST("/nodes/:id/deps/install", routes.InstallDep)           // 节点安装依赖
 				authGroup.POST("/nodes/:id/deps/uninstall", routes.UninstallDep)       // 节点卸载依赖
 				authGroup.POST("/nodes/:id/langs/install", routes.InstallLang)         // 节点安装语言
+				authGroup.GET("/nodes/:id/dep_jobs", routes.GetNodeDepJobList)         // 节点依赖安装历史
 			}
 			// 爬虫
 			{
@@ -216,6 +244,10 @@ func main() {
 				authGroup.GET("/spiders/:id/scrapy/spider/filepath", routes.GetSpiderScrapySpiderFilepath) // Scrapy 爬虫 pipelines
 				authGroup.POST("/spiders/:id/git/sync", routes.PostSpiderSyncGit)                          // 爬虫 Git 同步
 				authGroup.POST("/spiders/:id/git/reset", routes.PostSpiderResetGit)                        // 爬虫 Git 重置
+				authGroup.GET("/spiders/:id/versions", routes.GetSpiderVersionList)                        // 爬虫版本列表
+				authGroup.GET("/spiders/:id/results/download", routes.DownloadSpiderResults)               // 下载爬虫结果
+				authGroup.GET("/spiders/:id/versions/diff", routes.GetSpiderVersionDiff)                   // 爬虫版本差异
+				authGroup.POST("/spiders/:id/versions/:version/rollback", routes.RollbackSpiderVersion)    // 爬虫版本回滚
 				authGroup.POST("/spiders-cancel", routes.CancelSelectedSpider)                             // 停止所选爬虫任务
 				authGroup.POST("/spiders-run", routes.RunSelectedSpider)                                   // 运行所选爬虫
 			}
@@ -231,18 +263,22 @@ func main() {
 			}
 			// 任务
 			{
-				authGroup.GET("/tasks", routes.GetTaskList)                                 // 任务列表
-				authGroup.GET("/tasks/:id", routes.GetTask)                                 // 任务详情
-				authGroup.PUT("/tasks", routes.PutTask)                                     // 派发任务
-				authGroup.DELETE("/tasks/:id", routes.DeleteTask)                           // 删除任务
-				authGroup.DELETE("/tasks", routes.DeleteSelectedTask)                       // 删除多个任务
-				authGroup.DELETE("/tasks_by_status", routes.DeleteTaskByStatus)             // 删除指定状态的任务
-				authGroup.POST("/tasks/:id/cancel", routes.CancelTask)                      // 取消任务
-				authGroup.GET("/tasks/:id/log", routes.GetTaskLog)                          // 任务日志
-				authGroup.GET("/tasks/:id/error-log", routes.GetTaskErrorLog)               // 任务错误日志
-				authGroup.GET("/tasks/:id/results", routes.GetTaskResults)                  // 任务结果
-				authGroup.GET("/tasks/:id/results/download", routes.DownloadTaskResultsCsv) // 下载任务结果
-				authGroup.POST("/tasks/:id/restart", routes.RestartTask)                    // 重新开始任务
+				authGroup.GET("/tasks", routes.GetTaskList)                                          // 任务列表
+				authGroup.GET("/tasks/:id", routes.GetTask)                                          // 任务详情
+				authGroup.PUT("/tasks", routes.PutTask)                                              // 派发任务
+				authGroup.DELETE("/tasks/:id", routes.DeleteTask)                                    // 删除任务
+				authGroup.DELETE("/tasks", routes.DeleteSelectedTask)                                // 删除多个任务
+				authGroup.DELETE("/tasks_by_status", routes.DeleteTaskByStatus)                      // 删除指定状态的任务
+				authGroup.POST("/tasks/:id/cancel", routes.CancelTask)                               // 取消任务
+				authGroup.GET("/tasks/:id/log", routes.GetTaskLog)                                   // 任务日志
+				authGroup.GET("/tasks/:id/log/stream", routes.StreamTaskLog)                         // 实时任务日志
+				authGroup.GET("/tasks/:id/error-log", routes.GetTaskErrorLog)                        // 任务错误日志
+				authGroup.GET("/tasks/:id/results", routes.GetTaskResults)                           // 任务结果
+				authGroup.GET("/tasks/:id/results/download", routes.DownloadTaskResults)             // 下载任务结果
+				authGroup.POST("/tasks/:id/restart", routes.RestartTask)                             // 重新开始任务
+				authGroup.GET("/tasks/:id/attempts", routes.GetTaskAttempts)                         // 任务执行记录（重试）
+				authGroup.GET("/tasks/:id/deliveries", routes.GetTaskDeliveries)                     // 任务结果投递状态
+				authGroup.POST("/tasks/:id/deliveries/:delivery_id/retry", routes.RetryTaskDelivery) // 重新投递任务结果
 			}
 			// 定时任务
 			{
@@ -266,8 +302,22 @@ func main() {
 			}
 			// 系统
 			{
-				authGroup.GET("/system/deps/:lang", routes.GetAllDepList)             // 节点所有第三方依赖列表
-				authGroup.GET("/system/deps/:lang/:dep_name/json", routes.GetDepJson) // 节点第三方依赖JSON
+				authGroup.GET("/system/deps/:lang", routes.GetAllDepList)                 // 节点所有第三方依赖列表
+				authGroup.GET("/system/deps/:lang/:dep_name/json", routes.GetDepJson)     // 节点第三方依赖JSON
+				authGroup.GET("/deps_cache/:lang", routes.GetDepCacheList)                // 离线依赖缓存文件列表
+				authGroup.POST("/deps_cache/:lang", routes.AddDepCache)                   // 下载依赖到离线缓存
+				authGroup.POST("/deps_cache/:lang/upload", routes.UploadDepCache)         // 上传依赖包到离线缓存
+				authGroup.DELETE("/deps_cache/:lang", routes.DeleteDepCache)              // 删除离线缓存文件
+				authGroup.GET("/dep_jobs", routes.GetDepJobList)                          // 依赖安装任务列表
+				authGroup.PUT("/dep_jobs", routes.PutDepJob)                              // 创建依赖安装任务（多节点）
+				authGroup.GET("/dep_jobs/:id", routes.GetDepJob)                          // 依赖安装任务详情
+				authGroup.GET("/env_profiles", routes.GetEnvProfileList)                  // 环境配置列表
+				authGroup.GET("/env_profiles/:id", routes.GetEnvProfile)                  // 环境配置详情
+				authGroup.PUT("/env_profiles", routes.PutEnvProfile)                      // 新增环境配置
+				authGroup.POST("/env_profiles/:id", routes.PostEnvProfile)                // 修改环境配置
+				authGroup.DELETE("/env_profiles/:id", routes.DeleteEnvProfile)            // 删除环境配置
+				authGroup.GET("/env_profiles/:id/drift", routes.GetEnvProfileDrift)       // 节点环境偏差
+				authGroup.POST("/env_profiles/:id/reconcile", routes.ReconcileEnvProfile) // 修复节点环境偏差
 			}
 			// 全局变量
 			{
@@ -278,11 +328,27 @@ func main() {
 			}
 			// 项目
 			{
-				authGroup.GET("/projects", routes.GetProjectList)       // 列表
-				authGroup.GET("/projects/tags", routes.GetProjectTags)  // 项目标签
-				authGroup.PUT("/projects", routes.PutProject)           // 修改
-				authGroup.POST("/projects/:id", routes.PostProject)     // 新增
-				authGroup.DELETE("/projects/:id", routes.DeleteProject) // 删除
+				authGroup.GET("/projects", routes.GetProjectList)                              // 列表
+				authGroup.GET("/projects/tags", routes.GetProjectTags)                         // 项目标签
+				authGroup.PUT("/projects", routes.PutProject)                                  // 修改
+				authGroup.POST("/projects/:id", routes.PostProject)                            // 新增
+				authGroup.DELETE("/projects/:id", routes.DeleteProject)                        // 删除
+				authGroup.GET("/projects/:id/members", routes.GetProjectMemberList)            // 项目成员列表
+				authGroup.PUT("/projects/:id/members", routes.PutProjectMember)                // 设置项目成员角色
+				authGroup.DELETE("/projects/:id/members/:user_id", routes.DeleteProjectMember) // 删除项目成员
+				authGroup.GET("/projects/:id/permissions", routes.GetProjectPermissions)       // 当前用户的项目权限
+			}
+			// 工作流
+			{
+				authGroup.GET("/workflows", routes.GetWorkflowList)                   // 列表
+				authGroup.GET("/workflows/:id", routes.GetWorkflow)                   // 详情
+				authGroup.PUT("/workflows", routes.PutWorkflow)                       // 新增
+				authGroup.POST("/workflows/:id", routes.PostWorkflow)                 // 修改
+				authGroup.DELETE("/workflows/:id", routes.DeleteWorkflow)             // 删除
+				authGroup.POST("/workflows/:id/run", routes.RunWorkflow)              // 运行
+				authGroup.GET("/workflows/:id/runs", routes.GetWorkflowRunList)       // 执行记录
+				authGroup.GET("/workflow_runs/:id", routes.GetWorkflowRun)            // 执行详情
+				authGroup.POST("/workflow_runs/:id/cancel", routes.CancelWorkflowRun) // 取消执行
 			}
 			// 挑战
 			{
@@ -302,6 +368,8 @@ func main() {
 				authGroup.PUT("/tokens", routes.PutToken)           // 添加 Token
 				authGroup.DELETE("/tokens/:id", routes.DeleteToken) // 删除 Token
 			}
+			// 审计日志
+			authGroup.GET("/audit", routes.GetAuditLogList) // 审计日志列表
 			// 统计数据
 			authGroup.GET("/stats/home", routes.GetHomeStats) // 首页统计数据
 			// 文件
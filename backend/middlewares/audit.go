@@ -0,0 +1,232 @@
+package middlewares
+
+import (
+	"bytes"
+	"crawlab/constants"
+	"crawlab/model"
+	"crawlab/services"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+	"io/ioutil"
+	"strings"
+)
+
+// 路径中的当前用户
+const auditIdParamMe = "me"
+
+type auditRule struct {
+	Method       string
+	Path         string
+	ResourceType string
+	Action       string
+	IdParam      string // 资源ID的路径参数，为空时从返回结果中获取
+}
+
+// 需要记录审计日志的路由
+var auditRules = []auditRule{
+	// 爬虫
+	{"PUT", "/spiders", constants.AuditResourceSpider, constants.AuditActionCreate, ""},
+	{"POST", "/spiders", constants.AuditResourceSpider, constants.AuditActionUpload, ""},
+	{"POST", "/spiders/:id", constants.AuditResourceSpider, constants.AuditActionUpdate, "id"},
+	{"POST", "/spiders/:id/publish", constants.AuditResourceSpider, constants.AuditActionPublish, "id"},
+	{"POST", "/spiders/:id/upload", constants.AuditResourceSpider, constants.AuditActionUpload, "id"},
+	{"DELETE", "/spiders", constants.AuditResourceSpider, constants.AuditActionDelete, ""},
+	{"DELETE", "/spiders/:id", constants.AuditResourceSpider, constants.AuditActionDelete, "id"},
+	{"POST", "/spiders/:id/copy", constants.AuditResourceSpider, constants.AuditActionCopy, "id"},
+	{"POST", "/spiders/:id/file", constants.AuditResourceSpider, constants.AuditActionUpdate, "id"},
+	{"PUT", "/spiders/:id/file", constants.AuditResourceSpider, constants.AuditActionUpdate, "id"},
+	{"PUT", "/spiders/:id/dir", constants.AuditResourceSpider, constants.AuditActionUpdate, "id"},
+	{"DELETE", "/spiders/:id/file", constants.AuditResourceSpider, constants.AuditActionUpdate, "id"},
+	{"POST", "/spiders/:id/file/rename", constants.AuditResourceSpider, constants.AuditActionUpdate, "id"},
+	{"PUT", "/spiders/:id/scrapy/spiders", constants.AuditResourceSpider, constants.AuditActionUpdate, "id"},
+	{"POST", "/spiders/:id/scrapy/settings", constants.AuditResourceSpider, constants.AuditActionUpdate, "id"},
+	{"POST", "/spiders/:id/scrapy/items", constants.AuditResourceSpider, constants.AuditActionUpdate, "id"},
+	{"POST", "/spiders/:id/git/sync", constants.AuditResourceSpider, constants.AuditActionUpdate, "id"},
+	{"POST", "/spiders/:id/git/reset", constants.AuditResourceSpider, constants.AuditActionUpdate, "id"},
+	{"POST", "/spiders/:id/versions/:version/rollback", constants.AuditResourceSpider, constants.AuditActionRollback, "id"},
+	{"POST", "/spiders-cancel", constants.AuditResourceSpider, constants.AuditActionCancel, ""},
+	{"POST", "/spiders-run", constants.AuditResourceSpider, constants.AuditActionRun, ""},
+	{"PUT", "/config_spiders", constants.AuditResourceSpider, constants.AuditActionCreate, ""},
+	{"POST", "/config_spiders/:id", constants.AuditResourceSpider, constants.AuditActionUpdate, "id"},
+	{"POST", "/config_spiders/:id/config", constants.AuditResourceSpider, constants.AuditActionUpdate, "id"},
+	{"POST", "/config_spiders/:id/upload", constants.AuditResourceSpider, constants.AuditActionUpload, "id"},
+	{"POST", "/config_spiders/:id/spiderfile", constants.AuditResourceSpider, constants.AuditActionUpdate, "id"},
+
+	// 任务
+	{"PUT", "/tasks", constants.AuditResourceTask, constants.AuditActionRun, ""},
+	{"DELETE", "/tasks", constants.AuditResourceTask, constants.AuditActionDelete, ""},
+	{"DELETE", "/tasks/:id", constants.AuditResourceTask, constants.AuditActionDelete, "id"},
+	{"DELETE", "/tasks_by_status", constants.AuditResourceTask, constants.AuditActionDelete, ""},
+	{"POST", "/tasks/:id/cancel", constants.AuditResourceTask, constants.AuditActionCancel, "id"},
+	{"POST", "/tasks/:id/restart", constants.AuditResourceTask, constants.AuditActionRestart, "id"},
+	{"POST", "/tasks/:id/deliveries/:delivery_id/retry", constants.AuditResourceTask, constants.AuditActionRetry, "id"},
+
+	// 定时任务
+	{"PUT", "/schedules", constants.AuditResourceSchedule, constants.AuditActionCreate, ""},
+	{"POST", "/schedules/:id", constants.AuditResourceSchedule, constants.AuditActionUpdate, "id"},
+	{"DELETE", "/schedules/:id", constants.AuditResourceSchedule, constants.AuditActionDelete, "id"},
+	{"POST", "/schedules/:id/disable", constants.AuditResourceSchedule, constants.AuditActionDisable, "id"},
+	{"POST", "/schedules/:id/enable", constants.AuditResourceSchedule, constants.AuditActionEnable, "id"},
+
+	// 用户
+	{"PUT", "/users", constants.AuditResourceUser, constants.AuditActionCreate, ""},
+	{"PUT", "/users-add", constants.AuditResourceUser, constants.AuditActionCreate, ""},
+	{"POST", "/users/:id", constants.AuditResourceUser, constants.AuditActionUpdate, "id"},
+	{"DELETE", "/users/:id", constants.AuditResourceUser, constants.AuditActionDelete, "id"},
+	{"POST", "/me", constants.AuditResourceUser, constants.AuditActionUpdate, auditIdParamMe},
+
+	// 全局变量
+	{"PUT", "/variable", constants.AuditResourceVariable, constants.AuditActionCreate, ""},
+	{"POST", "/variable/:id", constants.AuditResourceVariable, constants.AuditActionUpdate, "id"},
+	{"DELETE", "/variable/:id", constants.AuditResourceVariable, constants.AuditActionDelete, "id"},
+
+	// API Token
+	{"PUT", "/tokens", constants.AuditResourceToken, constants.AuditActionCreate, ""},
+	{"DELETE", "/tokens/:id", constants.AuditResourceToken, constants.AuditActionDelete, "id"},
+
+	// 项目
+	{"PUT", "/projects", constants.AuditResourceProject, constants.AuditActionCreate, ""},
+	{"POST", "/projects/:id", constants.AuditResourceProject, constants.AuditActionUpdate, "id"},
+	{"DELETE", "/projects/:id", constants.AuditResourceProject, constants.AuditActionDelete, "id"},
+	{"PUT", "/projects/:id/members", constants.AuditResourceProject, constants.AuditActionUpdate, "id"},
+	{"DELETE", "/projects/:id/members/:user_id", constants.AuditResourceProject, constants.AuditActionUpdate, "id"},
+
+	// 工作流
+	{"PUT", "/workflows", constants.AuditResourceWorkflow, constants.AuditActionCreate, ""},
+	{"POST", "/workflows/:id", constants.AuditResourceWorkflow, constants.AuditActionUpdate, "id"},
+	{"DELETE", "/workflows/:id", constants.AuditResourceWorkflow, constants.AuditActionDelete, "id"},
+	{"POST", "/workflows/:id/run", constants.AuditResourceWorkflow, constants.AuditActionRun, "id"},
+	{"POST", "/workflow_runs/:id/cancel", constants.AuditResourceWorkflow, constants.AuditActionCancel, ""},
+
+	// 节点
+	{"POST", "/nodes/:id", constants.AuditResourceNode, constants.AuditActionUpdate, "id"},
+	{"DELETE", "/nodes/:id", constants.AuditResourceNode, constants.AuditActionDelete, "id"},
+	{"POST", "/nodes/:id/deps/install", constants.AuditResourceNode, constants.AuditActionInstall, "id"},
+	{"POST", "/nodes/:id/deps/uninstall", constants.AuditResourceNode, constants.AuditActionDelete, "id"},
+	{"POST", "/nodes/:id/langs/install", constants.AuditResourceNode, constants.AuditActionInstall, "id"},
+	{"POST", "/deps_cache/:lang", constants.AuditResourceNode, constants.AuditActionInstall, ""},
+	{"POST", "/deps_cache/:lang/upload", constants.AuditResourceNode, constants.AuditActionUpload, ""},
+	{"DELETE", "/deps_cache/:lang", constants.AuditResourceNode, constants.AuditActionDelete, ""},
+	{"PUT", "/dep_jobs", constants.AuditResourceNode, constants.AuditActionInstall, ""},
+
+	// 环境配置
+	{"PUT", "/env_profiles", constants.AuditResourceEnvProfile, constants.AuditActionCreate, ""},
+	{"POST", "/env_profiles/:id", constants.AuditResourceEnvProfile, constants.AuditActionUpdate, "id"},
+	{"DELETE", "/env_profiles/:id", constants.AuditResourceEnvProfile, constants.AuditActionDelete, "id"},
+	{"POST", "/env_profiles/:id/reconcile", constants.AuditResourceEnvProfile, constants.AuditActionInstall, "id"},
+}
+
+// 记录返回内容，用于获取新建资源的ID
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w auditResponseWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// 记录修改类请求的审计日志，包括操作人、资源和字段变更
+// 只记录通过 HTTP 接口发起的修改，定时任务调度、节点间 RPC、工作流执行、数据迁移等
+// 后台流程对数据的修改不会被记录
+func AuditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule, params, ok := matchAuditRule(c.Request.Method, c.Request.URL.Path)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		// 资源ID
+		var id string
+		if rule.IdParam == auditIdParamMe {
+			id = services.GetCurrentUserId(c).Hex()
+		} else if rule.IdParam != "" {
+			id = params[rule.IdParam]
+		}
+
+		// 请求参数
+		var detail string
+		if strings.HasPrefix(c.ContentType(), "application/json") {
+			if data, err := ioutil.ReadAll(c.Request.Body); err == nil {
+				c.Request.Body = ioutil.NopCloser(bytes.NewReader(data))
+				detail = services.GetAuditDetail(data)
+			}
+		}
+
+		// 变更前的数据
+		before := model.GetAuditSnapshot(rule.ResourceType, id)
+
+		// 新建资源时从返回结果中获取ID
+		var w *auditResponseWriter
+		if id == "" {
+			w = &auditResponseWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+			c.Writer = w
+		}
+
+		c.Next()
+
+		if w != nil {
+			id = getAuditResponseId(w.body.Bytes())
+		}
+
+		// 变更后的数据
+		after := model.GetAuditSnapshot(rule.ResourceType, id)
+
+		var maskedFields []string
+		if r, ok := model.GetAuditResource(rule.ResourceType); ok {
+			maskedFields = r.MaskedFields
+		}
+
+		user := services.GetCurrentUser(c)
+		l := model.AuditLog{
+			UserId:       user.Id,
+			Username:     user.Username,
+			Action:       rule.Action,
+			ResourceType: rule.ResourceType,
+			ResourceId:   id,
+			Method:       c.Request.Method,
+			Path:         c.Request.URL.Path,
+			Ip:           c.ClientIP(),
+			StatusCode:   c.Writer.Status(),
+			Changes:      services.DiffAuditSnapshots(before, after, maskedFields),
+			Detail:       detail,
+		}
+		go func() {
+			_ = services.AddAuditLog(l)
+		}()
+	}
+}
+
+func matchAuditRule(method string, path string) (auditRule, map[string]string, bool) {
+	for _, rule := range auditRules {
+		if rule.Method != method {
+			continue
+		}
+		if params, ok := matchPath(rule.Path, path); ok {
+			return rule, params, true
+		}
+	}
+	return auditRule{}, nil, false
+}
+
+// 从返回结果的 data 中获取资源ID
+func getAuditResponseId(body []byte) string {
+	var res struct {
+		Data interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return ""
+	}
+	switch data := res.Data.(type) {
+	case string:
+		return data
+	case map[string]interface{}:
+		if id, ok := data["_id"].(string); ok && bson.IsObjectIdHex(id) {
+			return id
+		}
+	}
+	return ""
+}
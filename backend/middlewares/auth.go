@@ -2,9 +2,11 @@ package middlewares
 
 import (
 	"crawlab/constants"
+	"crawlab/model"
 	"crawlab/routes"
 	"crawlab/services"
 	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
 	"net/http"
 	"strings"
 )
@@ -14,8 +16,13 @@ func AuthorizationMiddleware() gin.HandlerFunc {
 		// 获取token string
 		tokenStr := c.GetHeader("Authorization")
 
+		// 浏览器 EventSource 无法设置请求头，实时日志允许通过参数传递 token
+		if tokenStr == "" && strings.HasPrefix(c.GetHeader("Accept"), "text/event-stream") {
+			tokenStr = c.Query("token")
+		}
+
 		// 校验token
-		user, err := services.CheckToken(tokenStr)
+		user, apiToken, err := services.ParseToken(tokenStr)
 
 		// 校验失败，返回错误响应
 		if err != nil {
@@ -29,7 +36,8 @@ func AuthorizationMiddleware() gin.HandlerFunc {
 
 		// 如果为普通权限，校验请求地址是否符合要求
 		if user.Role == constants.RoleNormal {
-			if strings.HasPrefix(strings.ToLower(c.Request.URL.Path), "/users") {
+			path := strings.ToLower(c.Request.URL.Path)
+			if strings.HasPrefix(path, "/users") || strings.HasPrefix(path, "/audit") {
 				c.AbortWithStatusJSON(http.StatusUnauthorized, routes.Response{
 					Status:  "ok",
 					Message: "unauthorized",
@@ -42,6 +50,14 @@ func AuthorizationMiddleware() gin.HandlerFunc {
 		// 设置用户
 		c.Set(constants.ContextUser, &user)
 
+		// 设置 API Token，并记录最近使用时间和IP
+		if apiToken != nil {
+			c.Set(constants.ContextToken, apiToken)
+			go func(id bson.ObjectId, ip string) {
+				_ = model.UpdateTokenLastUsed(id, ip)
+			}(apiToken.Id, c.ClientIP())
+		}
+
 		// 校验成功
 		c.Next()
 	}
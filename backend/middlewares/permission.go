@@ -0,0 +1,349 @@
+package middlewares
+
+import (
+	"bytes"
+	"crawlab/constants"
+	"crawlab/model"
+	"crawlab/routes"
+	"crawlab/services"
+	"crawlab/utils"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// 权限校验的资源类型
+const (
+	resourceGlobal         = "global"          // 不属于具体项目，需要用户被授予全局权限
+	resourceAdmin          = "admin"           // 仅管理员
+	resourceUploadSpider   = "upload_spider"   // 表单中的爬虫名称
+	resourceProject        = "project"         // 路径中的项目ID
+	resourceSpider         = "spider"          // 路径中的爬虫ID
+	resourceSchedule       = "schedule"        // 路径中的定时任务ID
+	resourceTask           = "task"            // 路径中的任务ID
+	resourceBodySpiderId   = "body_spider_id"  // 请求体中的 spider_id
+	resourceBodySpiderIds  = "body_spider_ids" // 请求体中的 spider_ids
+	resourceBodyTaskParams = "body_task_params"
+	resourceBodyTaskIds    = "body_task_ids"
+	resourceBodyProjectId  = "body_project_id"
+)
+
+// 校验用户对爬虫的权限（测试时替换）
+var checkSpiderPermission = services.CheckSpiderPermission
+
+type permissionRule struct {
+	Method     string
+	Path       string
+	Permission string
+	Resource   string
+}
+
+// 需要校验权限的路由，未列出的路由只校验登录
+var permissionRules = []permissionRule{
+	// 爬虫
+	{"PUT", "/spiders", constants.PermissionSpiderEdit, resourceBodyProjectId},
+	{"POST", "/spiders", constants.PermissionSpiderEdit, resourceUploadSpider},
+	{"POST", "/spiders/:id", constants.PermissionSpiderEdit, resourceSpider},
+	{"POST", "/spiders/:id/publish", constants.PermissionSpiderEdit, resourceSpider},
+	{"POST", "/spiders/:id/upload", constants.PermissionSpiderEdit, resourceSpider},
+	{"DELETE", "/spiders", constants.PermissionSpiderDelete, resourceBodySpiderIds},
+	{"DELETE", "/spiders/:id", constants.PermissionSpiderDelete, resourceSpider},
+	{"POST", "/spiders/:id/copy", constants.PermissionSpiderEdit, resourceSpider},
+	{"POST", "/spiders/:id/file", constants.PermissionSpiderEdit, resourceSpider},
+	{"PUT", "/spiders/:id/file", constants.PermissionSpiderEdit, resourceSpider},
+	{"PUT", "/spiders/:id/dir", constants.PermissionSpiderEdit, resourceSpider},
+	{"DELETE", "/spiders/:id/file", constants.PermissionSpiderEdit, resourceSpider},
+	{"POST", "/spiders/:id/file/rename", constants.PermissionSpiderEdit, resourceSpider},
+	{"PUT", "/spiders/:id/scrapy/spiders", constants.PermissionSpiderEdit, resourceSpider},
+	{"POST", "/spiders/:id/scrapy/settings", constants.PermissionSpiderEdit, resourceSpider},
+	{"POST", "/spiders/:id/scrapy/items", constants.PermissionSpiderEdit, resourceSpider},
+	{"POST", "/spiders/:id/git/sync", constants.PermissionSpiderEdit, resourceSpider},
+	{"POST", "/spiders/:id/git/reset", constants.PermissionSpiderEdit, resourceSpider},
+	{"POST", "/git/checkout", constants.PermissionSpiderEdit, resourceBodySpiderId},
+	{"POST", "/spiders/:id/versions/:version/rollback", constants.PermissionSpiderEdit, resourceSpider},
+	{"POST", "/spiders-cancel", constants.PermissionSpiderRun, resourceBodySpiderIds},
+	{"POST", "/spiders-run", constants.PermissionSpiderRun, resourceBodyTaskParams},
+	{"GET", "/spiders/:id/results/download", constants.PermissionSpiderView, resourceSpider},
+
+	// 可配置爬虫
+	{"PUT", "/config_spiders", constants.PermissionSpiderEdit, resourceBodyProjectId},
+	{"POST", "/config_spiders/:id", constants.PermissionSpiderEdit, resourceSpider},
+	{"POST", "/config_spiders/:id/config", constants.PermissionSpiderEdit, resourceSpider},
+	{"POST", "/config_spiders/:id/upload", constants.PermissionSpiderEdit, resourceSpider},
+	{"POST", "/config_spiders/:id/spiderfile", constants.PermissionSpiderEdit, resourceSpider},
+
+	// 任务
+	{"PUT", "/tasks", constants.PermissionSpiderRun, resourceBodySpiderId},
+	{"DELETE", "/tasks", constants.PermissionSpiderRun, resourceBodyTaskIds},
+	{"DELETE", "/tasks/:id", constants.PermissionSpiderRun, resourceTask},
+	{"DELETE", "/tasks_by_status", constants.PermissionSpiderRun, resourceGlobal},
+	{"POST", "/tasks/:id/cancel", constants.PermissionSpiderRun, resourceTask},
+	{"POST", "/tasks/:id/restart", constants.PermissionSpiderRun, resourceTask},
+	{"GET", "/tasks/:id/log/stream", constants.PermissionSpiderView, resourceTask},
+	{"GET", "/tasks/:id/results/download", constants.PermissionSpiderView, resourceTask},
+	{"GET", "/tasks/:id/deliveries", constants.PermissionSpiderView, resourceTask},
+	{"POST", "/tasks/:id/deliveries/:delivery_id/retry", constants.PermissionSpiderRun, resourceTask},
+
+	// 定时任务
+	{"PUT", "/schedules", constants.PermissionScheduleManage, resourceBodySpiderId},
+	{"POST", "/schedules/:id", constants.PermissionScheduleManage, resourceSchedule},
+	{"DELETE", "/schedules/:id", constants.PermissionScheduleManage, resourceSchedule},
+	{"POST", "/schedules/:id/disable", constants.PermissionScheduleManage, resourceSchedule},
+	{"POST", "/schedules/:id/enable", constants.PermissionScheduleManage, resourceSchedule},
+
+	// 工作流
+	{"PUT", "/workflows", constants.PermissionScheduleManage, resourceGlobal},
+	{"POST", "/workflows/:id", constants.PermissionScheduleManage, resourceGlobal},
+	{"DELETE", "/workflows/:id", constants.PermissionScheduleManage, resourceGlobal},
+	{"POST", "/workflows/:id/run", constants.PermissionSpiderRun, resourceGlobal},
+	{"POST", "/workflow_runs/:id/cancel", constants.PermissionSpiderRun, resourceGlobal},
+
+	// 节点
+	{"POST", "/nodes/:id", constants.PermissionNodeManage, resourceGlobal},
+	{"DELETE", "/nodes/:id", constants.PermissionNodeManage, resourceGlobal},
+
+	// 节点依赖
+	{"POST", "/nodes/:id/deps/install", constants.PermissionNodeDepInstall, resourceGlobal},
+	{"POST", "/nodes/:id/deps/uninstall", constants.PermissionNodeDepInstall, resourceGlobal},
+	{"POST", "/nodes/:id/langs/install", constants.PermissionNodeDepInstall, resourceGlobal},
+	{"POST", "/deps_cache/:lang", constants.PermissionNodeDepInstall, resourceGlobal},
+	{"POST", "/deps_cache/:lang/upload", constants.PermissionNodeDepInstall, resourceGlobal},
+	{"DELETE", "/deps_cache/:lang", constants.PermissionNodeDepInstall, resourceGlobal},
+	{"PUT", "/dep_jobs", constants.PermissionNodeDepInstall, resourceGlobal},
+
+	// 环境配置
+	{"PUT", "/env_profiles", constants.PermissionNodeDepInstall, resourceGlobal},
+	{"POST", "/env_profiles/:id", constants.PermissionNodeDepInstall, resourceGlobal},
+	{"DELETE", "/env_profiles/:id", constants.PermissionNodeDepInstall, resourceGlobal},
+	{"POST", "/env_profiles/:id/reconcile", constants.PermissionNodeDepInstall, resourceGlobal},
+
+	// 全局变量
+	{"PUT", "/variable", constants.PermissionVariableManage, resourceGlobal},
+	{"POST", "/variable/:id", constants.PermissionVariableManage, resourceGlobal},
+	{"DELETE", "/variable/:id", constants.PermissionVariableManage, resourceGlobal},
+
+	// 项目
+	{"POST", "/projects/:id", constants.PermissionProjectManage, resourceProject},
+	{"DELETE", "/projects/:id", constants.PermissionProjectManage, resourceProject},
+	{"GET", "/projects/:id/members", constants.PermissionSpiderView, resourceProject},
+	{"PUT", "/projects/:id/members", constants.PermissionProjectManage, resourceProject},
+	{"DELETE", "/projects/:id/members/:user_id", constants.PermissionProjectManage, resourceProject},
+
+	// 用户
+	{"PUT", "/users-add", constants.PermissionUserManage, resourceAdmin},
+	{"POST", "/users/:id", constants.PermissionUserManage, resourceAdmin},
+	{"DELETE", "/users/:id", constants.PermissionUserManage, resourceAdmin},
+}
+
+// 按路由规则校验用户权限，需放在 AuthorizationMiddleware 之后
+func PermissionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := services.GetCurrentUser(c)
+		token := services.GetCurrentToken(c)
+
+		// 管理员拥有所有权限（API Token 仍需校验权限范围）
+		if user.Role == constants.RoleAdmin && token == nil {
+			c.Next()
+			return
+		}
+
+		// 未设置权限范围的新版 API Token 没有任何权限
+		if token != nil && !token.Legacy && len(token.Scopes) == 0 {
+			abortForbidden(c, "permission denied: api token has no scopes")
+			return
+		}
+
+		rule, params, ok := matchPermissionRule(c.Request.Method, c.Request.URL.Path)
+		if !ok {
+			// API Token 只能进行读取操作和规则中列出的操作
+			if !services.TokenHasFullAccess(token) && c.Request.Method != http.MethodGet {
+				abortForbidden(c, "permission denied: api token cannot access this route")
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if !services.TokenHasPermission(token, rule.Permission) {
+			abortForbidden(c, "permission denied: api token scope does not include "+rule.Permission)
+			return
+		}
+
+		if !checkPermission(c, user, token, rule, params) {
+			abortForbidden(c, "permission denied: "+rule.Permission)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func abortForbidden(c *gin.Context, errStr string) {
+	c.AbortWithStatusJSON(http.StatusForbidden, routes.Response{
+		Status:  "ok",
+		Message: "forbidden",
+		Error:   errStr,
+	})
+}
+
+func matchPermissionRule(method string, path string) (permissionRule, map[string]string, bool) {
+	for _, rule := range permissionRules {
+		if rule.Method != method {
+			continue
+		}
+		if params, ok := matchPath(rule.Path, path); ok {
+			return rule, params, true
+		}
+	}
+	return permissionRule{}, nil, false
+}
+
+// 匹配路由路径，返回路径参数
+func matchPath(pattern string, path string) (map[string]string, bool) {
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(patternParts) != len(pathParts) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, p := range patternParts {
+		if strings.HasPrefix(p, ":") {
+			params[p[1:]] = pathParts[i]
+		} else if p != pathParts[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func checkPermission(c *gin.Context, user *model.User, token *model.Token, rule permissionRule, params map[string]string) bool {
+	switch rule.Resource {
+	case resourceGlobal:
+		// 限定了项目或爬虫的 API Token 不能进行全局操作
+		return services.HasGlobalPermission(user, rule.Permission) &&
+			services.TokenAllowsProject(token, bson.ObjectIdHex(constants.ObjectIdNull))
+	case resourceAdmin:
+		return user.Role == constants.RoleAdmin
+	case resourceUploadSpider:
+		// 上传同名爬虫会覆盖已有爬虫的代码，需要有该爬虫的编辑权限
+		spider := model.GetSpiderByName(getUploadSpiderName(c))
+		if spider.Name == "" {
+			return services.TokenAllowsProject(token, bson.ObjectIdHex(constants.ObjectIdNull))
+		}
+		return checkSpiderIds(user, token, []string{spider.Id.Hex()}, rule.Permission)
+	case resourceProject:
+		id := params["id"]
+		if !bson.IsObjectIdHex(id) {
+			return false
+		}
+		return services.HasProjectPermission(user, bson.ObjectIdHex(id), rule.Permission) &&
+			services.TokenAllowsProject(token, bson.ObjectIdHex(id))
+	case resourceSpider:
+		return checkSpiderIds(user, token, []string{params["id"]}, rule.Permission)
+	case resourceSchedule:
+		id := params["id"]
+		if !bson.IsObjectIdHex(id) {
+			return false
+		}
+		ok, err := services.CheckSchedulePermission(user, token, bson.ObjectIdHex(id), rule.Permission)
+		return err == nil && ok
+	case resourceTask:
+		ok, err := services.CheckTaskPermission(user, token, params["id"], rule.Permission)
+		return err == nil && ok
+	case resourceBodySpiderId:
+		var body struct {
+			SpiderId string `json:"spider_id"`
+		}
+		if err := peekJsonBody(c, &body); err != nil {
+			return false
+		}
+		return checkSpiderIds(user, token, []string{body.SpiderId}, rule.Permission)
+	case resourceBodySpiderIds:
+		var body struct {
+			SpiderIds []string `json:"spider_ids"`
+		}
+		if err := peekJsonBody(c, &body); err != nil {
+			return false
+		}
+		return checkSpiderIds(user, token, body.SpiderIds, rule.Permission)
+	case resourceBodyTaskParams:
+		var body struct {
+			TaskParams []struct {
+				SpiderId string `json:"spider_id"`
+			} `json:"task_params"`
+		}
+		if err := peekJsonBody(c, &body); err != nil {
+			return false
+		}
+		var ids []string
+		for _, p := range body.TaskParams {
+			ids = append(ids, p.SpiderId)
+		}
+		return checkSpiderIds(user, token, ids, rule.Permission)
+	case resourceBodyTaskIds:
+		var body struct {
+			Ids []string `json:"ids"`
+		}
+		if err := peekJsonBody(c, &body); err != nil {
+			return false
+		}
+		for _, id := range body.Ids {
+			if ok, err := services.CheckTaskPermission(user, token, id, rule.Permission); err != nil || !ok {
+				return false
+			}
+		}
+		return true
+	case resourceBodyProjectId:
+		var body struct {
+			ProjectId string `json:"project_id"`
+		}
+		if err := peekJsonBody(c, &body); err != nil {
+			return false
+		}
+		// 未分配项目的爬虫归创建者所有
+		if !bson.IsObjectIdHex(body.ProjectId) || utils.IsObjectIdNull(bson.ObjectIdHex(body.ProjectId)) {
+			return services.TokenAllowsProject(token, bson.ObjectIdHex(constants.ObjectIdNull))
+		}
+		return services.HasProjectPermission(user, bson.ObjectIdHex(body.ProjectId), rule.Permission) &&
+			services.TokenAllowsProject(token, bson.ObjectIdHex(body.ProjectId))
+	}
+	return false
+}
+
+func checkSpiderIds(user *model.User, token *model.Token, ids []string, permission string) bool {
+	for _, id := range ids {
+		if !bson.IsObjectIdHex(id) {
+			return false
+		}
+		if ok, err := checkSpiderPermission(user, token, bson.ObjectIdHex(id), permission); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// 上传爬虫的名称，与 routes.UploadSpider 一致：优先使用表单中的 name，否则使用文件名
+func getUploadSpiderName(c *gin.Context) string {
+	if name := c.PostForm("name"); name != "" {
+		return name
+	}
+	uploadFile, err := c.FormFile("file")
+	if err != nil {
+		return ""
+	}
+	idx := strings.LastIndex(uploadFile.Filename, "/")
+	return strings.Replace(uploadFile.Filename[idx+1:], ".zip", "", 1)
+}
+
+// 读取请求体后重新写回，以便后续处理函数再次读取
+func peekJsonBody(c *gin.Context, v interface{}) error {
+	data, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return json.Unmarshal(data, v)
+}
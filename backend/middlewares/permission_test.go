@@ -0,0 +1,83 @@
+package middlewares
+
+import (
+	"crawlab/constants"
+	"crawlab/model"
+	"crawlab/services"
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMatchPermissionRule(t *testing.T) {
+	Convey("Test matchPermissionRule", t, func() {
+		rule, params, ok := matchPermissionRule("POST", "/spiders/5e7f1a/file/rename")
+		So(ok, ShouldBeTrue)
+		So(rule.Permission, ShouldEqual, constants.PermissionSpiderEdit)
+		So(params["id"], ShouldEqual, "5e7f1a")
+
+		rule, params, ok = matchPermissionRule("DELETE", "/projects/abc/members/def")
+		So(ok, ShouldBeTrue)
+		So(rule.Permission, ShouldEqual, constants.PermissionProjectManage)
+		So(params["user_id"], ShouldEqual, "def")
+
+		rule, _, ok = matchPermissionRule("GET", "/projects/abc/members")
+		So(ok, ShouldBeTrue)
+		So(rule.Resource, ShouldEqual, resourceProject)
+
+		// 创建项目只需要登录
+		_, _, ok = matchPermissionRule("PUT", "/projects")
+		So(ok, ShouldBeFalse)
+
+		rule, _, ok = matchPermissionRule("POST", "/spiders")
+		So(ok, ShouldBeTrue)
+		So(rule.Resource, ShouldEqual, resourceUploadSpider)
+
+		rule, _, ok = matchPermissionRule("DELETE", "/nodes/abc")
+		So(ok, ShouldBeTrue)
+		So(rule.Permission, ShouldEqual, constants.PermissionNodeManage)
+
+		// 读取操作不需要校验
+		_, _, ok = matchPermissionRule("GET", "/spiders/5e7f1a")
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestPermissionMiddlewareGitCheckout(t *testing.T) {
+	Convey("Test PermissionMiddleware on git checkout", t, func() {
+		gin.SetMode(gin.TestMode)
+
+		// 以项目角色代替数据库中的项目成员
+		role := constants.ProjectRoleViewer
+		checkSpiderPermission = func(user *model.User, token *model.Token, spiderId bson.ObjectId, permission string) (bool, error) {
+			return services.ProjectRoleHasPermission(role, permission), nil
+		}
+		defer func() {
+			checkSpiderPermission = services.CheckSpiderPermission
+		}()
+
+		app := gin.New()
+		app.Use(func(c *gin.Context) {
+			c.Set(constants.ContextUser, &model.User{Id: bson.NewObjectId(), Role: constants.RoleNormal})
+		})
+		app.Use(PermissionMiddleware())
+		app.POST("/git/checkout", func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		checkout := func() int {
+			body := `{"spider_id":"` + bson.NewObjectId().Hex() + `","hash":"abc"}`
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest("POST", "/git/checkout", strings.NewReader(body)))
+			return w.Code
+		}
+
+		So(checkout(), ShouldEqual, http.StatusForbidden)
+
+		role = constants.ProjectRoleDeveloper
+		So(checkout(), ShouldEqual, http.StatusOK)
+	})
+}
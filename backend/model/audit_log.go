@@ -0,0 +1,108 @@
+package model
+
+import (
+	"crawlab/database"
+	"github.com/apex/log"
+	"github.com/globalsign/mgo/bson"
+	"runtime/debug"
+	"time"
+)
+
+// 审计日志
+type AuditLog struct {
+	Id           bson.ObjectId    `json:"_id" bson:"_id"`
+	UserId       bson.ObjectId    `json:"user_id" bson:"user_id,omitempty"`
+	Username     string           `json:"username" bson:"username"`
+	Action       string           `json:"action" bson:"action"`               // 操作类型
+	ResourceType string           `json:"resource_type" bson:"resource_type"` // 资源类型
+	ResourceId   string           `json:"resource_id" bson:"resource_id"`     // 资源ID
+	Method       string           `json:"method" bson:"method"`
+	Path         string           `json:"path" bson:"path"`
+	Ip           string           `json:"ip" bson:"ip"`
+	StatusCode   int              `json:"status_code" bson:"status_code"`
+	Changes      []AuditLogChange `json:"changes" bson:"changes"` // 字段变更
+	Detail       string           `json:"detail" bson:"detail"`   // 请求参数（已脱敏）
+
+	CreateTs time.Time `json:"create_ts" bson:"create_ts"`
+	ExpireTs time.Time `json:"expire_ts" bson:"expire_ts,omitempty"` // 过期时间，为空时永久保留
+}
+
+// 字段变更
+type AuditLogChange struct {
+	Field  string      `json:"field" bson:"field"`
+	Before interface{} `json:"before" bson:"before"`
+	After  interface{} `json:"after" bson:"after"`
+}
+
+// 审计资源，由各模型注册，用于获取变更前后的数据
+type AuditResource struct {
+	Type         string   // 资源类型
+	Col          string   // 集合名称
+	MaskedFields []string // 脱敏字段，只记录是否变更
+}
+
+var auditResources = map[string]AuditResource{}
+
+func RegisterAuditResource(r AuditResource) {
+	auditResources[r.Type] = r
+}
+
+func GetAuditResource(resourceType string) (AuditResource, bool) {
+	r, ok := auditResources[resourceType]
+	return r, ok
+}
+
+// 获取资源当前的数据快照，不存在时返回 nil
+func GetAuditSnapshot(resourceType string, id string) bson.M {
+	r, ok := GetAuditResource(resourceType)
+	if !ok || id == "" {
+		return nil
+	}
+
+	s, c := database.GetCol(r.Col)
+	defer s.Close()
+
+	var query interface{} = id
+	if bson.IsObjectIdHex(id) {
+		query = bson.ObjectIdHex(id)
+	}
+
+	var doc bson.M
+	if err := c.FindId(query).One(&doc); err != nil {
+		return nil
+	}
+	return doc
+}
+
+func (l *AuditLog) Add() error {
+	s, c := database.GetCol("audit_logs")
+	defer s.Close()
+
+	l.Id = bson.NewObjectId()
+	l.CreateTs = time.Now()
+	if err := c.Insert(l); err != nil {
+		log.Errorf("add audit log error: %s", err.Error())
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
+func GetAuditLogList(filter interface{}, skip int, limit int, sortKey string) ([]AuditLog, error) {
+	s, c := database.GetCol("audit_logs")
+	defer s.Close()
+
+	var logs []AuditLog
+	if err := c.Find(filter).Skip(skip).Limit(limit).Sort(sortKey).All(&logs); err != nil {
+		debug.PrintStack()
+		return logs, err
+	}
+	return logs, nil
+}
+
+func GetAuditLogListTotal(filter interface{}) (int, error) {
+	s, c := database.GetCol("audit_logs")
+	defer s.Close()
+
+	return c.Find(filter).Count()
+}
@@ -0,0 +1,126 @@
+package model
+
+import (
+	"crawlab/constants"
+	"crawlab/database"
+	"github.com/apex/log"
+	"github.com/globalsign/mgo/bson"
+	"runtime/debug"
+	"time"
+)
+
+// 依赖安装任务，可同时在多个节点上安装
+type DepJob struct {
+	Id       bson.ObjectId `json:"_id" bson:"_id"`
+	Type     string        `json:"type" bson:"type"`         // install_dep / uninstall_dep / install_lang
+	Lang     string        `json:"lang" bson:"lang"`         // 语言
+	DepName  string        `json:"dep_name" bson:"dep_name"` // 依赖名称，可包含版本，例如 requests==2.23.0
+	Status   string        `json:"status" bson:"status"`
+	Nodes    []DepJobNode  `json:"nodes" bson:"nodes"` // 各节点的执行结果
+	UserId   bson.ObjectId `json:"user_id" bson:"user_id,omitempty"`
+	Username string        `json:"username" bson:"username"`
+	CreateTs time.Time     `json:"create_ts" bson:"create_ts"`
+	FinishTs time.Time     `json:"finish_ts" bson:"finish_ts"`
+	Duration float64       `json:"duration" bson:"duration"` // 总时长（秒）
+}
+
+// 依赖安装任务在单个节点上的执行结果
+type DepJobNode struct {
+	NodeId   bson.ObjectId `json:"node_id" bson:"node_id"`
+	NodeName string        `json:"node_name" bson:"node_name"`
+	Status   string        `json:"status" bson:"status"`
+	Stdout   string        `json:"stdout" bson:"stdout"`
+	Stderr   string        `json:"stderr" bson:"stderr"`
+	Error    string        `json:"error" bson:"error"`
+	StartTs  time.Time     `json:"start_ts" bson:"start_ts"`
+	FinishTs time.Time     `json:"finish_ts" bson:"finish_ts"`
+	Duration float64       `json:"duration" bson:"duration"` // 执行时长（秒）
+}
+
+func (j *DepJob) Add() error {
+	s, c := database.GetCol("dep_jobs")
+	defer s.Close()
+
+	j.Id = bson.NewObjectId()
+	j.CreateTs = time.Now()
+	if err := c.Insert(j); err != nil {
+		log.Errorf("add dep job error: %s", err.Error())
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
+// 更新任务在某个节点上的执行结果
+func UpdateDepJobNode(id bson.ObjectId, node DepJobNode) error {
+	s, c := database.GetCol("dep_jobs")
+	defer s.Close()
+
+	if err := c.Update(bson.M{"_id": id, "nodes.node_id": node.NodeId}, bson.M{"$set": bson.M{"nodes.$": node}}); err != nil {
+		log.Errorf("update dep job node error: %s", err.Error())
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
+// 所有节点执行完成后更新任务状态
+func FinishDepJob(id bson.ObjectId) (DepJob, error) {
+	job, err := GetDepJob(id)
+	if err != nil {
+		return job, err
+	}
+
+	job.Status = constants.DepJobStatusFinished
+	for _, n := range job.Nodes {
+		if n.Status == constants.DepJobStatusError {
+			job.Status = constants.DepJobStatusError
+		}
+	}
+	job.FinishTs = time.Now()
+	job.Duration = job.FinishTs.Sub(job.CreateTs).Seconds()
+
+	s, c := database.GetCol("dep_jobs")
+	defer s.Close()
+
+	if err := c.UpdateId(id, bson.M{"$set": bson.M{
+		"status":    job.Status,
+		"finish_ts": job.FinishTs,
+		"duration":  job.Duration,
+	}}); err != nil {
+		log.Errorf("finish dep job error: %s", err.Error())
+		debug.PrintStack()
+		return job, err
+	}
+	return job, nil
+}
+
+func GetDepJob(id bson.ObjectId) (DepJob, error) {
+	s, c := database.GetCol("dep_jobs")
+	defer s.Close()
+
+	var job DepJob
+	if err := c.FindId(id).One(&job); err != nil {
+		return job, err
+	}
+	return job, nil
+}
+
+func GetDepJobList(filter interface{}, skip int, limit int, sortKey string) ([]DepJob, error) {
+	s, c := database.GetCol("dep_jobs")
+	defer s.Close()
+
+	list := []DepJob{}
+	if err := c.Find(filter).Skip(skip).Limit(limit).Sort(sortKey).All(&list); err != nil {
+		debug.PrintStack()
+		return list, err
+	}
+	return list, nil
+}
+
+func GetDepJobListTotal(filter interface{}) (int, error) {
+	s, c := database.GetCol("dep_jobs")
+	defer s.Close()
+
+	return c.Find(filter).Count()
+}
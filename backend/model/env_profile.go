@@ -0,0 +1,160 @@
+package model
+
+import (
+	"crawlab/constants"
+	"crawlab/database"
+	"github.com/apex/log"
+	"github.com/globalsign/mgo/bson"
+	"runtime/debug"
+	"time"
+)
+
+func init() {
+	RegisterAuditResource(AuditResource{Type: constants.AuditResourceEnvProfile, Col: "env_profiles"})
+}
+
+// 环境配置中固定版本的依赖
+type EnvPackage struct {
+	Lang    string `json:"lang" bson:"lang"`       // 语言: python / node
+	Name    string `json:"name" bson:"name"`       // 依赖名称
+	Version string `json:"version" bson:"version"` // 固定版本，为空表示任意版本
+}
+
+// 安装命令使用的依赖名称（包含版本）
+func (p *EnvPackage) GetDepName() string {
+	if p.Version == "" {
+		return p.Name
+	}
+	if p.Lang == constants.Nodejs {
+		return p.Name + "@" + p.Version
+	}
+	return p.Name + "==" + p.Version
+}
+
+// 环境配置（语言 + 固定版本依赖），可分配给节点或节点标签
+type EnvProfile struct {
+	Id            bson.ObjectId   `json:"_id" bson:"_id"`
+	Name          string          `json:"name" bson:"name"`
+	Description   string          `json:"description" bson:"description"`
+	Langs         []string        `json:"langs" bson:"langs"`                   // 需要安装的语言
+	Packages      []EnvPackage    `json:"packages" bson:"packages"`             // 需要安装的依赖
+	NodeIds       []bson.ObjectId `json:"node_ids" bson:"node_ids"`             // 分配的节点
+	NodeTags      []string        `json:"node_tags" bson:"node_tags"`           // 分配的节点标签
+	AutoReconcile bool            `json:"auto_reconcile" bson:"auto_reconcile"` // 是否自动修复偏差
+
+	// 前端展示
+	Username string `json:"username" bson:"-"`
+
+	UserId   bson.ObjectId `json:"user_id" bson:"user_id"`
+	CreateTs time.Time     `json:"create_ts" bson:"create_ts"`
+	UpdateTs time.Time     `json:"update_ts" bson:"update_ts"`
+}
+
+func (p *EnvProfile) Save() error {
+	s, c := database.GetCol("env_profiles")
+	defer s.Close()
+
+	p.UpdateTs = time.Now()
+
+	if err := c.UpdateId(p.Id, p); err != nil {
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
+func (p *EnvProfile) Add() error {
+	s, c := database.GetCol("env_profiles")
+	defer s.Close()
+
+	p.Id = bson.NewObjectId()
+	p.UpdateTs = time.Now()
+	p.CreateTs = time.Now()
+	if err := c.Insert(p); err != nil {
+		log.Errorf(err.Error())
+		debug.PrintStack()
+		return err
+	}
+
+	return nil
+}
+
+func GetEnvProfile(id bson.ObjectId) (EnvProfile, error) {
+	s, c := database.GetCol("env_profiles")
+	defer s.Close()
+
+	var p EnvProfile
+	if err := c.FindId(id).One(&p); err != nil {
+		return p, err
+	}
+
+	// 获取用户名称
+	user, _ := GetUser(p.UserId)
+	p.Username = user.Username
+
+	return p, nil
+}
+
+func GetEnvProfileList(filter interface{}, skip int, limit int, sortKey string) ([]EnvProfile, error) {
+	s, c := database.GetCol("env_profiles")
+	defer s.Close()
+
+	var profiles []EnvProfile
+	if err := c.Find(filter).Skip(skip).Limit(limit).Sort(sortKey).All(&profiles); err != nil {
+		debug.PrintStack()
+		return profiles, err
+	}
+
+	for i, p := range profiles {
+		// 获取用户名称
+		user, _ := GetUser(p.UserId)
+		profiles[i].Username = user.Username
+	}
+	return profiles, nil
+}
+
+func GetEnvProfileListTotal(filter interface{}) (int, error) {
+	s, c := database.GetCol("env_profiles")
+	defer s.Close()
+
+	return c.Find(filter).Count()
+}
+
+func UpdateEnvProfile(id bson.ObjectId, item EnvProfile) error {
+	s, c := database.GetCol("env_profiles")
+	defer s.Close()
+
+	var result EnvProfile
+	if err := c.FindId(id).One(&result); err != nil {
+		debug.PrintStack()
+		return err
+	}
+
+	item.Id = id
+	item.UserId = result.UserId
+	item.CreateTs = result.CreateTs
+	if err := item.Save(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func RemoveEnvProfile(id bson.ObjectId) error {
+	s, c := database.GetCol("env_profiles")
+	defer s.Close()
+
+	if err := c.RemoveId(id); err != nil {
+		return err
+	}
+
+	// 解除爬虫对该环境配置的引用
+	sp, sc := database.GetCol("spiders")
+	defer sp.Close()
+	if _, err := sc.UpdateAll(bson.M{"env_profile_id": id}, bson.M{"$unset": bson.M{"env_profile_id": ""}}); err != nil {
+		log.Errorf(err.Error())
+		debug.PrintStack()
+		return err
+	}
+
+	return nil
+}
@@ -16,6 +16,8 @@ type LogItem struct {
 	Message  string        `json:"msg" bson:"msg"`
 	TaskId   string        `json:"task_id" bson:"task_id"`
 	Seq      int64         `json:"seq" bson:"seq"`
+	Stream   string        `json:"stream" bson:"stream"` // 输出流 stdout/stderr
+	Level    string        `json:"level" bson:"level"`   // 日志级别
 	Ts       time.Time     `json:"ts" bson:"ts"`
 	ExpireTs time.Time     `json:"expire_ts" bson:"expire_ts"`
 }
@@ -110,14 +112,37 @@ func AddErrorLogItem(e ErrorLogItem) error {
 	return nil
 }
 
+// 批量添加错误日志
+func AddErrorLogItems(es []ErrorLogItem) error {
+	if len(es) == 0 {
+		return nil
+	}
+	s, c := database.GetCol("error_logs")
+	defer s.Close()
+	var docs []interface{}
+	for _, e := range es {
+		docs = append(docs, e)
+	}
+	if err := c.Insert(docs...); err != nil {
+		log.Errorf("insert error log error: " + err.Error())
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
 func GetLogItemList(query bson.M, keyword string, skip int, limit int, sortStr string) ([]LogItem, error) {
 	s, c := database.GetCol("logs")
 	defer s.Close()
 
 	filter := query
 
+	// 按级别或输出流筛选时序号不连续，不能按序号分页
+	_, hasLevel := filter["level"]
+	_, hasStream := filter["stream"]
+
 	var logItems []LogItem
-	if keyword == "" {
+	if keyword == "" && !hasLevel && !hasStream {
 		filter["seq"] = bson.M{
 			"$gte": skip,
 			"$lt":  skip + limit,
@@ -127,11 +152,13 @@ func GetLogItemList(query bson.M, keyword string, skip int, limit int, sortStr s
 			return logItems, err
 		}
 	} else {
-		filter["msg"] = bson.M{
-			"$regex": bson.RegEx{
-				Pattern: keyword,
-				Options: "i",
-			},
+		if keyword != "" {
+			filter["msg"] = bson.M{
+				"$regex": bson.RegEx{
+					Pattern: keyword,
+					Options: "i",
+				},
+			}
 		}
 		if err := c.Find(filter).Sort(sortStr).Skip(skip).Limit(limit).All(&logItems); err != nil {
 			debug.PrintStack()
@@ -165,3 +192,20 @@ func GetLogItemTotal(query bson.M, keyword string) (int, error) {
 
 	return total, nil
 }
+
+// 获取序号大于 seq 的日志，按序号排序
+func GetLogItemListAfterSeq(taskId string, seq int64, limit int) ([]LogItem, error) {
+	s, c := database.GetCol("logs")
+	defer s.Close()
+
+	var logItems []LogItem
+	query := bson.M{
+		"task_id": taskId,
+		"seq":     bson.M{"$gt": seq},
+	}
+	if err := c.Find(query).Sort("seq").Limit(limit).All(&logItems); err != nil {
+		debug.PrintStack()
+		return logItems, err
+	}
+	return logItems, nil
+}
@@ -13,15 +13,22 @@ import (
 	"time"
 )
 
+func init() {
+	RegisterAuditResource(AuditResource{Type: constants.AuditResourceNode, Col: "nodes"})
+}
+
 type Node struct {
-	Id          bson.ObjectId `json:"_id" bson:"_id"`
-	Name        string        `json:"name" bson:"name"`
-	Status      string        `json:"status" bson:"status"`
-	Ip          string        `json:"ip" bson:"ip"`
-	Port        string        `json:"port" bson:"port"`
-	Mac         string        `json:"mac" bson:"mac"`
-	Hostname    string        `json:"hostname" bson:"hostname"`
-	Description string        `json:"description" bson:"description"`
+	Id          bson.ObjectId     `json:"_id" bson:"_id"`
+	Name        string            `json:"name" bson:"name"`
+	Status      string            `json:"status" bson:"status"`
+	Ip          string            `json:"ip" bson:"ip"`
+	Port        string            `json:"port" bson:"port"`
+	Mac         string            `json:"mac" bson:"mac"`
+	Hostname    string            `json:"hostname" bson:"hostname"`
+	Description string            `json:"description" bson:"description"`
+	Workers     int               `json:"workers" bson:"workers"` // 任务工作协程数，0表示使用配置文件
+	Tags        []string          `json:"tags" bson:"tags"`       // 节点标签，用于分配环境配置
+	Labels      map[string]string `json:"labels" bson:"labels"`   // 节点键值标签，用于按标签选择器分配任务
 	// 用于唯一标识节点，可能是mac地址，可能是ip地址
 	Key string `json:"key" bson:"key"`
 
@@ -42,6 +49,18 @@ func IsMaster() bool {
 	return viper.GetString("server.master") == Yes
 }
 
+// 获取主节点
+func GetMasterNode() (Node, error) {
+	s, c := database.GetCol("nodes")
+	defer s.Close()
+
+	var node Node
+	if err := c.Find(bson.M{"ismaster": true}).One(&node); err != nil {
+		return node, err
+	}
+	return node, nil
+}
+
 // 获取本机节点
 // TODO: 这里职责不单一，需要重构
 func GetCurrentNode() (Node, error) {
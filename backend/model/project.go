@@ -9,6 +9,10 @@ import (
 	"time"
 )
 
+func init() {
+	RegisterAuditResource(AuditResource{Type: constants.AuditResourceProject, Col: "projects"})
+}
+
 type Project struct {
 	Id          bson.ObjectId `json:"_id" bson:"_id"`
 	Name        string        `json:"name" bson:"name"`
@@ -0,0 +1,128 @@
+package model
+
+import (
+	"crawlab/database"
+	"github.com/apex/log"
+	"github.com/globalsign/mgo/bson"
+	"runtime/debug"
+	"time"
+)
+
+// 项目成员（用户在项目中的角色）
+type ProjectMember struct {
+	Id        bson.ObjectId `json:"_id" bson:"_id"`
+	ProjectId bson.ObjectId `json:"project_id" bson:"project_id"`
+	UserId    bson.ObjectId `json:"user_id" bson:"user_id"`
+	Role      string        `json:"role" bson:"role"`
+
+	// 前端展示
+	Username string `json:"username" bson:"-"`
+
+	CreateTs time.Time `json:"create_ts" bson:"create_ts"`
+	UpdateTs time.Time `json:"update_ts" bson:"update_ts"`
+}
+
+func GetProjectMember(projectId bson.ObjectId, userId bson.ObjectId) (ProjectMember, error) {
+	s, c := database.GetCol("project_members")
+	defer s.Close()
+
+	var m ProjectMember
+	if err := c.Find(bson.M{"project_id": projectId, "user_id": userId}).One(&m); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+func GetProjectMemberList(projectId bson.ObjectId) ([]ProjectMember, error) {
+	s, c := database.GetCol("project_members")
+	defer s.Close()
+
+	var members []ProjectMember
+	if err := c.Find(bson.M{"project_id": projectId}).Sort("+_id").All(&members); err != nil {
+		debug.PrintStack()
+		return members, err
+	}
+
+	for i, m := range members {
+		// 获取用户名称
+		user, _ := GetUser(m.UserId)
+		members[i].Username = user.Username
+	}
+	return members, nil
+}
+
+// 获取用户所在的所有项目成员记录
+func GetUserProjectMemberList(userId bson.ObjectId) ([]ProjectMember, error) {
+	s, c := database.GetCol("project_members")
+	defer s.Close()
+
+	var members []ProjectMember
+	if err := c.Find(bson.M{"user_id": userId}).All(&members); err != nil {
+		debug.PrintStack()
+		return members, err
+	}
+	return members, nil
+}
+
+// 设置项目成员角色，不存在时新增
+func SetProjectMember(projectId bson.ObjectId, userId bson.ObjectId, role string) error {
+	s, c := database.GetCol("project_members")
+	defer s.Close()
+
+	var m ProjectMember
+	if err := c.Find(bson.M{"project_id": projectId, "user_id": userId}).One(&m); err == nil {
+		if err := c.UpdateId(m.Id, bson.M{"$set": bson.M{"role": role, "update_ts": time.Now()}}); err != nil {
+			log.Errorf("update project member error: %s", err.Error())
+			debug.PrintStack()
+			return err
+		}
+		return nil
+	}
+
+	m = ProjectMember{
+		Id:        bson.NewObjectId(),
+		ProjectId: projectId,
+		UserId:    userId,
+		Role:      role,
+		CreateTs:  time.Now(),
+		UpdateTs:  time.Now(),
+	}
+	if err := c.Insert(m); err != nil {
+		log.Errorf("add project member error: %s", err.Error())
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
+func RemoveProjectMember(projectId bson.ObjectId, userId bson.ObjectId) error {
+	s, c := database.GetCol("project_members")
+	defer s.Close()
+
+	if err := c.Remove(bson.M{"project_id": projectId, "user_id": userId}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 删除项目的所有成员
+func RemoveProjectMembers(projectId bson.ObjectId) error {
+	s, c := database.GetCol("project_members")
+	defer s.Close()
+
+	if _, err := c.RemoveAll(bson.M{"project_id": projectId}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 删除用户的所有项目角色
+func RemoveUserProjectMembers(userId bson.ObjectId) error {
+	s, c := database.GetCol("project_members")
+	defer s.Close()
+
+	if _, err := c.RemoveAll(bson.M{"user_id": userId}); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"crawlab/database"
+	"github.com/apex/log"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"runtime/debug"
+	"time"
+)
+
+// 已签发的刷新 token，删除后刷新 token 立即失效
+type RefreshToken struct {
+	Id       string        `json:"_id" bson:"_id"` // JWT 中的 jti
+	UserId   bson.ObjectId `json:"user_id" bson:"user_id"`
+	ExpireTs time.Time     `json:"expire_ts" bson:"expire_ts"`
+	CreateTs time.Time     `json:"create_ts" bson:"create_ts"`
+}
+
+func (t *RefreshToken) Add() error {
+	s, c := database.GetCol("refresh_tokens")
+	defer s.Close()
+
+	t.CreateTs = time.Now()
+	if err := c.Insert(t); err != nil {
+		log.Errorf("insert refresh token error: " + err.Error())
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
+func GetRefreshToken(id string) (t RefreshToken, err error) {
+	s, c := database.GetCol("refresh_tokens")
+	defer s.Close()
+
+	if err = c.FindId(id).One(&t); err != nil {
+		return t, err
+	}
+	return t, nil
+}
+
+func RemoveRefreshToken(id string) error {
+	s, c := database.GetCol("refresh_tokens")
+	defer s.Close()
+
+	if err := c.RemoveId(id); err != nil && err != mgo.ErrNotFound {
+		log.Errorf("remove refresh token error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// 删除用户的所有刷新 token（登出所有设备、修改密码时）
+func RemoveUserRefreshTokens(userId bson.ObjectId) error {
+	s, c := database.GetCol("refresh_tokens")
+	defer s.Close()
+
+	if _, err := c.RemoveAll(bson.M{"user_id": userId}); err != nil {
+		log.Errorf("remove user refresh tokens error: " + err.Error())
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
+// 过期的刷新 token 由 MongoDB 自动删除
+func InitRefreshTokenIndexes() error {
+	s, c := database.GetCol("refresh_tokens")
+	defer s.Close()
+
+	if err := c.EnsureIndex(mgo.Index{
+		Key:         []string{"expire_ts"},
+		ExpireAfter: time.Second,
+	}); err != nil {
+		log.Errorf("ensure refresh token index error: %s", err.Error())
+		return err
+	}
+	_ = c.EnsureIndex(mgo.Index{
+		Key: []string{"user_id"},
+	})
+	return nil
+}
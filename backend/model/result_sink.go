@@ -0,0 +1,189 @@
+package model
+
+import (
+	"crawlab/constants"
+	"crawlab/database"
+	"crawlab/utils"
+	"github.com/apex/log"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"runtime/debug"
+	"time"
+)
+
+// 爬虫结果投递目标，任务结束后将结果投递到外部存储
+type ResultSink struct {
+	Id        bson.ObjectId `json:"_id" bson:"_id"`
+	Type      string        `json:"type" bson:"type"` // postgres / mysql / kafka / s3
+	Enabled   bool          `json:"enabled" bson:"enabled"`
+	BatchSize int           `json:"batch_size" bson:"batch_size"` // 每批投递的条数
+
+	// Postgres / MySQL
+	Dsn   string `json:"dsn" bson:"dsn"`     // 连接串（加密存储）
+	Table string `json:"table" bson:"table"` // 目标表，只写入表中已有的字段
+
+	// Kafka
+	Brokers []string `json:"brokers" bson:"brokers"`
+	Topic   string   `json:"topic" bson:"topic"`
+
+	// S3 兼容存储，每批结果写入一个 JSON Lines 文件
+	Endpoint  string `json:"endpoint" bson:"endpoint"` // 例如 https://s3.amazonaws.com
+	Region    string `json:"region" bson:"region"`
+	Bucket    string `json:"bucket" bson:"bucket"`
+	Prefix    string `json:"prefix" bson:"prefix"`
+	AccessKey string `json:"access_key" bson:"access_key"`
+	SecretKey string `json:"secret_key" bson:"secret_key"` // 加密存储
+
+	// 提交时保留原连接串、密钥，脱敏返回的配置为 true
+	DsnUnchanged       bool `json:"dsn_unchanged" bson:"-"`
+	SecretKeyUnchanged bool `json:"secret_key_unchanged" bson:"-"`
+}
+
+// 加密敏感字段
+func (s *ResultSink) encryptSecrets() (err error) {
+	if s.Dsn, err = utils.EncryptSecret(s.Dsn); err != nil {
+		return err
+	}
+	if s.SecretKey, err = utils.EncryptSecret(s.SecretKey); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 返回解密后的配置
+func (s ResultSink) Decrypted() (ResultSink, error) {
+	var err error
+	if s.Dsn, err = utils.DecryptSecret(s.Dsn); err != nil {
+		return s, err
+	}
+	if s.SecretKey, err = utils.DecryptSecret(s.SecretKey); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// 返回脱敏后的配置
+func (s ResultSink) Masked() ResultSink {
+	if s.Dsn != "" {
+		s.Dsn = utils.SecretMask
+		s.DsnUnchanged = true
+	}
+	if s.SecretKey != "" {
+		s.SecretKey = utils.SecretMask
+		s.SecretKeyUnchanged = true
+	}
+	return s
+}
+
+func (s ResultSink) GetBatchSize() int {
+	if s.BatchSize <= 0 {
+		return constants.ResultSinkBatchSizeDefault
+	}
+	return s.BatchSize
+}
+
+// 结果投递记录，每个任务的每个投递目标一条
+type ResultDelivery struct {
+	Id          bson.ObjectId `json:"_id" bson:"_id"`
+	TaskId      string        `json:"task_id" bson:"task_id"`
+	SpiderId    bson.ObjectId `json:"spider_id" bson:"spider_id"`
+	SinkId      bson.ObjectId `json:"sink_id" bson:"sink_id"`
+	SinkType    string        `json:"sink_type" bson:"sink_type"`
+	Status      string        `json:"status" bson:"status"`
+	Delivered   int           `json:"delivered" bson:"delivered"`         // 已投递条数
+	Batches     int           `json:"batches" bson:"batches"`             // 已投递批数
+	LastId      interface{}   `json:"last_id" bson:"last_id,omitempty"`   // 最后一条已投递结果的ID，重试时从这里继续
+	Attempts    int           `json:"attempts" bson:"attempts"`           // 投递次数
+	Error       string        `json:"error" bson:"error"`                 // 最近一次错误
+	NextRetryTs time.Time     `json:"next_retry_ts" bson:"next_retry_ts"` // 下次重试时间
+	CreateTs    time.Time     `json:"create_ts" bson:"create_ts"`
+	UpdateTs    time.Time     `json:"update_ts" bson:"update_ts"`
+}
+
+func (d *ResultDelivery) Add() error {
+	s, c := database.GetCol("result_deliveries")
+	defer s.Close()
+
+	d.Id = bson.NewObjectId()
+	d.CreateTs = time.Now()
+	d.UpdateTs = time.Now()
+	if err := c.Insert(d); err != nil {
+		// 同一任务同一目标已有投递记录
+		if mgo.IsDup(err) {
+			return err
+		}
+		log.Errorf("add result delivery error: %s", err.Error())
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
+func (d *ResultDelivery) Save() error {
+	s, c := database.GetCol("result_deliveries")
+	defer s.Close()
+
+	d.UpdateTs = time.Now()
+	if err := c.UpdateId(d.Id, d); err != nil {
+		log.Errorf("update result delivery error: %s", err.Error())
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
+func GetResultDelivery(id bson.ObjectId) (ResultDelivery, error) {
+	s, c := database.GetCol("result_deliveries")
+	defer s.Close()
+
+	var d ResultDelivery
+	if err := c.FindId(id).One(&d); err != nil {
+		return d, err
+	}
+	return d, nil
+}
+
+func GetResultDeliveryList(filter interface{}) ([]ResultDelivery, error) {
+	s, c := database.GetCol("result_deliveries")
+	defer s.Close()
+
+	list := []ResultDelivery{}
+	if err := c.Find(filter).Sort("create_ts").All(&list); err != nil {
+		debug.PrintStack()
+		return list, err
+	}
+	return list, nil
+}
+
+// 待重试的投递记录：投递失败且到了重试时间，或投递中但长时间未更新（节点异常退出）
+func GetDueResultDeliveryList(maxAttempts int, staleTimeout time.Duration) ([]ResultDelivery, error) {
+	return GetResultDeliveryList(bson.M{
+		"attempts": bson.M{"$lt": maxAttempts},
+		"$or": []bson.M{
+			{"status": constants.DeliveryStatusError, "next_retry_ts": bson.M{"$lte": time.Now()}},
+			{"status": constants.DeliveryStatusRunning, "update_ts": bson.M{"$lt": time.Now().Add(-staleTimeout)}},
+		},
+	})
+}
+
+// 将投递记录标记为投递中，已被其他节点领取时返回 mgo.ErrNotFound
+func ClaimResultDelivery(id bson.ObjectId, staleTimeout time.Duration) (ResultDelivery, error) {
+	s, c := database.GetCol("result_deliveries")
+	defer s.Close()
+
+	var d ResultDelivery
+	_, err := c.Find(bson.M{
+		"_id": id,
+		"$or": []bson.M{
+			{"status": bson.M{"$in": []string{constants.DeliveryStatusPending, constants.DeliveryStatusError}}},
+			{"status": constants.DeliveryStatusRunning, "update_ts": bson.M{"$lt": time.Now().Add(-staleTimeout)}},
+		},
+	}).Apply(mgo.Change{
+		Update: bson.M{"$set": bson.M{
+			"status":    constants.DeliveryStatusRunning,
+			"update_ts": time.Now(),
+		}, "$inc": bson.M{"attempts": 1}},
+		ReturnNew: true,
+	}, &d)
+	return d, err
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"crawlab/constants"
+	"crawlab/utils"
+	"time"
+)
+
+// 任务重试策略
+type RetryPolicy struct {
+	MaxAttempts       int      `json:"max_attempts" bson:"max_attempts"`               // 最大执行次数（包含首次执行），小于等于1表示不重试
+	Backoff           string   `json:"backoff" bson:"backoff"`                         // 退避方式: fixed / exponential
+	BackoffSeconds    int      `json:"backoff_seconds" bson:"backoff_seconds"`         // 退避基础时长（秒）
+	MaxBackoffSeconds int      `json:"max_backoff_seconds" bson:"max_backoff_seconds"` // 退避最大时长（秒），0表示不限制
+	RetryOn           []string `json:"retry_on" bson:"retry_on"`                       // 可重试的结果: exit_code / timeout / abnormal
+	ExitCodes         []int    `json:"exit_codes" bson:"exit_codes"`                   // 可重试的退出码，为空表示所有非零退出码
+}
+
+// 是否启用重试
+func (p *RetryPolicy) IsEnabled() bool {
+	return p.MaxAttempts > 1
+}
+
+// 判断该结果是否可以重试
+func (p *RetryPolicy) IsRetryable(reason string, exitCode int) bool {
+	if !p.IsEnabled() {
+		return false
+	}
+	if !utils.StringArrayContains(p.RetryOn, reason) {
+		return false
+	}
+	if reason == constants.RetryOnExitCode && len(p.ExitCodes) > 0 {
+		for _, code := range p.ExitCodes {
+			if code == exitCode {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// 获取第attempt次执行失败后的退避时长
+func (p *RetryPolicy) GetBackoffDuration(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	seconds := p.BackoffSeconds
+	if p.Backoff == constants.RetryBackoffExponential {
+		for i := 1; i < attempt; i++ {
+			seconds *= 2
+			if p.MaxBackoffSeconds > 0 && seconds >= p.MaxBackoffSeconds {
+				break
+			}
+		}
+	}
+	if p.MaxBackoffSeconds > 0 && seconds > p.MaxBackoffSeconds {
+		seconds = p.MaxBackoffSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"crawlab/constants"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_IsRetryable(t *testing.T) {
+	Convey("Test RetryPolicy IsRetryable", t, func() {
+		p := RetryPolicy{
+			MaxAttempts: 3,
+			RetryOn:     []string{constants.RetryOnExitCode, constants.RetryOnAbnormal},
+		}
+		So(p.IsRetryable(constants.RetryOnExitCode, 1), ShouldBeTrue)
+		So(p.IsRetryable(constants.RetryOnAbnormal, 0), ShouldBeTrue)
+		So(p.IsRetryable(constants.RetryOnTimeout, 0), ShouldBeFalse)
+
+		p.ExitCodes = []int{2}
+		So(p.IsRetryable(constants.RetryOnExitCode, 1), ShouldBeFalse)
+		So(p.IsRetryable(constants.RetryOnExitCode, 2), ShouldBeTrue)
+
+		p.MaxAttempts = 1
+		So(p.IsRetryable(constants.RetryOnExitCode, 2), ShouldBeFalse)
+	})
+}
+
+func TestRetryPolicy_GetBackoffDuration(t *testing.T) {
+	Convey("Test RetryPolicy GetBackoffDuration", t, func() {
+		p := RetryPolicy{
+			Backoff:        constants.RetryBackoffFixed,
+			BackoffSeconds: 10,
+		}
+		So(p.GetBackoffDuration(1), ShouldEqual, 10*time.Second)
+		So(p.GetBackoffDuration(3), ShouldEqual, 10*time.Second)
+
+		p.Backoff = constants.RetryBackoffExponential
+		So(p.GetBackoffDuration(1), ShouldEqual, 10*time.Second)
+		So(p.GetBackoffDuration(3), ShouldEqual, 40*time.Second)
+
+		p.MaxBackoffSeconds = 30
+		So(p.GetBackoffDuration(3), ShouldEqual, 30*time.Second)
+		So(p.GetBackoffDuration(100), ShouldEqual, 30*time.Second)
+	})
+}
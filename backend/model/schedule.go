@@ -11,12 +11,24 @@ import (
 	"time"
 )
 
+func init() {
+	RegisterAuditResource(AuditResource{Type: constants.AuditResourceSchedule, Col: "schedules"})
+}
+
+// 定时任务跳过记录
+type ScheduleSkippedTick struct {
+	Ts      time.Time `json:"ts" bson:"ts"`             // 触发时间
+	Reason  string    `json:"reason" bson:"reason"`     // 跳过原因
+	TaskIds []string  `json:"task_ids" bson:"task_ids"` // 未结束的任务ID
+}
+
 type Schedule struct {
 	Id             bson.ObjectId   `json:"_id" bson:"_id"`
 	Name           string          `json:"name" bson:"name"`
 	Description    string          `json:"description" bson:"description"`
 	SpiderId       bson.ObjectId   `json:"spider_id" bson:"spider_id"`
 	Cron           string          `json:"cron" bson:"cron"`
+	Timezone       string          `json:"timezone" bson:"timezone"` // 时区，为空时使用服务器时区
 	EntryId        cron.EntryID    `json:"entry_id" bson:"entry_id"`
 	Param          string          `json:"param" bson:"param"`
 	RunType        string          `json:"run_type" bson:"run_type"`
@@ -26,12 +38,28 @@ type Schedule struct {
 	UserId         bson.ObjectId   `json:"user_id" bson:"user_id"`
 	ScrapySpider   string          `json:"scrapy_spider" bson:"scrapy_spider"`
 	ScrapyLogLevel string          `json:"scrapy_log_level" bson:"scrapy_log_level"`
+	RetryPolicy    RetryPolicy     `json:"retry_policy" bson:"retry_policy"`
+	Timeout        int             `json:"timeout" bson:"timeout"`               // 最大运行时长（秒），0表示使用爬虫设置
+	Priority       int             `json:"priority" bson:"priority"`             // 任务优先级（1-10），数值越大越优先
+	OverlapPolicy  string          `json:"overlap_policy" bson:"overlap_policy"` // 重叠策略: allow / skip / queue / replace
+	CatchUp        int             `json:"catch_up" bson:"catch_up"`             // 主节点停机期间错过的运行，重启后最多补跑的次数，0表示不补跑
+	LastFireTs     time.Time       `json:"last_fire_ts" bson:"last_fire_ts"`     // 上次触发时间
+	SpiderVersion  int             `json:"spider_version" bson:"spider_version"` // 指定的爬虫版本，0表示最新版本
+	LabelSelector  string          `json:"label_selector" bson:"label_selector"` // 节点标签选择器，随机和所有节点运行方式下生效
+
+	// 重叠策略状态
+	Queued       bool                  `json:"queued" bson:"queued"`               // 是否有排队等待的运行
+	QueuedTs     time.Time             `json:"queued_ts" bson:"queued_ts"`         // 排队时间
+	SkippedCount int                   `json:"skipped_count" bson:"skipped_count"` // 跳过次数
+	SkippedTicks []ScheduleSkippedTick `json:"skipped_ticks" bson:"skipped_ticks"` // 最近的跳过记录
 
 	// 前端展示
-	SpiderName string `json:"spider_name" bson:"spider_name"`
-	Username   string `json:"user_name" bson:"user_name"`
-	Nodes      []Node `json:"nodes" bson:"nodes"`
-	Message    string `json:"message" bson:"message"`
+	SpiderName    string      `json:"spider_name" bson:"spider_name"`
+	Username      string      `json:"user_name" bson:"user_name"`
+	Nodes         []Node      `json:"nodes" bson:"nodes"`
+	Message       string      `json:"message" bson:"message"`
+	NextRunTs     time.Time   `json:"next_run_ts" bson:"-"`      // 下次运行时间（定时任务所在时区）
+	NextRunTsList []time.Time `json:"next_run_ts_list" bson:"-"` // 接下来的运行时间
 
 	CreateTs time.Time `json:"create_ts" bson:"create_ts"`
 	UpdateTs time.Time `json:"update_ts" bson:"update_ts"`
@@ -118,6 +146,19 @@ func UpdateSchedule(id bson.ObjectId, item Schedule) error {
 		return err
 	}
 
+	// 保留重叠策略状态
+	item.Queued = result.Queued
+	item.QueuedTs = result.QueuedTs
+	item.SkippedCount = result.SkippedCount
+	item.SkippedTicks = result.SkippedTicks
+	item.LastFireTs = result.LastFireTs
+
+	// 修改了 cron 表达式、时区或重新启用后，从现在开始计算错过的触发，不补跑之前的时间段
+	if item.Cron != result.Cron || item.Timezone != result.Timezone ||
+		(result.Status == constants.ScheduleStatusStop && item.Status != constants.ScheduleStatusStop) {
+		item.LastFireTs = time.Now()
+	}
+
 	item.UpdateTs = time.Now()
 	if err := item.Save(); err != nil {
 		return err
@@ -168,3 +209,98 @@ func GetScheduleCount(filter interface{}) (int, error) {
 
 	return count, nil
 }
+
+// 记录定时任务跳过
+func AddScheduleSkippedTick(id bson.ObjectId, tick ScheduleSkippedTick) error {
+	s, c := database.GetCol("schedules")
+	defer s.Close()
+
+	update := bson.M{
+		"$inc": bson.M{"skipped_count": 1},
+		"$push": bson.M{
+			"skipped_ticks": bson.M{
+				"$each":  []ScheduleSkippedTick{tick},
+				"$slice": -constants.ScheduleSkippedTicksMax,
+			},
+		},
+	}
+	if err := c.UpdateId(id, update); err != nil {
+		log.Errorf("add schedule skipped tick error: %s", err.Error())
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
+// 将定时任务置为排队状态，已有排队时返回 false
+func SetScheduleQueued(id bson.ObjectId) (bool, error) {
+	s, c := database.GetCol("schedules")
+	defer s.Close()
+
+	selector := bson.M{
+		"_id":    id,
+		"queued": bson.M{"$ne": true},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"queued":    true,
+			"queued_ts": time.Now(),
+		},
+	}
+	if err := c.Update(selector, update); err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// 取出定时任务的排队，没有排队时返回 false
+func PopScheduleQueued(id bson.ObjectId) (bool, error) {
+	s, c := database.GetCol("schedules")
+	defer s.Close()
+
+	selector := bson.M{
+		"_id":    id,
+		"queued": true,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"queued": false,
+		},
+	}
+	if err := c.Update(selector, update); err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// 只更新定时任务的指定字段，避免覆盖排队、触发时间等并发更新的字段
+func UpdateScheduleFields(id bson.ObjectId, fields bson.M) error {
+	s, c := database.GetCol("schedules")
+	defer s.Close()
+
+	if err := c.UpdateId(id, bson.M{"$set": fields}); err != nil {
+		log.Errorf("update schedule fields error: %s", err.Error())
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
+// 更新定时任务上次触发时间
+func UpdateScheduleLastFireTs(id bson.ObjectId, ts time.Time) error {
+	s, c := database.GetCol("schedules")
+	defer s.Close()
+
+	if err := c.UpdateId(id, bson.M{"$set": bson.M{"last_fire_ts": ts}}); err != nil {
+		log.Errorf("update schedule last fire ts error: %s", err.Error())
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
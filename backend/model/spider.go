@@ -16,6 +16,10 @@ import (
 	"time"
 )
 
+func init() {
+	RegisterAuditResource(AuditResource{Type: constants.AuditResourceSpider, Col: "spiders", MaskedFields: []string{"git_password", "result_sinks"}})
+}
+
 type Env struct {
 	Name  string `json:"name" bson:"name"`
 	Value string `json:"value" bson:"value"`
@@ -27,6 +31,7 @@ type Spider struct {
 	DisplayName string        `json:"display_name" bson:"display_name"` // 爬虫显示名称
 	Type        string        `json:"type" bson:"type"`                 // 爬虫类别
 	FileId      bson.ObjectId `json:"file_id" bson:"file_id"`           // GridFS文件ID
+	Version     int           `json:"version" bson:"version"`           // 当前版本号
 	Col         string        `json:"col" bson:"col"`                   // 结果储存位置
 	Site        string        `json:"site" bson:"site"`                 // 爬虫网站
 	Envs        []Env         `json:"envs" bson:"envs"`                 // 环境变量
@@ -56,9 +61,18 @@ type Spider struct {
 	GitSyncFrequency string `json:"git_sync_frequency" bson:"git_sync_frequency"` // Git 同步频率
 	GitSyncError     string `json:"git_sync_error" bson:"git_sync_error"`         // Git 同步错误
 
+	// 提交时保留原 Git 密码，脱敏返回的爬虫为 true，修改密码时需置为 false
+	GitPasswordUnchanged bool `json:"git_password_unchanged" bson:"-"`
+
 	// 长任务
 	IsLongTask bool `json:"is_long_task" bson:"is_long_task"` // 是否为长任务
 
+	// 超时
+	Timeout int `json:"timeout" bson:"timeout"` // 最大运行时长（秒），0表示不限制
+
+	// 并发
+	MaxConcurrency int `json:"max_concurrency" bson:"max_concurrency"` // 集群内最大同时运行任务数，0表示不限制
+
 	// 去重
 	IsDedup     bool   `json:"is_dedup" bson:"is_dedup"`         // 是否去重
 	DedupField  string `json:"dedup_field" bson:"dedup_field"`   // 去重字段
@@ -68,6 +82,15 @@ type Spider struct {
 	IsWebHook  bool   `json:"is_web_hook" bson:"is_web_hook"`   // 是否开启 Web Hook
 	WebHookUrl string `json:"web_hook_url" bson:"web_hook_url"` // Web Hook URL
 
+	// 重试策略
+	RetryPolicy RetryPolicy `json:"retry_policy" bson:"retry_policy"` // 任务失败重试策略
+
+	// 环境配置
+	EnvProfileId bson.ObjectId `json:"env_profile_id" bson:"env_profile_id,omitempty"` // 运行前需要满足的环境配置
+
+	// 结果投递
+	ResultSinks []ResultSink `json:"result_sinks" bson:"result_sinks"` // 任务结束后投递结果的外部存储
+
 	// 前端展示
 	LastRunTs   time.Time               `json:"last_run_ts"`  // 最后一次执行时间
 	LastStatus  string                  `json:"last_status"`  // 最后执行状态
@@ -93,6 +116,14 @@ func (spider *Spider) Save() error {
 		spider.ProjectId = bson.ObjectIdHex(constants.ObjectIdNull)
 	}
 
+	if err := spider.encryptGitPassword(); err != nil {
+		return err
+	}
+
+	if err := spider.encryptResultSinks(); err != nil {
+		return err
+	}
+
 	if err := c.UpdateId(spider.Id, spider); err != nil {
 		log.Errorf(err.Error())
 		debug.PrintStack()
@@ -114,12 +145,90 @@ func (spider *Spider) Add() error {
 		spider.ProjectId = bson.ObjectIdHex(constants.ObjectIdNull)
 	}
 
+	if err := spider.encryptGitPassword(); err != nil {
+		return err
+	}
+
+	if err := spider.encryptResultSinks(); err != nil {
+		return err
+	}
+
 	if err := c.Insert(&spider); err != nil {
 		return err
 	}
 	return nil
 }
 
+// 加密 Git 密码
+func (spider *Spider) encryptGitPassword() error {
+	password, err := utils.EncryptSecret(spider.GitPassword)
+	if err != nil {
+		log.Errorf("encrypt git password error: %s", err.Error())
+		debug.PrintStack()
+		return err
+	}
+	spider.GitPassword = password
+	return nil
+}
+
+// 加密结果投递目标的敏感字段，并为新增的投递目标分配ID
+func (spider *Spider) encryptResultSinks() error {
+	for i := range spider.ResultSinks {
+		if !spider.ResultSinks[i].Id.Valid() {
+			spider.ResultSinks[i].Id = bson.NewObjectId()
+		}
+		if err := spider.ResultSinks[i].encryptSecrets(); err != nil {
+			log.Errorf("encrypt result sink error: %s", err.Error())
+			debug.PrintStack()
+			return err
+		}
+	}
+	return nil
+}
+
+// 加密旧版本明文存储的 Git 密码（已加密的密码不受影响，可重复执行）
+func MigrateSpiderGitPasswords() error {
+	s, c := database.GetCol("spiders")
+	defer s.Close()
+
+	var spiders []Spider
+	if err := c.Find(bson.M{"git_password": bson.M{"$nin": []string{""}}}).Select(bson.M{"git_password": 1}).All(&spiders); err != nil {
+		return err
+	}
+	for _, spider := range spiders {
+		if utils.IsEncryptedSecret(spider.GitPassword) {
+			continue
+		}
+		if err := spider.encryptGitPassword(); err != nil {
+			return err
+		}
+		if err := c.UpdateId(spider.Id, bson.M{"$set": bson.M{"git_password": spider.GitPassword}}); err != nil {
+			return err
+		}
+		log.Infof("encrypted git password of spider (id: %s)", spider.Id.Hex())
+	}
+	return nil
+}
+
+// 获取解密后的 Git 密码
+func (spider *Spider) GetGitPassword() (string, error) {
+	return utils.DecryptSecret(spider.GitPassword)
+}
+
+// 返回脱敏后的爬虫
+func (spider Spider) Masked() Spider {
+	if spider.GitPassword != "" {
+		spider.GitPassword = utils.SecretMask
+		spider.GitPasswordUnchanged = true
+	}
+	sinks := make([]ResultSink, len(spider.ResultSinks))
+	for i, sink := range spider.ResultSinks {
+		sinks[i] = sink.Masked()
+	}
+	spider.ResultSinks = sinks
+	return spider
+}
+
 // 获取爬虫的任务
 func (spider *Spider) GetTasks() ([]Task, error) {
 	tasks, err := GetTaskList(bson.M{"spider_id": spider.Id}, 0, 10, "-create_ts")
@@ -307,6 +416,26 @@ func UpdateSpider(id bson.ObjectId, item Spider) error {
 		return err
 	}
 
+	// 未修改 Git 密码时保留原值
+	if item.GitPasswordUnchanged {
+		item.GitPassword = result.GitPassword
+	}
+
+	// 未修改投递目标的敏感字段时保留原值
+	for i, sink := range item.ResultSinks {
+		for _, old := range result.ResultSinks {
+			if !sink.Id.Valid() || sink.Id != old.Id {
+				continue
+			}
+			if sink.DsnUnchanged {
+				item.ResultSinks[i].Dsn = old.Dsn
+			}
+			if sink.SecretKeyUnchanged {
+				item.ResultSinks[i].SecretKey = old.SecretKey
+			}
+		}
+	}
+
 	if err := item.Save(); err != nil {
 		return err
 	}
@@ -341,6 +470,23 @@ func RemoveSpider(id bson.ObjectId) error {
 		}
 	}
 
+	// 历史版本的文件
+	fileIds, err := RemoveSpiderVersions(id)
+	if err != nil {
+		log.Errorf("remove spider versions error: %s, id:%s", err.Error(), id.Hex())
+		debug.PrintStack()
+	}
+	removed := map[bson.ObjectId]bool{result.FileId: true}
+	for _, fid := range fileIds {
+		if removed[fid] {
+			continue
+		}
+		removed[fid] = true
+		if err := gf.RemoveId(fid); err != nil {
+			log.Error("remove file error, id:" + fid.Hex())
+		}
+	}
+
 	return nil
 }
 
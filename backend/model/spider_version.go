@@ -0,0 +1,136 @@
+package model
+
+import (
+	"crawlab/database"
+	"github.com/apex/log"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"runtime/debug"
+	"time"
+)
+
+// 爬虫版本（每次上传或发布的GridFS文件）
+type SpiderVersion struct {
+	Id       bson.ObjectId `json:"_id" bson:"_id"`
+	SpiderId bson.ObjectId `json:"spider_id" bson:"spider_id"` // 爬虫ID
+	Version  int           `json:"version" bson:"version"`     // 版本号（从1开始递增）
+	FileId   bson.ObjectId `json:"file_id" bson:"file_id"`     // GridFS文件ID
+	Md5      string        `json:"md5" bson:"md5"`             // 文件MD5
+	DirMd5   string        `json:"dir_md5" bson:"dir_md5"`     // 主节点上传时爬虫目录内容的MD5，用于跳过未变化的上传
+	Message  string        `json:"message" bson:"message"`     // 版本说明
+
+	// 前端展示
+	Username string `json:"username" bson:"-"`
+
+	UserId   bson.ObjectId `json:"user_id" bson:"user_id"`
+	CreateTs time.Time     `json:"create_ts" bson:"create_ts"`
+}
+
+func (v *SpiderVersion) Add() error {
+	s, c := database.GetCol("spider_versions")
+	defer s.Close()
+
+	v.Id = bson.NewObjectId()
+	v.CreateTs = time.Now()
+	if err := c.Insert(v); err != nil {
+		// 版本号重复由调用方重试
+		if mgo.IsDup(err) {
+			return err
+		}
+		log.Errorf("add spider version error: %s", err.Error())
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
+func RemoveSpiderVersion(id bson.ObjectId) error {
+	s, c := database.GetCol("spider_versions")
+	defer s.Close()
+
+	return c.RemoveId(id)
+}
+
+func GetSpiderVersion(spiderId bson.ObjectId, version int) (SpiderVersion, error) {
+	s, c := database.GetCol("spider_versions")
+	defer s.Close()
+
+	var v SpiderVersion
+	if err := c.Find(bson.M{"spider_id": spiderId, "version": version}).One(&v); err != nil {
+		return v, err
+	}
+
+	// 获取用户名称
+	user, _ := GetUser(v.UserId)
+	v.Username = user.Username
+
+	return v, nil
+}
+
+// 获取爬虫最新版本，没有版本时返回 mgo.ErrNotFound
+func GetSpiderLatestVersion(spiderId bson.ObjectId) (SpiderVersion, error) {
+	s, c := database.GetCol("spider_versions")
+	defer s.Close()
+
+	var v SpiderVersion
+	if err := c.Find(bson.M{"spider_id": spiderId}).Sort("-version").One(&v); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+func GetSpiderVersionList(spiderId bson.ObjectId, skip int, limit int) ([]SpiderVersion, error) {
+	s, c := database.GetCol("spider_versions")
+	defer s.Close()
+
+	var versions []SpiderVersion
+	if err := c.Find(bson.M{"spider_id": spiderId}).Skip(skip).Limit(limit).Sort("-version").All(&versions); err != nil {
+		debug.PrintStack()
+		return versions, err
+	}
+
+	for i, v := range versions {
+		// 获取用户名称
+		user, _ := GetUser(v.UserId)
+		versions[i].Username = user.Username
+	}
+	return versions, nil
+}
+
+func GetSpiderVersionListTotal(spiderId bson.ObjectId) (int, error) {
+	s, c := database.GetCol("spider_versions")
+	defer s.Close()
+
+	return c.Find(bson.M{"spider_id": spiderId}).Count()
+}
+
+// 删除爬虫的所有版本记录，返回各版本的GridFS文件ID
+func RemoveSpiderVersions(spiderId bson.ObjectId) ([]bson.ObjectId, error) {
+	s, c := database.GetCol("spider_versions")
+	defer s.Close()
+
+	var fileIds []bson.ObjectId
+	var versions []SpiderVersion
+	if err := c.Find(bson.M{"spider_id": spiderId}).All(&versions); err != nil {
+		return fileIds, err
+	}
+	for _, v := range versions {
+		fileIds = append(fileIds, v.FileId)
+	}
+
+	if _, err := c.RemoveAll(bson.M{"spider_id": spiderId}); err != nil {
+		return fileIds, err
+	}
+	return fileIds, nil
+}
+
+// 同一爬虫的版本号唯一，并发添加版本时后插入的一方重试
+func InitSpiderVersionIndexes() error {
+	s, c := database.GetCol("spider_versions")
+	defer s.Close()
+
+	return c.EnsureIndex(mgo.Index{
+		Key:    []string{"spider_id", "version"},
+		Unique: true,
+	})
+}
@@ -10,6 +10,10 @@ import (
 	"time"
 )
 
+func init() {
+	RegisterAuditResource(AuditResource{Type: constants.AuditResourceTask, Col: "tasks"})
+}
+
 type Task struct {
 	Id              string        `json:"_id" bson:"_id"`
 	SpiderId        bson.ObjectId `json:"spider_id" bson:"spider_id"`
@@ -23,12 +27,23 @@ type Task struct {
 	Error           string        `json:"error" bson:"error"`
 	ResultCount     int           `json:"result_count" bson:"result_count"`
 	ErrorLogCount   int           `json:"error_log_count" bson:"error_log_count"`
+	WarningLogCount int           `json:"warning_log_count" bson:"warning_log_count"`
 	WaitDuration    float64       `json:"wait_duration" bson:"wait_duration"`
 	RuntimeDuration float64       `json:"runtime_duration" bson:"runtime_duration"`
 	TotalDuration   float64       `json:"total_duration" bson:"total_duration"`
 	Pid             int           `json:"pid" bson:"pid"`
 	RunType         string        `json:"run_type" bson:"run_type"`
 	ScheduleId      bson.ObjectId `json:"schedule_id" bson:"schedule_id"`
+	ParentId        string        `json:"parent_id" bson:"parent_id"`           // 首次执行的任务ID（重试任务）
+	Attempt         int           `json:"attempt" bson:"attempt"`               // 第几次执行
+	Timeout         int           `json:"timeout" bson:"timeout"`               // 最大运行时长（秒），0表示使用爬虫设置
+	Priority        int           `json:"priority" bson:"priority"`             // 优先级（1-10），数值越大越优先
+	SpiderVersion   int           `json:"spider_version" bson:"spider_version"` // 指定的爬虫版本，0表示最新版本
+	LabelSelector   string        `json:"label_selector" bson:"label_selector"` // 节点标签选择器，例如 "region=eu, proxy=residential"
+
+	// 工作流
+	WorkflowRunId bson.ObjectId `json:"workflow_run_id" bson:"workflow_run_id,omitempty"` // 工作流执行ID
+	WorkflowStep  string        `json:"workflow_step" bson:"workflow_step,omitempty"`     // 工作流步骤
 
 	// 前端数据
 	SpiderName string `json:"spider_name"`
@@ -66,7 +81,21 @@ func (t *Task) Save() error {
 	s, c := database.GetCol("tasks")
 	defer s.Close()
 	t.UpdateTs = time.Now()
-	if err := c.UpdateId(t.Id, t); err != nil {
+
+	// 日志数由写入日志时单独更新，保存任务时不覆盖
+	data, err := bson.Marshal(t)
+	if err != nil {
+		return err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	delete(doc, "_id")
+	delete(doc, "error_log_count")
+	delete(doc, "warning_log_count")
+
+	if err := c.UpdateId(t.Id, bson.M{"$set": doc}); err != nil {
 		log.Errorf("update task error: %s", err.Error())
 		debug.PrintStack()
 		return err
@@ -109,10 +138,16 @@ func (t *Task) GetResults(pageNum int, pageSize int) (results []interface{}, tot
 	return
 }
 
-func (t *Task) GetLogItems(keyword string, page int, pageSize int) (logItems []LogItem, logTotal int, err error) {
+func (t *Task) GetLogItems(keyword string, levels []string, streams []string, page int, pageSize int) (logItems []LogItem, logTotal int, err error) {
 	query := bson.M{
 		"task_id": t.Id,
 	}
+	if len(levels) > 0 {
+		query["level"] = bson.M{"$in": levels}
+	}
+	if len(streams) > 0 {
+		query["stream"] = bson.M{"$in": streams}
+	}
 
 	logTotal, err = GetLogItemTotal(query, keyword)
 	if err != nil {
@@ -144,6 +179,19 @@ func (t *Task) GetErrorLogItems(n int) (errLogItems []ErrorLogItem, err error) {
 	return errLogItems, nil
 }
 
+// 获取符合条件的任务ID
+func GetTaskIds(filter interface{}) ([]string, error) {
+	s, c := database.GetCol("tasks")
+	defer s.Close()
+
+	ids := []string{}
+	if err := c.Find(filter).Distinct("_id", &ids); err != nil {
+		debug.PrintStack()
+		return ids, err
+	}
+	return ids, nil
+}
+
 func GetTaskList(filter interface{}, skip int, limit int, sortKey string) ([]Task, error) {
 	s, c := database.GetCol("tasks")
 	defer s.Close()
@@ -410,37 +458,19 @@ func UpdateTaskResultCount(id string) (err error) {
 	return nil
 }
 
-// update error log count
-func UpdateErrorLogCount(id string) (err error) {
-	s, c := database.GetCol("error_logs")
+// 设置任务的警告和错误日志数
+func SetTaskLogCounts(id string, warningCount int, errorCount int) error {
+	s, c := database.GetCol("tasks")
 	defer s.Close()
 
-	query := bson.M{
-		"task_id": id,
-	}
-	count, err := c.Find(query).Count()
-	if err != nil {
-		log.Errorf("update error log count error: " + err.Error())
-		debug.PrintStack()
-		return err
-	}
-
-	st, ct := database.GetCol("tasks")
-	defer st.Close()
-
-	task, err := GetTask(id)
-	if err != nil {
-		log.Errorf(err.Error())
-		return err
-	}
-	task.ErrorLogCount = count
-
-	if err := ct.UpdateId(id, task); err != nil {
-		log.Errorf("update error log count error: " + err.Error())
+	if err := c.UpdateId(id, bson.M{"$set": bson.M{
+		"warning_log_count": warningCount,
+		"error_log_count":   errorCount,
+	}}); err != nil {
+		log.Errorf("update task log count error: " + err.Error())
 		debug.PrintStack()
 		return err
 	}
-
 	return nil
 }
 
@@ -466,46 +496,3 @@ func UpdateTaskToAbnormal(nodeId bson.ObjectId) error {
 	}
 	return nil
 }
-
-// update task error logs
-func UpdateTaskErrorLogs(taskId string, errorRegexPattern string) error {
-	s, c := database.GetCol("logs")
-	defer s.Close()
-
-	if errorRegexPattern == "" {
-		errorRegexPattern = constants.ErrorRegexPattern
-	}
-
-	query := bson.M{
-		"task_id": taskId,
-		"msg": bson.M{
-			"$regex": bson.RegEx{
-				Pattern: errorRegexPattern,
-				Options: "i",
-			},
-		},
-	}
-	var logs []LogItem
-	if err := c.Find(query).All(&logs); err != nil {
-		log.Errorf("find error logs error: " + err.Error())
-		debug.PrintStack()
-		return err
-	}
-
-	for _, l := range logs {
-		e := ErrorLogItem{
-			Id:      bson.NewObjectId(),
-			TaskId:  l.TaskId,
-			Message: l.Message,
-			LogId:   l.Id,
-			Seq:     l.Seq,
-			Ts:      time.Now(),
-		}
-		if err := AddErrorLogItem(e); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"crawlab/constants"
 	"crawlab/database"
 	"github.com/apex/log"
 	"github.com/globalsign/mgo/bson"
@@ -8,12 +9,31 @@ import (
 	"time"
 )
 
+func init() {
+	RegisterAuditResource(AuditResource{Type: constants.AuditResourceToken, Col: "tokens", MaskedFields: []string{"token"}})
+}
+
 type Token struct {
-	Id       bson.ObjectId `json:"_id" bson:"_id"`
-	Token    string        `json:"token" bson:"token"`
-	UserId   bson.ObjectId `json:"user_id" bson:"user_id"`
-	CreateTs time.Time     `json:"create_ts" bson:"create_ts"`
-	UpdateTs time.Time     `json:"update_ts" bson:"update_ts"`
+	Id         bson.ObjectId   `json:"_id" bson:"_id"`
+	Name       string          `json:"name" bson:"name"`               // 名称
+	Token      string          `json:"token" bson:"token"`             // JWT
+	Scopes     []string        `json:"scopes" bson:"scopes"`           // 权限范围，为空时没有权限（旧版 Token 不限制）
+	ProjectIds []bson.ObjectId `json:"project_ids" bson:"project_ids"` // 限定项目，为空时不限制
+	SpiderIds  []bson.ObjectId `json:"spider_ids" bson:"spider_ids"`   // 限定爬虫，为空时不限制
+	ExpireTs   time.Time       `json:"expire_ts" bson:"expire_ts"`     // 过期时间，为空时永不过期
+	LastUsedTs time.Time       `json:"last_used_ts" bson:"last_used_ts"`
+	LastUsedIp string          `json:"last_used_ip" bson:"last_used_ip"`
+	UserId     bson.ObjectId   `json:"user_id" bson:"user_id"`
+	CreateTs   time.Time       `json:"create_ts" bson:"create_ts"`
+	UpdateTs   time.Time       `json:"update_ts" bson:"update_ts"`
+
+	// 旧版 Token（JWT 中没有类型），校验时设置
+	Legacy bool `json:"legacy" bson:"-"`
+}
+
+// 是否已过期
+func (t *Token) IsExpired() bool {
+	return !t.ExpireTs.IsZero() && time.Now().After(t.ExpireTs)
 }
 
 func (t *Token) Add() error {
@@ -53,6 +73,17 @@ func GetTokenById(id bson.ObjectId) (t Token, err error) {
 	return t, nil
 }
 
+func GetTokenByTokenStr(tokenStr string) (t Token, err error) {
+	s, c := database.GetCol("tokens")
+	defer s.Close()
+
+	if err = c.Find(bson.M{"token": tokenStr}).One(&t); err != nil {
+		return t, err
+	}
+
+	return t, nil
+}
+
 func GetTokensByUserId(uid bson.ObjectId) (tokens []Token, err error) {
 	s, c := database.GetCol("tokens")
 	defer s.Close()
@@ -78,3 +109,16 @@ func DeleteTokenById(id bson.ObjectId) error {
 
 	return nil
 }
+
+// 记录最近使用时间和IP
+func UpdateTokenLastUsed(id bson.ObjectId, ip string) error {
+	s, c := database.GetCol("tokens")
+	defer s.Close()
+
+	if err := c.UpdateId(id, bson.M{"$set": bson.M{"last_used_ts": time.Now(), "last_used_ip": ip}}); err != nil {
+		log.Errorf("update token last used error: " + err.Error())
+		return err
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"crawlab/constants"
 	"crawlab/database"
 	"crawlab/utils"
 	"github.com/apex/log"
@@ -11,6 +12,10 @@ import (
 	"time"
 )
 
+func init() {
+	RegisterAuditResource(AuditResource{Type: constants.AuditResourceUser, Col: "users", MaskedFields: []string{"password"}})
+}
+
 type User struct {
 	Id       bson.ObjectId `json:"_id" bson:"_id"`
 	Username string        `json:"username" bson:"username"`
@@ -19,6 +24,9 @@ type User struct {
 	Email    string        `json:"email" bson:"email"`
 	Setting  UserSetting   `json:"setting" bson:"setting"`
 
+	// 管理员授予的全局权限（节点、全局变量、工作流等不属于具体项目的操作）
+	Permissions []string `json:"permissions" bson:"permissions"`
+
 	UserId   bson.ObjectId `json:"user_id" bson:"user_id"`
 	CreateTs time.Time     `json:"create_ts" bson:"create_ts"`
 	UpdateTs time.Time     `json:"update_ts" bson:"update_ts"`
@@ -150,6 +158,13 @@ func UpdateUser(id bson.ObjectId, item User) error {
 	if err := item.Save(); err != nil {
 		return err
 	}
+
+	// 修改密码后已签发的刷新 token 失效
+	if item.Password != result.Password {
+		if err := RemoveUserRefreshTokens(id); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -1,13 +1,19 @@
 package model
 
 import (
+	"crawlab/constants"
 	"crawlab/database"
+	"crawlab/utils"
 	"errors"
 	"github.com/apex/log"
 	"github.com/globalsign/mgo/bson"
 	"runtime/debug"
 )
 
+func init() {
+	RegisterAuditResource(AuditResource{Type: constants.AuditResourceVariable, Col: "variable", MaskedFields: []string{"value"}})
+}
+
 /**
 全局变量
 */
@@ -17,12 +23,90 @@ type Variable struct {
 	Key    string        `json:"key" bson:"key"`
 	Value  string        `json:"value" bson:"value"`
 	Remark string        `json:"remark" bson:"remark"`
+
+	// 加密变量，值加密存储，接口只写不读
+	Secret bool `json:"secret" bson:"secret"`
+
+	// 提交时保留原值，脱敏返回的加密变量为 true
+	ValueUnchanged bool `json:"value_unchanged" bson:"-"`
+
+	// 作用范围，都为空时对所有爬虫生效
+	SpiderIds  []bson.ObjectId `json:"spider_ids" bson:"spider_ids"`
+	ProjectIds []bson.ObjectId `json:"project_ids" bson:"project_ids"`
+}
+
+// 加密变量的值
+func (model *Variable) encryptValue() error {
+	if !model.Secret {
+		return nil
+	}
+	value, err := utils.EncryptSecret(model.Value)
+	if err != nil {
+		log.Errorf("encrypt variable error: %s", err.Error())
+		debug.PrintStack()
+		return err
+	}
+	model.Value = value
+	return nil
+}
+
+// 返回脱敏后的变量
+func (model Variable) Masked() Variable {
+	if model.Secret {
+		model.Value = utils.SecretMask
+		model.ValueUnchanged = true
+	}
+	return model
+}
+
+// 返回解密后的值
+func (model *Variable) GetValue() (string, error) {
+	if !model.Secret {
+		return model.Value, nil
+	}
+	return utils.DecryptSecret(model.Value)
+}
+
+// 变量是否对该爬虫生效
+func (model *Variable) AppliesTo(spider Spider) bool {
+	if len(model.SpiderIds) == 0 && len(model.ProjectIds) == 0 {
+		return true
+	}
+	for _, id := range model.SpiderIds {
+		if id == spider.Id {
+			return true
+		}
+	}
+	for _, id := range model.ProjectIds {
+		if id == spider.ProjectId {
+			return true
+		}
+	}
+	return false
 }
 
 func (model *Variable) Save() error {
 	s, c := database.GetCol("variable")
 	defer s.Close()
 
+	// 未修改值时保留原值，取消加密时保存解密后的原值
+	if model.ValueUnchanged {
+		old, err := GetVariable(model.Id)
+		if err != nil {
+			return err
+		}
+		if model.Secret && old.Secret {
+			model.Value = old.Value
+		} else if model.Secret || old.Secret {
+			if model.Value, err = old.GetValue(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := model.encryptValue(); err != nil {
+		return err
+	}
+
 	if err := c.UpdateId(model.Id, model); err != nil {
 		log.Errorf("update variable error: %s", err.Error())
 		return err
@@ -40,6 +124,10 @@ func (model *Variable) Add() error {
 		return errors.New("key already exists")
 	}
 
+	if err := model.encryptValue(); err != nil {
+		return err
+	}
+
 	model.Id = bson.NewObjectId()
 	if err := c.Insert(model); err != nil {
 		log.Errorf("add variable error: %s", err.Error())
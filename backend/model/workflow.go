@@ -0,0 +1,161 @@
+package model
+
+import (
+	"crawlab/constants"
+	"crawlab/database"
+	"github.com/apex/log"
+	"github.com/globalsign/mgo/bson"
+	"runtime/debug"
+	"time"
+)
+
+func init() {
+	RegisterAuditResource(AuditResource{Type: constants.AuditResourceWorkflow, Col: "workflows"})
+}
+
+// 工作流步骤
+type WorkflowStep struct {
+	Key           string          `json:"key" bson:"key"`                       // 步骤标识（工作流内唯一）
+	SpiderId      bson.ObjectId   `json:"spider_id" bson:"spider_id"`           // 爬虫ID
+	Param         string          `json:"param" bson:"param"`                   // 参数
+	RunType       string          `json:"run_type" bson:"run_type"`             // 运行方式
+	NodeIds       []bson.ObjectId `json:"node_ids" bson:"node_ids"`             // 指定节点
+	LabelSelector string          `json:"label_selector" bson:"label_selector"` // 节点标签选择器
+	Upstreams     []string        `json:"upstreams" bson:"upstreams"`           // 上游步骤标识
+	Condition     string          `json:"condition" bson:"condition"`           // 触发条件: success / failure / always
+
+	// 前端展示
+	SpiderName string `json:"spider_name" bson:"-"`
+}
+
+// 工作流（爬虫DAG）
+type Workflow struct {
+	Id          bson.ObjectId  `json:"_id" bson:"_id"`
+	Name        string         `json:"name" bson:"name"`
+	Description string         `json:"description" bson:"description"`
+	Steps       []WorkflowStep `json:"steps" bson:"steps"`
+
+	// 前端展示
+	Username string `json:"username" bson:"-"`
+
+	UserId   bson.ObjectId `json:"user_id" bson:"user_id"`
+	CreateTs time.Time     `json:"create_ts" bson:"create_ts"`
+	UpdateTs time.Time     `json:"update_ts" bson:"update_ts"`
+}
+
+func (w *Workflow) Save() error {
+	s, c := database.GetCol("workflows")
+	defer s.Close()
+
+	w.UpdateTs = time.Now()
+
+	if err := c.UpdateId(w.Id, w); err != nil {
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
+func (w *Workflow) Add() error {
+	s, c := database.GetCol("workflows")
+	defer s.Close()
+
+	w.Id = bson.NewObjectId()
+	w.UpdateTs = time.Now()
+	w.CreateTs = time.Now()
+	if err := c.Insert(w); err != nil {
+		log.Errorf(err.Error())
+		debug.PrintStack()
+		return err
+	}
+
+	return nil
+}
+
+// 获取工作流步骤
+func (w *Workflow) GetStep(key string) (WorkflowStep, bool) {
+	for _, step := range w.Steps {
+		if step.Key == key {
+			return step, true
+		}
+	}
+	return WorkflowStep{}, false
+}
+
+func GetWorkflow(id bson.ObjectId) (Workflow, error) {
+	s, c := database.GetCol("workflows")
+	defer s.Close()
+
+	var w Workflow
+	if err := c.FindId(id).One(&w); err != nil {
+		return w, err
+	}
+
+	// 获取爬虫名称
+	for i, step := range w.Steps {
+		if spider, err := GetSpider(step.SpiderId); err == nil {
+			w.Steps[i].SpiderName = spider.DisplayName
+		}
+	}
+
+	// 获取用户名称
+	user, _ := GetUser(w.UserId)
+	w.Username = user.Username
+
+	return w, nil
+}
+
+func GetWorkflowList(filter interface{}, skip int, limit int, sortKey string) ([]Workflow, error) {
+	s, c := database.GetCol("workflows")
+	defer s.Close()
+
+	var workflows []Workflow
+	if err := c.Find(filter).Skip(skip).Limit(limit).Sort(sortKey).All(&workflows); err != nil {
+		debug.PrintStack()
+		return workflows, err
+	}
+
+	for i, w := range workflows {
+		// 获取用户名称
+		user, _ := GetUser(w.UserId)
+		workflows[i].Username = user.Username
+	}
+	return workflows, nil
+}
+
+func GetWorkflowListTotal(filter interface{}) (int, error) {
+	s, c := database.GetCol("workflows")
+	defer s.Close()
+
+	return c.Find(filter).Count()
+}
+
+func UpdateWorkflow(id bson.ObjectId, item Workflow) error {
+	s, c := database.GetCol("workflows")
+	defer s.Close()
+
+	var result Workflow
+	if err := c.FindId(id).One(&result); err != nil {
+		debug.PrintStack()
+		return err
+	}
+
+	item.Id = id
+	item.UserId = result.UserId
+	item.CreateTs = result.CreateTs
+	if err := item.Save(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func RemoveWorkflow(id bson.ObjectId) error {
+	s, c := database.GetCol("workflows")
+	defer s.Close()
+
+	if err := c.RemoveId(id); err != nil {
+		return err
+	}
+
+	return nil
+}
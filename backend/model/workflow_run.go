@@ -0,0 +1,146 @@
+package model
+
+import (
+	"crawlab/constants"
+	"crawlab/database"
+	"github.com/apex/log"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"runtime/debug"
+	"time"
+)
+
+// 工作流步骤执行状态
+type WorkflowRunStep struct {
+	Status   string    `json:"status" bson:"status"`       // 状态: pending / running / finished / error / skipped
+	TaskIds  []string  `json:"task_ids" bson:"task_ids"`   // 首次执行的任务ID
+	Error    string    `json:"error" bson:"error"`         // 错误信息
+	StartTs  time.Time `json:"start_ts" bson:"start_ts"`   // 开始时间
+	FinishTs time.Time `json:"finish_ts" bson:"finish_ts"` // 结束时间
+}
+
+// 工作流执行记录
+type WorkflowRun struct {
+	Id         bson.ObjectId              `json:"_id" bson:"_id"`
+	WorkflowId bson.ObjectId              `json:"workflow_id" bson:"workflow_id"`
+	Status     string                     `json:"status" bson:"status"`
+	Definition []WorkflowStep             `json:"definition" bson:"definition"` // 执行时的工作流步骤快照
+	Steps      map[string]WorkflowRunStep `json:"steps" bson:"steps"`           // 各步骤执行状态
+
+	// 前端展示
+	WorkflowName string `json:"workflow_name" bson:"-"`
+	Tasks        []Task `json:"tasks" bson:"-"`
+
+	UserId   bson.ObjectId `json:"user_id" bson:"user_id"`
+	StartTs  time.Time     `json:"start_ts" bson:"start_ts"`
+	FinishTs time.Time     `json:"finish_ts" bson:"finish_ts"`
+	CreateTs time.Time     `json:"create_ts" bson:"create_ts"`
+	UpdateTs time.Time     `json:"update_ts" bson:"update_ts"`
+}
+
+func (r *WorkflowRun) Save() error {
+	s, c := database.GetCol("workflow_runs")
+	defer s.Close()
+
+	r.UpdateTs = time.Now()
+
+	if err := c.UpdateId(r.Id, r); err != nil {
+		log.Errorf("update workflow run error: %s", err.Error())
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
+func (r *WorkflowRun) Add() error {
+	s, c := database.GetCol("workflow_runs")
+	defer s.Close()
+
+	r.Id = bson.NewObjectId()
+	r.StartTs = time.Now()
+	r.CreateTs = time.Now()
+	r.UpdateTs = time.Now()
+	if err := c.Insert(r); err != nil {
+		log.Errorf(err.Error())
+		debug.PrintStack()
+		return err
+	}
+	return nil
+}
+
+// 获取工作流执行的所有任务（包括重试任务）
+func (r *WorkflowRun) GetTasks() ([]Task, error) {
+	return GetTaskList(bson.M{"workflow_run_id": r.Id}, 0, constants.Infinite, "+create_ts")
+}
+
+// 将步骤状态从 pending 置为 running，步骤已开始时返回 false
+func (r *WorkflowRun) StartStep(key string) (bool, error) {
+	s, c := database.GetCol("workflow_runs")
+	defer s.Close()
+
+	selector := bson.M{
+		"_id":                      r.Id,
+		"steps." + key + ".status": constants.WorkflowStepStatusPending,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"steps." + key + ".status":   constants.WorkflowStepStatusRunning,
+			"steps." + key + ".start_ts": time.Now(),
+			"update_ts":                  time.Now(),
+		},
+	}
+	if err := c.Update(selector, update); err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func GetWorkflowRun(id bson.ObjectId) (WorkflowRun, error) {
+	s, c := database.GetCol("workflow_runs")
+	defer s.Close()
+
+	var r WorkflowRun
+	if err := c.FindId(id).One(&r); err != nil {
+		return r, err
+	}
+
+	// 获取工作流名称
+	if w, err := GetWorkflow(r.WorkflowId); err == nil {
+		r.WorkflowName = w.Name
+	}
+
+	return r, nil
+}
+
+func GetWorkflowRunList(filter interface{}, skip int, limit int, sortKey string) ([]WorkflowRun, error) {
+	s, c := database.GetCol("workflow_runs")
+	defer s.Close()
+
+	var runs []WorkflowRun
+	if err := c.Find(filter).Skip(skip).Limit(limit).Sort(sortKey).All(&runs); err != nil {
+		debug.PrintStack()
+		return runs, err
+	}
+	return runs, nil
+}
+
+func GetWorkflowRunListTotal(filter interface{}) (int, error) {
+	s, c := database.GetCol("workflow_runs")
+	defer s.Close()
+
+	return c.Find(filter).Count()
+}
+
+// 删除工作流的所有执行记录
+func RemoveWorkflowRunsByWorkflowId(id bson.ObjectId) error {
+	s, c := database.GetCol("workflow_runs")
+	defer s.Close()
+
+	if _, err := c.RemoveAll(bson.M{"workflow_id": id}); err != nil {
+		return err
+	}
+	return nil
+}
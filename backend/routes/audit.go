@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"crawlab/model"
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+	"net/http"
+	"time"
+)
+
+type AuditLogListRequestData struct {
+	PageNum      int    `form:"page_num"`
+	PageSize     int    `form:"page_size"`
+	UserId       string `form:"user_id"`
+	Username     string `form:"username"`
+	ResourceType string `form:"resource_type"`
+	ResourceId   string `form:"resource_id"`
+	Action       string `form:"action"`
+	StartTs      string `form:"start_ts"` // RFC3339 时间
+	EndTs        string `form:"end_ts"`   // RFC3339 时间
+}
+
+// @Summary Get audit log list
+// @Description Get audit log list. Only changes made through the HTTP API are recorded; changes made by the scheduler, node RPC, workflow runner and migrations are not.
+// @Tags audit
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param page_num query int false "page num"
+// @Param page_size query int false "page size"
+// @Param user_id query string false "user id"
+// @Param username query string false "username"
+// @Param resource_type query string false "resource type"
+// @Param resource_id query string false "resource id"
+// @Param action query string false "action"
+// @Param start_ts query string false "start time (RFC3339)"
+// @Param end_ts query string false "end time (RFC3339)"
+// @Success 200 json string Response
+// @Failure 400 json string Response
+// @Router /audit [get]
+func GetAuditLogList(c *gin.Context) {
+	data := AuditLogListRequestData{}
+	if err := c.ShouldBindQuery(&data); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+	if data.PageNum == 0 {
+		data.PageNum = 1
+	}
+	if data.PageSize == 0 {
+		data.PageSize = 10
+	}
+
+	// 筛选条件
+	query := bson.M{}
+	if data.UserId != "" {
+		if !bson.IsObjectIdHex(data.UserId) {
+			HandleErrorF(http.StatusBadRequest, c, "invalid user_id")
+			return
+		}
+		query["user_id"] = bson.ObjectIdHex(data.UserId)
+	}
+	if data.Username != "" {
+		query["username"] = data.Username
+	}
+	if data.ResourceType != "" {
+		query["resource_type"] = data.ResourceType
+	}
+	if data.ResourceId != "" {
+		query["resource_id"] = data.ResourceId
+	}
+	if data.Action != "" {
+		query["action"] = data.Action
+	}
+	tsQuery := bson.M{}
+	if data.StartTs != "" {
+		ts, err := time.Parse(time.RFC3339, data.StartTs)
+		if err != nil {
+			HandleErrorF(http.StatusBadRequest, c, "invalid start_ts")
+			return
+		}
+		tsQuery["$gte"] = ts
+	}
+	if data.EndTs != "" {
+		ts, err := time.Parse(time.RFC3339, data.EndTs)
+		if err != nil {
+			HandleErrorF(http.StatusBadRequest, c, "invalid end_ts")
+			return
+		}
+		tsQuery["$lt"] = ts
+	}
+	if len(tsQuery) > 0 {
+		query["create_ts"] = tsQuery
+	}
+
+	logs, err := model.GetAuditLogList(query, (data.PageNum-1)*data.PageSize, data.PageSize, "-create_ts")
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	total, err := model.GetAuditLogListTotal(query)
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ListResponse{
+		Status:  "ok",
+		Message: "success",
+		Data:    logs,
+		Total:   total,
+	})
+}
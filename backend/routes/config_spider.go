@@ -94,7 +94,7 @@ func PutConfigSpider(c *gin.Context) {
 	c.JSON(http.StatusOK, Response{
 		Status:  "ok",
 		Message: "success",
-		Data:    spider,
+		Data:    spider.Masked(),
 	})
 }
 
@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"crawlab/model"
+	"crawlab/services"
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+	"net/http"
+)
+
+type DepJobListRequestData struct {
+	PageNum  int    `form:"page_num"`
+	PageSize int    `form:"page_size"`
+	Type     string `form:"type"`
+	Lang     string `form:"lang"`
+	Status   string `form:"status"`
+}
+
+// 创建依赖安装任务，可指定多个节点或所有在线节点，异步执行
+func PutDepJob(c *gin.Context) {
+	var req services.DepJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	job, err := services.CreateDepJob(req, services.GetCurrentUser(c))
+	if err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+	go services.RunDepJob(job)
+
+	HandleSuccessData(c, job)
+}
+
+// 依赖安装任务列表
+func GetDepJobList(c *gin.Context) {
+	getDepJobList(c, bson.M{}, "")
+}
+
+// 依赖安装任务详情
+func GetDepJob(c *gin.Context) {
+	id := c.Param("id")
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	job, err := model.GetDepJob(bson.ObjectIdHex(id))
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+	HandleSuccessData(c, job)
+}
+
+// 节点的依赖安装历史，只包含该节点的执行结果
+func GetNodeDepJobList(c *gin.Context) {
+	id := c.Param("id")
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+	getDepJobList(c, bson.M{"nodes.node_id": bson.ObjectIdHex(id)}, id)
+}
+
+func getDepJobList(c *gin.Context, query bson.M, nodeId string) {
+	data := DepJobListRequestData{}
+	if err := c.ShouldBindQuery(&data); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+	if data.PageNum == 0 {
+		data.PageNum = 1
+	}
+	if data.PageSize == 0 {
+		data.PageSize = 10
+	}
+
+	// 筛选条件
+	if data.Type != "" {
+		query["type"] = data.Type
+	}
+	if data.Lang != "" {
+		query["lang"] = data.Lang
+	}
+	if data.Status != "" {
+		query["status"] = data.Status
+	}
+
+	list, err := model.GetDepJobList(query, (data.PageNum-1)*data.PageSize, data.PageSize, "-create_ts")
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	total, err := model.GetDepJobListTotal(query)
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	// 只返回指定节点的执行结果
+	if nodeId != "" {
+		for i, job := range list {
+			var nodes []model.DepJobNode
+			for _, n := range job.Nodes {
+				if n.NodeId.Hex() == nodeId {
+					nodes = append(nodes, n)
+				}
+			}
+			list[i].Nodes = nodes
+		}
+	}
+
+	c.JSON(http.StatusOK, ListResponse{
+		Status:  "ok",
+		Message: "success",
+		Data:    list,
+		Total:   total,
+	})
+}
@@ -0,0 +1,227 @@
+package routes
+
+import (
+	"crawlab/model"
+	"crawlab/services"
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+	"net/http"
+)
+
+// @Summary Get env profile list
+// @Description Get env profile list
+// @Tags env profile
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /env_profiles [get]
+func GetEnvProfileList(c *gin.Context) {
+	query := bson.M{}
+
+	profiles, err := model.GetEnvProfileList(query, 0, 0, "-_id")
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	total, err := model.GetEnvProfileListTotal(query)
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ListResponse{
+		Status:  "ok",
+		Message: "success",
+		Data:    profiles,
+		Total:   total,
+	})
+}
+
+// @Summary Get env profile
+// @Description Get env profile
+// @Tags env profile
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "env profile id"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /env_profiles/{id} [get]
+func GetEnvProfile(c *gin.Context) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	p, err := model.GetEnvProfile(bson.ObjectIdHex(id))
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+	HandleSuccessData(c, p)
+}
+
+// @Summary Put env profile
+// @Description Put env profile
+// @Tags env profile
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param item body model.EnvProfile true "env profile item"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /env_profiles [put]
+func PutEnvProfile(c *gin.Context) {
+	var item model.EnvProfile
+	if err := c.ShouldBindJSON(&item); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	// 校验环境配置
+	if err := services.ValidateEnvProfile(item); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	// UserId
+	item.UserId = services.GetCurrentUserId(c)
+
+	if err := item.Add(); err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	HandleSuccessData(c, item)
+}
+
+// @Summary Post env profile
+// @Description Post env profile
+// @Tags env profile
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "env profile id"
+// @Param item body model.EnvProfile true "env profile item"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /env_profiles/{id} [post]
+func PostEnvProfile(c *gin.Context) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	var item model.EnvProfile
+	if err := c.ShouldBindJSON(&item); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	// 校验环境配置
+	if err := services.ValidateEnvProfile(item); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	if err := model.UpdateEnvProfile(bson.ObjectIdHex(id), item); err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	HandleSuccess(c)
+}
+
+// @Summary Delete env profile
+// @Description Delete env profile
+// @Tags env profile
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "env profile id"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /env_profiles/{id} [delete]
+func DeleteEnvProfile(c *gin.Context) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	if err := model.RemoveEnvProfile(bson.ObjectIdHex(id)); err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	HandleSuccess(c)
+}
+
+// @Summary Get env profile drift
+// @Description Compare assigned nodes against the env profile
+// @Tags env profile
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "env profile id"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /env_profiles/{id}/drift [get]
+func GetEnvProfileDrift(c *gin.Context) {
+	p, nodes, ok := getEnvProfileWithNodes(c)
+	if !ok {
+		return
+	}
+
+	HandleSuccessData(c, services.CheckEnvProfileDriftList(p, nodes))
+}
+
+// @Summary Reconcile env profile
+// @Description Install missing langs and packages on drifted nodes, runs in background
+// @Tags env profile
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "env profile id"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /env_profiles/{id}/reconcile [post]
+func ReconcileEnvProfile(c *gin.Context) {
+	p, nodes, ok := getEnvProfileWithNodes(c)
+	if !ok {
+		return
+	}
+
+	jobs, err := services.ReconcileEnvProfile(p, nodes, services.GetCurrentUser(c), false)
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	HandleSuccessData(c, jobs)
+}
+
+func getEnvProfileWithNodes(c *gin.Context) (model.EnvProfile, []model.Node, bool) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return model.EnvProfile{}, nil, false
+	}
+
+	p, err := model.GetEnvProfile(bson.ObjectIdHex(id))
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return p, nil, false
+	}
+
+	nodes, err := services.GetEnvProfileNodes(p)
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return p, nil, false
+	}
+	return p, nodes, true
+}
@@ -98,6 +98,12 @@ func PostNode(c *gin.Context) {
 	}
 	newItem.Id = item.Id
 
+	// 验证节点标签
+	if err := services.ValidateNodeLabels(newItem.Labels); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
 	if err := model.UpdateNode(bson.ObjectIdHex(id), newItem); err != nil {
 		HandleError(http.StatusInternalServerError, c, err)
 		return
@@ -29,7 +29,7 @@ func GetProjectList(c *gin.Context) {
 	}
 
 	// 获取校验
-	query = services.GetAuthQuery(query, c)
+	query = services.GetProjectAuthQuery(query, c)
 
 	// 获取列表
 	projects, err := model.GetProjectList(query, "+_id")
@@ -52,6 +52,9 @@ func GetProjectList(c *gin.Context) {
 			HandleError(http.StatusInternalServerError, c, err)
 			return
 		}
+		for j := range spiders {
+			spiders[j] = spiders[j].Masked()
+		}
 		projects[i].Spiders = spiders
 	}
 
@@ -67,6 +70,9 @@ func GetProjectList(c *gin.Context) {
 			HandleError(http.StatusInternalServerError, c, err)
 			return
 		}
+		for j := range spiders {
+			spiders[j] = spiders[j].Masked()
+		}
 		noProject.Spiders = spiders
 		projects = append(projects, noProject)
 	}
@@ -169,6 +175,12 @@ func DeleteProject(c *gin.Context) {
 		return
 	}
 
+	// 删除项目成员
+	if err := model.RemoveProjectMembers(bson.ObjectIdHex(id)); err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
 	// 获取相关的爬虫
 	var spiders []model.Spider
 	s, col := database.GetCol("spiders")
@@ -242,3 +254,136 @@ func GetProjectTags(c *gin.Context) {
 		Data:    items,
 	})
 }
+
+type ProjectMemberRequestData struct {
+	UserId bson.ObjectId `json:"user_id"`
+	Role   string        `json:"role"`
+}
+
+// @Summary Get project members
+// @Description Get project members
+// @Tags project
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "project id"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /projects/{id}/members [get]
+func GetProjectMemberList(c *gin.Context) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	members, err := model.GetProjectMemberList(bson.ObjectIdHex(id))
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	HandleSuccessData(c, members)
+}
+
+// @Summary Put project member
+// @Description Grant a role in the project to a user
+// @Tags project
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "project id"
+// @Param reqData body routes.ProjectMemberRequestData true "user id and role"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /projects/{id}/members [put]
+func PutProjectMember(c *gin.Context) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	var reqData ProjectMemberRequestData
+	if err := c.ShouldBindJSON(&reqData); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	// 校验角色
+	if err := services.ValidateProjectRole(reqData.Role); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	// 校验用户
+	if !reqData.UserId.Valid() {
+		HandleErrorF(http.StatusBadRequest, c, "invalid user_id")
+		return
+	}
+	if _, err := model.GetUser(reqData.UserId); err != nil {
+		HandleErrorF(http.StatusBadRequest, c, "user not found")
+		return
+	}
+
+	// 校验项目
+	if _, err := model.GetProject(bson.ObjectIdHex(id)); err != nil {
+		HandleErrorF(http.StatusNotFound, c, "project not found")
+		return
+	}
+
+	if err := model.SetProjectMember(bson.ObjectIdHex(id), reqData.UserId, reqData.Role); err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	HandleSuccess(c)
+}
+
+// @Summary Delete project member
+// @Description Revoke the role of a user in the project
+// @Tags project
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "project id"
+// @Param user_id path string true "user id"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /projects/{id}/members/{user_id} [delete]
+func DeleteProjectMember(c *gin.Context) {
+	id := c.Param("id")
+	userId := c.Param("user_id")
+
+	if !bson.IsObjectIdHex(id) || !bson.IsObjectIdHex(userId) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	if err := model.RemoveProjectMember(bson.ObjectIdHex(id), bson.ObjectIdHex(userId)); err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	HandleSuccess(c)
+}
+
+// @Summary Get project permissions
+// @Description Get permissions of current user in the project
+// @Tags project
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "project id"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /projects/{id}/permissions [get]
+func GetProjectPermissions(c *gin.Context) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	HandleSuccessData(c, services.GetProjectPermissions(services.GetCurrentUser(c), bson.ObjectIdHex(id)))
+}
@@ -1,11 +1,13 @@
 package routes
 
 import (
+	"crawlab/constants"
 	"crawlab/model"
 	"crawlab/services"
 	"github.com/gin-gonic/gin"
 	"github.com/globalsign/mgo/bson"
 	"net/http"
+	"strconv"
 )
 
 // @Summary Get schedule list
@@ -27,6 +29,15 @@ func GetScheduleList(c *gin.Context) {
 		HandleError(http.StatusInternalServerError, c, err)
 		return
 	}
+
+	// 下次运行时间
+	for i, sch := range results {
+		if sch.Status == constants.ScheduleStatusStop {
+			continue
+		}
+		results[i].NextRunTs, _ = services.GetScheduleNextRunTs(sch)
+	}
+
 	HandleSuccessData(c, results)
 }
 
@@ -36,6 +47,7 @@ func GetScheduleList(c *gin.Context) {
 // @Produce json
 // @Param Authorization header string true "Authorization token"
 // @Param id path string true "schedule id"
+// @Param next query int false "number of next run times"
 // @Success 200 json string Response
 // @Failure 400 json string Response
 // @Router /schedules/{id} [get]
@@ -48,6 +60,21 @@ func GetSchedule(c *gin.Context) {
 		return
 	}
 
+	// 接下来的运行时间
+	n, _ := strconv.Atoi(c.Query("next"))
+	if n <= 0 {
+		n = constants.ScheduleNextRunCountDefault
+	}
+	if n > constants.ScheduleNextRunCountMax {
+		n = constants.ScheduleNextRunCountMax
+	}
+	if result.Status != constants.ScheduleStatusStop {
+		result.NextRunTsList, _ = services.GetScheduleNextRunTsList(result, n)
+		if len(result.NextRunTsList) > 0 {
+			result.NextRunTs = result.NextRunTsList[0]
+		}
+	}
+
 	HandleSuccessData(c, result)
 }
 
@@ -72,12 +99,36 @@ func PostSchedule(c *gin.Context) {
 		return
 	}
 
+	// 验证时区
+	if err := services.ValidateTimezone(newItem.Timezone); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
 	// 验证cron表达式
-	if err := services.ParserCron(newItem.Cron); err != nil {
+	if err := services.ParserCron(services.GetScheduleSpec(newItem)); err != nil {
 		HandleError(http.StatusInternalServerError, c, err)
 		return
 	}
 
+	// 验证重叠策略
+	if err := services.ValidateOverlapPolicy(newItem.OverlapPolicy); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	// 验证爬虫版本
+	if err := services.ValidateSpiderVersion(newItem.SpiderId, newItem.SpiderVersion); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	// 验证标签选择器
+	if err := services.ValidateLabelSelector(newItem.LabelSelector); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
 	newItem.Id = bson.ObjectIdHex(id)
 	// 更新数据库
 	if err := model.UpdateSchedule(bson.ObjectIdHex(id), newItem); err != nil {
@@ -113,12 +164,36 @@ func PutSchedule(c *gin.Context) {
 		return
 	}
 
+	// 验证时区
+	if err := services.ValidateTimezone(item.Timezone); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
 	// 验证cron表达式
-	if err := services.ParserCron(item.Cron); err != nil {
+	if err := services.ParserCron(services.GetScheduleSpec(item)); err != nil {
 		HandleError(http.StatusInternalServerError, c, err)
 		return
 	}
 
+	// 验证重叠策略
+	if err := services.ValidateOverlapPolicy(item.OverlapPolicy); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	// 验证爬虫版本
+	if err := services.ValidateSpiderVersion(item.SpiderId, item.SpiderVersion); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	// 验证标签选择器
+	if err := services.ValidateLabelSelector(item.LabelSelector); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
 	// 加入用户ID
 	item.UserId = services.GetCurrentUserId(c)
 
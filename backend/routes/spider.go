@@ -6,6 +6,7 @@ import (
 	"crawlab/entity"
 	"crawlab/model"
 	"crawlab/services"
+	"crawlab/services/result_sink"
 	"crawlab/utils"
 	"fmt"
 	"github.com/apex/log"
@@ -89,6 +90,7 @@ func GetSpiderList(c *gin.Context) {
 			filter["$or"] = []bson.M{
 				{"user_id": services.GetCurrentUserId(c)},
 				{"is_public": true},
+				{"project_id": bson.M{"$in": services.GetUserProjectIds(user)}},
 			}
 		}
 	} else if ownerType == constants.OwnerTypeMe {
@@ -118,6 +120,9 @@ func GetSpiderList(c *gin.Context) {
 		HandleError(http.StatusInternalServerError, c, err)
 		return
 	}
+	for i := range results {
+		results[i] = results[i].Masked()
+	}
 	c.JSON(http.StatusOK, Response{
 		Status:  "ok",
 		Message: "success",
@@ -150,7 +155,7 @@ func GetSpider(c *gin.Context) {
 	c.JSON(http.StatusOK, Response{
 		Status:  "ok",
 		Message: "success",
-		Data:    spider,
+		Data:    spider.Masked(),
 	})
 }
 
@@ -178,6 +183,14 @@ func PostSpider(c *gin.Context) {
 		return
 	}
 
+	// 校验结果投递目标
+	for _, sink := range item.ResultSinks {
+		if err := result_sink.ValidateSinkType(sink.Type); err != nil {
+			HandleError(http.StatusBadRequest, c, err)
+			return
+		}
+	}
+
 	// UserId
 	if !item.UserId.Valid() {
 		item.UserId = bson.ObjectIdHex(constants.ObjectIdNull)
@@ -331,7 +344,7 @@ func PutSpider(c *gin.Context) {
 	c.JSON(http.StatusOK, Response{
 		Status:  "ok",
 		Message: "success",
-		Data:    spider,
+		Data:    spider.Masked(),
 	})
 }
 
@@ -420,6 +433,7 @@ func UploadSpider(c *gin.Context) {
 	displayName := c.PostForm("display_name")
 	col := c.PostForm("col")
 	cmd := c.PostForm("cmd")
+	message := c.PostForm("message")
 
 	// 如果不为zip文件，返回错误
 	if !strings.HasSuffix(uploadFile.Filename, ".zip") {
@@ -448,23 +462,7 @@ func UploadSpider(c *gin.Context) {
 		return
 	}
 
-	// 获取 GridFS 实例
-	s, gf := database.GetGridFs("files")
-	defer s.Close()
-
-	// 判断文件是否已经存在
-	var gfFile model.GridFs
-	if err := gf.Find(bson.M{"filename": uploadFile.Filename}).One(&gfFile); err == nil {
-		// 已经存在文件，则删除
-		if err := gf.RemoveId(gfFile.Id); err != nil {
-			log.Errorf("remove grid fs error: %s", err.Error())
-			debug.PrintStack()
-			HandleError(http.StatusInternalServerError, c, err)
-			return
-		}
-	}
-
-	// 上传到GridFs
+	// 上传到GridFs（保留历史版本的文件）
 	fid, err := services.UploadToGridFs(uploadFile.Filename, tmpFilePath)
 	if err != nil {
 		log.Errorf("upload to grid fs error: %s", err.Error())
@@ -511,6 +509,19 @@ func UploadSpider(c *gin.Context) {
 			HandleError(http.StatusInternalServerError, c, err)
 			return
 		}
+
+		// 记录版本
+		spider = model.GetSpiderByName(spider.Name)
+		v, err := services.AddSpiderVersion(spider, fid, services.GetCurrentUserId(c), message)
+		if err != nil {
+			HandleError(http.StatusInternalServerError, c, err)
+			return
+		}
+		spider.Version = v.Version
+		if err := spider.Save(); err != nil {
+			HandleError(http.StatusInternalServerError, c, err)
+			return
+		}
 	} else {
 		if name != "" {
 			spider.Name = name
@@ -524,8 +535,15 @@ func UploadSpider(c *gin.Context) {
 		if cmd != "" {
 			spider.Cmd = cmd
 		}
+		// 记录版本
+		v, err := services.AddSpiderVersion(spider, fid, services.GetCurrentUserId(c), message)
+		if err != nil {
+			HandleError(http.StatusInternalServerError, c, err)
+			return
+		}
 		// 更新file_id
 		spider.FileId = fid
+		spider.Version = v.Version
 		if err := spider.Save(); err != nil {
 			log.Error("add spider error: " + err.Error())
 			debug.PrintStack()
@@ -543,7 +561,7 @@ func UploadSpider(c *gin.Context) {
 	c.JSON(http.StatusOK, Response{
 		Status:  "ok",
 		Message: "success",
-		Data:    spider,
+		Data:    spider.Masked(),
 	})
 }
 
@@ -581,6 +599,9 @@ func UploadSpiderFromId(c *gin.Context) {
 		return
 	}
 
+	// 版本说明
+	message := c.PostForm("message")
+
 	// 如果不为zip文件，返回错误
 	if !strings.HasSuffix(uploadFile.Filename, ".zip") {
 		debug.PrintStack()
@@ -609,23 +630,7 @@ func UploadSpiderFromId(c *gin.Context) {
 		return
 	}
 
-	// 获取 GridFS 实例
-	s, gf := database.GetGridFs("files")
-	defer s.Close()
-
-	// 判断文件是否已经存在
-	var gfFile model.GridFs
-	if err := gf.Find(bson.M{"filename": spider.Name}).One(&gfFile); err == nil {
-		// 已经存在文件，则删除
-		if err := gf.RemoveId(gfFile.Id); err != nil {
-			log.Errorf("remove grid fs error: " + err.Error())
-			debug.PrintStack()
-			HandleError(http.StatusInternalServerError, c, err)
-			return
-		}
-	}
-
-	// 上传到GridFs
+	// 上传到GridFs（保留历史版本的文件）
 	fid, err := services.UploadToGridFs(spider.Name, tmpFilePath)
 	if err != nil {
 		log.Errorf("upload to grid fs error: %s", err.Error())
@@ -634,8 +639,16 @@ func UploadSpiderFromId(c *gin.Context) {
 		return
 	}
 
+	// 记录版本
+	v, err := services.AddSpiderVersion(spider, fid, services.GetCurrentUserId(c), message)
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
 	// 更新file_id
 	spider.FileId = fid
+	spider.Version = v.Version
 	if err := spider.Save(); err != nil {
 		log.Errorf(err.Error())
 		debug.PrintStack()
@@ -775,6 +788,7 @@ func RunSelectedSpider(c *gin.Context) {
 		RunType    string          `json:"run_type"`
 		NodeIds    []bson.ObjectId `json:"node_ids"`
 		TaskParams []TaskParam     `json:"task_params"`
+		Selector   string          `json:"label_selector"` // 节点标签选择器，随机和所有节点方式下生效
 	}
 
 	var reqBody ReqBody
@@ -783,6 +797,12 @@ func RunSelectedSpider(c *gin.Context) {
 		return
 	}
 
+	// 验证标签选择器
+	if err := services.ValidateLabelSelector(reqBody.Selector); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
 	// 任务ID
 	var taskIds []string
 
@@ -790,20 +810,21 @@ func RunSelectedSpider(c *gin.Context) {
 	// TODO: 优化此部分代码，与 routes.PutTask 有重合部分
 	for _, taskParam := range reqBody.TaskParams {
 		if reqBody.RunType == constants.RunTypeAllNodes {
-			// 所有节点
-			nodes, err := model.GetNodeList(nil)
+			// 所有节点（满足标签选择器）
+			nodes, err := services.GetNodeListByLabelSelector(reqBody.Selector)
 			if err != nil {
 				HandleError(http.StatusInternalServerError, c, err)
 				return
 			}
 			for _, node := range nodes {
 				t := model.Task{
-					SpiderId:   taskParam.SpiderId,
-					NodeId:     node.Id,
-					Param:      taskParam.Param,
-					UserId:     services.GetCurrentUserId(c),
-					RunType:    constants.RunTypeAllNodes,
-					ScheduleId: bson.ObjectIdHex(constants.ObjectIdNull),
+					SpiderId:      taskParam.SpiderId,
+					NodeId:        node.Id,
+					Param:         taskParam.Param,
+					UserId:        services.GetCurrentUserId(c),
+					RunType:       constants.RunTypeAllNodes,
+					ScheduleId:    bson.ObjectIdHex(constants.ObjectIdNull),
+					LabelSelector: reqBody.Selector,
 				}
 
 				id, err := services.AddTask(t)
@@ -817,11 +838,12 @@ func RunSelectedSpider(c *gin.Context) {
 		} else if reqBody.RunType == constants.RunTypeRandom {
 			// 随机
 			t := model.Task{
-				SpiderId:   taskParam.SpiderId,
-				Param:      taskParam.Param,
-				UserId:     services.GetCurrentUserId(c),
-				RunType:    constants.RunTypeRandom,
-				ScheduleId: bson.ObjectIdHex(constants.ObjectIdNull),
+				SpiderId:      taskParam.SpiderId,
+				Param:         taskParam.Param,
+				UserId:        services.GetCurrentUserId(c),
+				RunType:       constants.RunTypeRandom,
+				ScheduleId:    bson.ObjectIdHex(constants.ObjectIdNull),
+				LabelSelector: reqBody.Selector,
 			}
 			id, err := services.AddTask(t)
 			if err != nil {
@@ -1225,7 +1247,7 @@ func PostSpiderFile(c *gin.Context) {
 	}
 
 	// 同步到GridFS
-	if err := services.UploadSpiderToGridFsFromMaster(spider); err != nil {
+	if err := services.UploadSpiderVersionFromMaster(spider, services.GetCurrentUserId(c), "update file: "+reqBody.Path); err != nil {
 		HandleError(http.StatusInternalServerError, c, err)
 		return
 	}
@@ -1276,7 +1298,7 @@ func PutSpiderFile(c *gin.Context) {
 	}
 
 	// 同步到GridFS
-	if err := services.UploadSpiderToGridFsFromMaster(spider); err != nil {
+	if err := services.UploadSpiderVersionFromMaster(spider, services.GetCurrentUserId(c), "add file: "+reqBody.Path); err != nil {
 		HandleError(http.StatusInternalServerError, c, err)
 		return
 	}
@@ -1326,7 +1348,7 @@ func PutSpiderDir(c *gin.Context) {
 	}
 
 	// 同步到GridFS
-	if err := services.UploadSpiderToGridFsFromMaster(spider); err != nil {
+	if err := services.UploadSpiderVersionFromMaster(spider, services.GetCurrentUserId(c), "add dir: "+reqBody.Path); err != nil {
 		HandleError(http.StatusInternalServerError, c, err)
 		return
 	}
@@ -1366,7 +1388,7 @@ func DeleteSpiderFile(c *gin.Context) {
 	}
 
 	// 同步到GridFS
-	if err := services.UploadSpiderToGridFsFromMaster(spider); err != nil {
+	if err := services.UploadSpiderVersionFromMaster(spider, services.GetCurrentUserId(c), "delete file: "+reqBody.Path); err != nil {
 		HandleError(http.StatusInternalServerError, c, err)
 		return
 	}
@@ -1421,7 +1443,7 @@ func RenameSpiderFile(c *gin.Context) {
 	}
 
 	// 同步到GridFS
-	if err := services.UploadSpiderToGridFsFromMaster(spider); err != nil {
+	if err := services.UploadSpiderVersionFromMaster(spider, services.GetCurrentUserId(c), "rename file: "+reqBody.Path+" -> "+reqBody.NewPath); err != nil {
 		HandleError(http.StatusInternalServerError, c, err)
 		return
 	}
@@ -1824,3 +1846,71 @@ func PostSpiderResetGit(c *gin.Context) {
 }
 
 // ======== ./Git 部分 ========
+
+type SpiderResultsDownloadRequestData struct {
+	StartTs string `form:"start_ts"` // RFC3339 时间，按任务创建时间筛选
+	EndTs   string `form:"end_ts"`   // RFC3339 时间
+}
+
+// @Summary Download spider results
+// @Description Download results of all tasks of the spider, format could be csv/jsonl/xlsx/parquet
+// @Tags spider
+// @Produce octet-stream
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "spider id"
+// @Param format query string false "export format"
+// @Param start_ts query string false "start time (RFC3339)"
+// @Param end_ts query string false "end time (RFC3339)"
+// @Failure 400 json string Response
+// @Router /spiders/{id}/results/download [get]
+func DownloadSpiderResults(c *gin.Context) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	data := SpiderResultsDownloadRequestData{}
+	if err := c.ShouldBindQuery(&data); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	spider, err := model.GetSpider(bson.ObjectIdHex(id))
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	// 时间范围内的任务
+	filter := bson.M{"spider_id": spider.Id}
+	tsQuery := bson.M{}
+	if data.StartTs != "" {
+		ts, err := time.Parse(time.RFC3339, data.StartTs)
+		if err != nil {
+			HandleErrorF(http.StatusBadRequest, c, "invalid start_ts")
+			return
+		}
+		tsQuery["$gte"] = ts
+	}
+	if data.EndTs != "" {
+		ts, err := time.Parse(time.RFC3339, data.EndTs)
+		if err != nil {
+			HandleErrorF(http.StatusBadRequest, c, "invalid end_ts")
+			return
+		}
+		tsQuery["$lte"] = ts
+	}
+	if len(tsQuery) > 0 {
+		filter["create_ts"] = tsQuery
+	}
+	taskIds, err := model.GetTaskIds(filter)
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	col := utils.GetSpiderCol(spider.Col, spider.Name)
+	exportResults(c, col, bson.M{"task_id": bson.M{"$in": taskIds}}, "spider_"+spider.Id.Hex())
+}
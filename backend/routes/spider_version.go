@@ -0,0 +1,157 @@
+package routes
+
+import (
+	"crawlab/model"
+	"crawlab/services"
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"net/http"
+	"strconv"
+)
+
+type SpiderVersionListRequestData struct {
+	PageNum  int `form:"page_num"`
+	PageSize int `form:"page_size"`
+}
+
+type SpiderVersionDiffRequestData struct {
+	From int `form:"from" binding:"required"`
+	To   int `form:"to" binding:"required"`
+}
+
+// @Summary Get spider version list
+// @Description Get spider version list
+// @Tags spider
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "spider id"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /spiders/{id}/versions [get]
+func GetSpiderVersionList(c *gin.Context) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	data := SpiderVersionListRequestData{}
+	if err := c.ShouldBindQuery(&data); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+	if data.PageNum == 0 {
+		data.PageNum = 1
+	}
+	if data.PageSize == 0 {
+		data.PageSize = 10
+	}
+
+	versions, err := model.GetSpiderVersionList(bson.ObjectIdHex(id), (data.PageNum-1)*data.PageSize, data.PageSize)
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	total, err := model.GetSpiderVersionListTotal(bson.ObjectIdHex(id))
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ListResponse{
+		Status:  "ok",
+		Message: "success",
+		Data:    versions,
+		Total:   total,
+	})
+}
+
+// @Summary Get spider version diff
+// @Description Get changed files between two spider versions
+// @Tags spider
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "spider id"
+// @Param from query int true "from version"
+// @Param to query int true "to version"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /spiders/{id}/versions/diff [get]
+func GetSpiderVersionDiff(c *gin.Context) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	data := SpiderVersionDiffRequestData{}
+	if err := c.ShouldBindQuery(&data); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	spider, err := model.GetSpider(bson.ObjectIdHex(id))
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	diff, err := services.DiffSpiderVersions(spider, data.From, data.To)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			HandleErrorF(http.StatusNotFound, c, "cannot find spider version")
+		} else {
+			HandleError(http.StatusInternalServerError, c, err)
+		}
+		return
+	}
+
+	HandleSuccessData(c, diff)
+}
+
+// @Summary Rollback spider version
+// @Description Rollback spider files to the given version, which is recorded as a new version
+// @Tags spider
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "spider id"
+// @Param version path int true "spider version"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /spiders/{id}/versions/{version}/rollback [post]
+func RollbackSpiderVersion(c *gin.Context) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		HandleErrorF(http.StatusBadRequest, c, "invalid version")
+		return
+	}
+
+	spider, err := model.GetSpider(bson.ObjectIdHex(id))
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	v, err := services.RollbackSpiderVersion(spider, version, services.GetCurrentUserId(c))
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			HandleErrorF(http.StatusNotFound, c, "cannot find spider version")
+		} else {
+			HandleError(http.StatusInternalServerError, c, err)
+		}
+		return
+	}
+
+	HandleSuccessData(c, v)
+}
@@ -7,6 +7,7 @@ import (
 	"crawlab/services/rpc"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
 	"net/http"
 	"strings"
 )
@@ -127,30 +128,17 @@ func InstallDep(c *gin.Context) {
 		DepName string `json:"dep_name"`
 	}
 
-	nodeId := c.Param("id")
-
 	var reqBody ReqBody
 	if err := c.ShouldBindJSON(&reqBody); err != nil {
 		HandleError(http.StatusBadRequest, c, err)
 		return
 	}
 
-	if services.IsMasterNode(nodeId) {
-		if err := rpc.InstallDepLocal(reqBody.Lang, reqBody.DepName); err != nil {
-			HandleError(http.StatusInternalServerError, c, err)
-			return
-		}
-	} else {
-		if err := rpc.InstallDepRemote(nodeId, reqBody.Lang, reqBody.DepName); err != nil {
-			HandleError(http.StatusInternalServerError, c, err)
-			return
-		}
-	}
-
-	c.JSON(http.StatusOK, Response{
-		Status:  "ok",
-		Message: "success",
-	})
+	runNodeDepJob(c, services.DepJobRequest{
+		Type:    constants.DepJobTypeInstallDep,
+		Lang:    reqBody.Lang,
+		DepName: reqBody.DepName,
+	}, true)
 }
 
 func UninstallDep(c *gin.Context) {
@@ -159,29 +147,17 @@ func UninstallDep(c *gin.Context) {
 		DepName string `json:"dep_name"`
 	}
 
-	nodeId := c.Param("id")
-
 	var reqBody ReqBody
 	if err := c.ShouldBindJSON(&reqBody); err != nil {
 		HandleError(http.StatusBadRequest, c, err)
+		return
 	}
 
-	if services.IsMasterNode(nodeId) {
-		if err := rpc.UninstallDepLocal(reqBody.Lang, reqBody.DepName); err != nil {
-			HandleError(http.StatusInternalServerError, c, err)
-			return
-		}
-	} else {
-		if err := rpc.UninstallDepRemote(nodeId, reqBody.Lang, reqBody.DepName); err != nil {
-			HandleError(http.StatusInternalServerError, c, err)
-			return
-		}
-	}
-
-	c.JSON(http.StatusOK, Response{
-		Status:  "ok",
-		Message: "success",
-	})
+	runNodeDepJob(c, services.DepJobRequest{
+		Type:    constants.DepJobTypeUninstallDep,
+		Lang:    reqBody.Lang,
+		DepName: reqBody.DepName,
+	}, true)
 }
 
 func GetDepJson(c *gin.Context) {
@@ -214,32 +190,116 @@ func InstallLang(c *gin.Context) {
 		Lang string `json:"lang"`
 	}
 
+	var reqBody ReqBody
+	if err := c.ShouldBindJSON(&reqBody); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	// 安装语言耗时较长，不等待安装完成，可在安装记录中查看结果
+	runNodeDepJob(c, services.DepJobRequest{
+		Type: constants.DepJobTypeInstallLang,
+		Lang: reqBody.Lang,
+	}, false)
+}
+
+// 在单个节点上执行依赖安装任务
+func runNodeDepJob(c *gin.Context, req services.DepJobRequest, wait bool) {
 	nodeId := c.Param("id")
+	if !bson.IsObjectIdHex(nodeId) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+	req.NodeIds = []bson.ObjectId{bson.ObjectIdHex(nodeId)}
+
+	job, err := services.CreateDepJob(req, services.GetCurrentUser(c))
+	if err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	if !wait {
+		go services.RunDepJob(job)
+		HandleSuccessData(c, job)
+		return
+	}
+
+	job, err = services.RunDepJob(job)
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+	if job.Status == constants.DepJobStatusError && len(job.Nodes) > 0 {
+		HandleErrorF(http.StatusInternalServerError, c, job.Nodes[0].Error)
+		return
+	}
+	HandleSuccessData(c, job)
+}
+
+// 主节点离线依赖缓存文件列表
+func GetDepCacheList(c *gin.Context) {
+	lang := c.Param("lang")
+
+	files, err := rpc.GetDepCacheFilesLocal(lang)
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+	HandleSuccessData(c, files)
+}
+
+// 下载依赖及其子依赖到主节点离线缓存
+func AddDepCache(c *gin.Context) {
+	type ReqBody struct {
+		DepName string `json:"dep_name"`
+	}
+
+	lang := c.Param("lang")
 
 	var reqBody ReqBody
 	if err := c.ShouldBindJSON(&reqBody); err != nil {
 		HandleError(http.StatusBadRequest, c, err)
 		return
 	}
+	if reqBody.DepName == "" {
+		HandleErrorF(http.StatusBadRequest, c, "dep_name should not be empty")
+		return
+	}
 
-	if services.IsMasterNode(nodeId) {
-		_, err := rpc.InstallLangLocal(reqBody.Lang)
-		if err != nil {
-			HandleError(http.StatusInternalServerError, c, err)
-			return
-		}
-	} else {
-		_, err := rpc.InstallLangRemote(nodeId, reqBody.Lang)
-		if err != nil {
-			HandleError(http.StatusInternalServerError, c, err)
-			return
-		}
+	output, err := rpc.AddDepCacheLocal(lang, reqBody.DepName)
+	if err != nil {
+		HandleErrorF(http.StatusInternalServerError, c, fmt.Sprintf("%s\n%s", err.Error(), output))
+		return
 	}
+	HandleSuccessData(c, output)
+}
 
-	// TODO: check if install is successful
+// 上传依赖包到主节点离线缓存（无法访问外网的主节点）
+func UploadDepCache(c *gin.Context) {
+	lang := c.Param("lang")
 
-	c.JSON(http.StatusOK, Response{
-		Status:  "ok",
-		Message: "success",
-	})
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+	defer file.Close()
+
+	if err := rpc.SaveDepCacheFileLocal(lang, header.Filename, file); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+	HandleSuccess(c)
+}
+
+// 删除主节点离线缓存中的文件
+func DeleteDepCache(c *gin.Context) {
+	lang := c.Param("lang")
+	path := c.Query("path")
+
+	if err := rpc.RemoveDepCacheFileLocal(lang, path); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+	HandleSuccess(c)
 }
@@ -1,15 +1,21 @@
 package routes
 
 import (
-	"bytes"
 	"crawlab/constants"
 	"crawlab/model"
 	"crawlab/services"
+	"crawlab/services/result_export"
+	"crawlab/services/result_sink"
 	"crawlab/utils"
-	"encoding/csv"
+	"github.com/apex/log"
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 	"github.com/globalsign/mgo/bson"
+	"io"
 	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
 )
 
 type TaskListRequestData struct {
@@ -18,6 +24,7 @@ type TaskListRequestData struct {
 	NodeId     string `form:"node_id"`
 	SpiderId   string `form:"spider_id"`
 	ScheduleId string `form:"schedule_id"`
+	ParentId   string `form:"parent_id"`
 	Status     string `form:"status"`
 }
 
@@ -55,6 +62,9 @@ func GetTaskList(c *gin.Context) {
 	if data.ScheduleId != "" {
 		query["schedule_id"] = bson.ObjectIdHex(data.ScheduleId)
 	}
+	if data.ParentId != "" {
+		query["parent_id"] = data.ParentId
+	}
 
 	// 获取校验
 	query = services.GetAuthQuery(query, c)
@@ -92,12 +102,80 @@ func GetTask(c *gin.Context) {
 	HandleSuccessData(c, result)
 }
 
+// 获取任务的所有执行记录（首次执行及重试）
+func GetTaskAttempts(c *gin.Context) {
+	id := c.Param("id")
+
+	task, err := model.GetTask(id)
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	// 首次执行的任务ID
+	parentId := task.ParentId
+	if parentId == "" {
+		parentId = task.Id
+	}
+
+	query := bson.M{
+		"$or": []bson.M{
+			{"_id": parentId},
+			{"parent_id": parentId},
+		},
+	}
+	tasks, err := model.GetTaskList(query, 0, constants.Infinite, "+create_ts")
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+	HandleSuccessData(c, tasks)
+}
+
+// 获取任务结果的投递状态
+func GetTaskDeliveries(c *gin.Context) {
+	id := c.Param("id")
+
+	list, err := model.GetResultDeliveryList(bson.M{"task_id": id})
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+	HandleSuccessData(c, list)
+}
+
+// 重新投递任务结果
+func RetryTaskDelivery(c *gin.Context) {
+	id := c.Param("id")
+	deliveryId := c.Param("delivery_id")
+
+	if !bson.IsObjectIdHex(deliveryId) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid delivery_id")
+		return
+	}
+	d, err := model.GetResultDelivery(bson.ObjectIdHex(deliveryId))
+	if err != nil || d.TaskId != id {
+		HandleErrorF(http.StatusNotFound, c, "result delivery not found")
+		return
+	}
+
+	if err := result_sink.RetryResultDelivery(d.Id); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+	HandleSuccess(c)
+}
+
 func PutTask(c *gin.Context) {
 	type TaskRequestBody struct {
 		SpiderId bson.ObjectId   `json:"spider_id"`
 		RunType  string          `json:"run_type"`
 		NodeIds  []bson.ObjectId `json:"node_ids"`
 		Param    string          `json:"param"`
+		Timeout  int             `json:"timeout"`
+		Priority int             `json:"priority"`
+		Version  int             `json:"spider_version"`
+		Selector string          `json:"label_selector"` // 节点标签选择器，随机和所有节点方式下生效
 	}
 
 	// 绑定数据
@@ -107,24 +185,44 @@ func PutTask(c *gin.Context) {
 		return
 	}
 
+	// 验证爬虫版本
+	if err := services.ValidateSpiderVersion(reqBody.SpiderId, reqBody.Version); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	// 验证标签选择器
+	if err := services.ValidateLabelSelector(reqBody.Selector); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
 	// 任务ID
 	var taskIds []string
 
 	if reqBody.RunType == constants.RunTypeAllNodes {
-		// 所有节点
-		nodes, err := model.GetNodeList(nil)
+		// 所有节点（满足标签选择器）
+		nodes, err := services.GetNodeListByLabelSelector(reqBody.Selector)
 		if err != nil {
 			HandleError(http.StatusInternalServerError, c, err)
 			return
 		}
+		if len(nodes) == 0 {
+			HandleErrorF(http.StatusBadRequest, c, "no node matches label selector")
+			return
+		}
 		for _, node := range nodes {
 			t := model.Task{
-				SpiderId:   reqBody.SpiderId,
-				NodeId:     node.Id,
-				Param:      reqBody.Param,
-				UserId:     services.GetCurrentUserId(c),
-				RunType:    constants.RunTypeAllNodes,
-				ScheduleId: bson.ObjectIdHex(constants.ObjectIdNull),
+				SpiderId:      reqBody.SpiderId,
+				NodeId:        node.Id,
+				Param:         reqBody.Param,
+				UserId:        services.GetCurrentUserId(c),
+				RunType:       constants.RunTypeAllNodes,
+				ScheduleId:    bson.ObjectIdHex(constants.ObjectIdNull),
+				Timeout:       reqBody.Timeout,
+				Priority:      reqBody.Priority,
+				SpiderVersion: reqBody.Version,
+				LabelSelector: reqBody.Selector,
 			}
 
 			id, err := services.AddTask(t)
@@ -138,11 +236,15 @@ func PutTask(c *gin.Context) {
 	} else if reqBody.RunType == constants.RunTypeRandom {
 		// 随机
 		t := model.Task{
-			SpiderId:   reqBody.SpiderId,
-			Param:      reqBody.Param,
-			UserId:     services.GetCurrentUserId(c),
-			RunType:    constants.RunTypeRandom,
-			ScheduleId: bson.ObjectIdHex(constants.ObjectIdNull),
+			SpiderId:      reqBody.SpiderId,
+			Param:         reqBody.Param,
+			UserId:        services.GetCurrentUserId(c),
+			RunType:       constants.RunTypeRandom,
+			ScheduleId:    bson.ObjectIdHex(constants.ObjectIdNull),
+			Timeout:       reqBody.Timeout,
+			Priority:      reqBody.Priority,
+			SpiderVersion: reqBody.Version,
+			LabelSelector: reqBody.Selector,
 		}
 		id, err := services.AddTask(t)
 		if err != nil {
@@ -154,12 +256,15 @@ func PutTask(c *gin.Context) {
 		// 指定节点
 		for _, nodeId := range reqBody.NodeIds {
 			t := model.Task{
-				SpiderId:   reqBody.SpiderId,
-				NodeId:     nodeId,
-				Param:      reqBody.Param,
-				UserId:     services.GetCurrentUserId(c),
-				RunType:    constants.RunTypeSelectedNodes,
-				ScheduleId: bson.ObjectIdHex(constants.ObjectIdNull),
+				SpiderId:      reqBody.SpiderId,
+				NodeId:        nodeId,
+				Param:         reqBody.Param,
+				UserId:        services.GetCurrentUserId(c),
+				RunType:       constants.RunTypeSelectedNodes,
+				ScheduleId:    bson.ObjectIdHex(constants.ObjectIdNull),
+				Timeout:       reqBody.Timeout,
+				Priority:      reqBody.Priority,
+				SpiderVersion: reqBody.Version,
 			}
 
 			id, err := services.AddTask(t)
@@ -238,6 +343,8 @@ func GetTaskLog(c *gin.Context) {
 		PageNum  int    `form:"page_num"`
 		PageSize int    `form:"page_size"`
 		Keyword  string `form:"keyword"`
+		Level    string `form:"level"`  // 日志级别，多个用逗号分隔
+		Stream   string `form:"stream"` // 输出流 stdout/stderr，多个用逗号分隔
 	}
 	id := c.Param("id")
 	var reqData RequestData
@@ -245,7 +352,7 @@ func GetTaskLog(c *gin.Context) {
 		HandleErrorF(http.StatusBadRequest, c, "invalid request")
 		return
 	}
-	logItems, logTotal, err := services.GetTaskLog(id, reqData.Keyword, reqData.PageNum, reqData.PageSize)
+	logItems, logTotal, err := services.GetTaskLog(id, reqData.Keyword, splitQueryList(reqData.Level), splitQueryList(reqData.Stream), reqData.PageNum, reqData.PageSize)
 	if err != nil {
 		HandleError(http.StatusInternalServerError, c, err)
 		return
@@ -258,6 +365,57 @@ func GetTaskLog(c *gin.Context) {
 	})
 }
 
+// 实时任务日志（Server-Sent Events），从 seq 参数或 Last-Event-ID 之后开始推送
+func StreamTaskLog(c *gin.Context) {
+	id := c.Param("id")
+
+	if _, err := model.GetTask(id); err != nil {
+		HandleError(http.StatusNotFound, c, err)
+		return
+	}
+
+	seqStr := c.GetHeader("Last-Event-ID")
+	if seqStr == "" {
+		seqStr = c.Query("seq")
+	}
+	var seq int64
+	if seqStr != "" {
+		var err error
+		seq, err = strconv.ParseInt(seqStr, 10, 64)
+		if err != nil {
+			HandleErrorF(http.StatusBadRequest, c, "invalid seq")
+			return
+		}
+	}
+
+	ch, err := services.StreamTaskLog(c.Request.Context(), id, seq)
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	// 定时发送心跳，避免代理断开连接
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case l, ok := <-ch:
+			if !ok {
+				c.Render(-1, sse.Event{Event: constants.TaskLogStreamEnd, Data: id})
+				return false
+			}
+			c.Render(-1, sse.Event{Id: strconv.FormatInt(l.Seq, 10), Event: constants.TaskLogStreamLog, Data: l})
+		case <-heartbeat.C:
+			c.SSEvent("ping", "")
+		}
+		return true
+	})
+}
+
 func GetTaskErrorLog(c *gin.Context) {
 	id := c.Param("id")
 	u := services.GetCurrentUser(c)
@@ -305,7 +463,8 @@ func GetTaskResults(c *gin.Context) {
 	})
 }
 
-func DownloadTaskResultsCsv(c *gin.Context) {
+// 下载任务结果，format 可选 csv/jsonl/xlsx/parquet，默认为 csv
+func DownloadTaskResults(c *gin.Context) {
 	id := c.Param("id")
 
 	// 获取任务
@@ -315,63 +474,35 @@ func DownloadTaskResultsCsv(c *gin.Context) {
 		return
 	}
 
-	// 获取结果
-	results, _, err := task.GetResults(1, constants.Infinite)
+	// 获取爬虫
+	spider, err := task.GetSpider()
 	if err != nil {
 		HandleError(http.StatusInternalServerError, c, err)
 		return
 	}
 
-	// 字段列表
-	var columns []string
-	if len(results) == 0 {
-		columns = []string{}
-	} else {
-		item := results[0].(bson.M)
-		for key := range item {
-			columns = append(columns, key)
-		}
-	}
-
-	// 缓冲
-	bytesBuffer := &bytes.Buffer{}
-
-	// 写入UTF-8 BOM，避免使用Microsoft Excel打开乱码
-	bytesBuffer.WriteString("\xEF\xBB\xBF")
-
-	writer := csv.NewWriter(bytesBuffer)
+	col := utils.GetSpiderCol(spider.Col, spider.Name)
+	exportResults(c, col, bson.M{"task_id": task.Id}, "task_"+task.Id)
+}
 
-	// 写入表头
-	if err := writer.Write(columns); err != nil {
-		HandleError(http.StatusInternalServerError, c, err)
+// 流式导出结果
+func exportResults(c *gin.Context, col string, query bson.M, filename string) {
+	format := c.DefaultQuery("format", result_export.FormatCsv)
+	if err := result_export.ValidateFormat(format); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
 		return
 	}
 
-	// 写入内容
-	for _, result := range results {
-		// 将result转换为[]string
-		item := result.(bson.M)
-		var values []string
-		for _, col := range columns {
-			value := utils.InterfaceToString(item[col])
-			values = append(values, value)
-		}
+	// 设置下载的文件名和文件类型
+	c.Header("Content-Disposition", "attachment;filename="+filename+"."+result_export.GetFileExtension(format))
+	c.Header("Content-Type", result_export.GetContentType(format))
+	c.Status(http.StatusOK)
 
-		// 写入数据
-		if err := writer.Write(values); err != nil {
-			HandleError(http.StatusInternalServerError, c, err)
-			return
-		}
+	// 已经开始输出，出错时只能中断
+	if err := result_export.ExportResults(c.Writer, format, col, query); err != nil {
+		log.Errorf("export results error: %s", err.Error())
+		debug.PrintStack()
 	}
-
-	// 此时才会将缓冲区数据写入
-	writer.Flush()
-
-	// 设置下载的文件名
-	c.Writer.Header().Set("Content-Disposition", "attachment;filename=data.csv")
-
-	// 设置文件类型以及输出数据
-	c.Data(http.StatusOK, "text/csv", bytesBuffer.Bytes())
 }
 
 func CancelTask(c *gin.Context) {
@@ -9,6 +9,14 @@ import (
 	"time"
 )
 
+type TokenRequestData struct {
+	Name       string          `json:"name"`
+	Scopes     []string        `json:"scopes"`
+	ProjectIds []bson.ObjectId `json:"project_ids"`
+	SpiderIds  []bson.ObjectId `json:"spider_ids"`
+	ExpireDays int             `json:"expire_days"` // 有效天数，0 表示永不过期
+}
+
 func GetTokens(c *gin.Context) {
 	u := services.GetCurrentUser(c)
 
@@ -28,19 +36,46 @@ func GetTokens(c *gin.Context) {
 func PutToken(c *gin.Context) {
 	u := services.GetCurrentUser(c)
 
-	tokenStr, err := services.MakeToken(u)
-	if err != nil {
-		HandleError(http.StatusInternalServerError, c, err)
+	var reqData TokenRequestData
+	if err := c.ShouldBindJSON(&reqData); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	// 校验参数
+	if reqData.Name == "" {
+		HandleErrorF(http.StatusBadRequest, c, "name should not be empty")
+		return
+	}
+	if err := services.ValidateTokenScopes(reqData.Scopes); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+	if reqData.ExpireDays < 0 {
+		HandleErrorF(http.StatusBadRequest, c, "invalid expire_days")
 		return
 	}
 
 	t := model.Token{
-		Id:       bson.NewObjectId(),
-		Token:    tokenStr,
-		UserId:   u.Id,
-		CreateTs: time.Now(),
-		UpdateTs: time.Now(),
+		Id:         bson.NewObjectId(),
+		Name:       reqData.Name,
+		Scopes:     reqData.Scopes,
+		ProjectIds: reqData.ProjectIds,
+		SpiderIds:  reqData.SpiderIds,
+		UserId:     u.Id,
+		CreateTs:   time.Now(),
+		UpdateTs:   time.Now(),
+	}
+	if reqData.ExpireDays > 0 {
+		t.ExpireTs = time.Now().AddDate(0, 0, reqData.ExpireDays)
+	}
+
+	tokenStr, err := services.MakeApiToken(u, t)
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
 	}
+	t.Token = tokenStr
 
 	if err := t.Add(); err != nil {
 		HandleError(http.StatusInternalServerError, c, err)
@@ -50,13 +85,30 @@ func PutToken(c *gin.Context) {
 	c.JSON(http.StatusOK, Response{
 		Status:  "ok",
 		Message: "success",
+		Data:    t,
 	})
 }
 
 func DeleteToken(c *gin.Context) {
 	id := c.Param("id")
 
-	if err := model.DeleteTokenById(bson.ObjectIdHex(id)); err != nil {
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	// 只能删除自己的 Token
+	t, err := model.GetTokenById(bson.ObjectIdHex(id))
+	if err != nil {
+		HandleErrorF(http.StatusNotFound, c, "token not found")
+		return
+	}
+	if t.UserId != services.GetCurrentUserId(c) {
+		HandleErrorF(http.StatusForbidden, c, "cannot delete token of other users")
+		return
+	}
+
+	if err := t.Delete(); err != nil {
 		HandleError(http.StatusInternalServerError, c, err)
 		return
 	}
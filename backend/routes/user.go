@@ -25,6 +25,19 @@ type UserRequestData struct {
 	Email    string `json:"email"`
 }
 
+type RefreshTokenRequestData struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// 登录返回，data 为登录 token
+type LoginResponse struct {
+	Status       string `json:"status"`
+	Message      string `json:"message"`
+	Data         string `json:"data"`
+	RefreshToken string `json:"refresh_token"`
+	Error        string `json:"error"`
+}
+
 func GetUser(c *gin.Context) {
 	id := c.Param("id")
 
@@ -132,6 +145,11 @@ func PostUser(c *gin.Context) {
 		item.UserId = bson.ObjectIdHex(constants.ObjectIdNull)
 	}
 
+	if err := services.ValidateGlobalPermissions(item.Permissions); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
 	if err := model.UpdateUser(bson.ObjectIdHex(id), item); err != nil {
 		HandleError(http.StatusInternalServerError, c, err)
 		return
@@ -157,6 +175,12 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
+	// 删除用户的项目角色
+	if err := model.RemoveUserProjectMembers(bson.ObjectIdHex(id)); err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
 	c.JSON(http.StatusOK, Response{
 		Status:  "ok",
 		Message: "success",
@@ -192,13 +216,58 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, Response{
-		Status:  "ok",
-		Message: "success",
-		Data:    tokenStr,
+	// 获取刷新token
+	refreshTokenStr, err := services.MakeRefreshToken(&user)
+	if err != nil {
+		HandleError(http.StatusUnauthorized, c, errors.New("not authorized"))
+		return
+	}
+
+	c.JSON(http.StatusOK, LoginResponse{
+		Status:       "ok",
+		Message:      "success",
+		Data:         tokenStr,
+		RefreshToken: refreshTokenStr,
+	})
+}
+
+func RefreshToken(c *gin.Context) {
+	var reqData RefreshTokenRequestData
+	if err := c.ShouldBindJSON(&reqData); err != nil {
+		HandleError(http.StatusUnauthorized, c, errors.New("not authorized"))
+		return
+	}
+
+	tokenStr, refreshTokenStr, err := services.RefreshToken(reqData.RefreshToken)
+	if err != nil {
+		HandleError(http.StatusUnauthorized, c, errors.New("not authorized"))
+		return
+	}
+
+	c.JSON(http.StatusOK, LoginResponse{
+		Status:       "ok",
+		Message:      "success",
+		Data:         tokenStr,
+		RefreshToken: refreshTokenStr,
 	})
 }
 
+// 登出，使刷新 token 失效
+func Logout(c *gin.Context) {
+	var reqData RefreshTokenRequestData
+	if err := c.ShouldBindJSON(&reqData); err != nil {
+		HandleErrorF(http.StatusBadRequest, c, "invalid request")
+		return
+	}
+
+	if err := services.RevokeRefreshToken(reqData.RefreshToken); err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	HandleSuccess(c)
+}
+
 func GetMe(c *gin.Context) {
 	ctx := context.WithGinContext(c)
 	user := ctx.User()
@@ -256,6 +325,15 @@ func PostMe(c *gin.Context) {
 		HandleError(http.StatusInternalServerError, c, err)
 		return
 	}
+
+	// 修改密码后已签发的刷新 token 失效
+	if reqBody.Password != "" {
+		if err := model.RemoveUserRefreshTokens(user.Id); err != nil {
+			HandleError(http.StatusInternalServerError, c, err)
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, Response{
 		Status:  "ok",
 		Message: "success",
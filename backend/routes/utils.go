@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"runtime/debug"
+	"strings"
 )
 
 func HandleError(statusCode int, c *gin.Context, err error) {
@@ -37,3 +38,14 @@ func HandleSuccessData(c *gin.Context, data interface{}) {
 		Data:    data,
 	})
 }
+
+// 解析逗号分隔的查询参数，忽略空值
+func splitQueryList(str string) []string {
+	var list []string
+	for _, item := range strings.Split(str, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -58,5 +58,10 @@ func DeleteVariable(c *gin.Context) {
 // 列表
 func GetVariableList(c *gin.Context) {
 	list := model.GetVariableList()
+
+	// 加密变量不返回值
+	for i := range list {
+		list[i] = list[i].Masked()
+	}
 	HandleSuccessData(c, list)
 }
@@ -0,0 +1,354 @@
+package routes
+
+import (
+	"crawlab/constants"
+	"crawlab/model"
+	"crawlab/services"
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+	"net/http"
+)
+
+type WorkflowRunListRequestData struct {
+	PageNum  int    `form:"page_num"`
+	PageSize int    `form:"page_size"`
+	Status   string `form:"status"`
+}
+
+// @Summary Get workflow list
+// @Description Get workflow list
+// @Tags workflow
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /workflows [get]
+func GetWorkflowList(c *gin.Context) {
+	query := bson.M{}
+
+	// 获取校验
+	query = services.GetWorkflowAuthQuery(query, c)
+
+	workflows, err := model.GetWorkflowList(query, 0, 0, "-_id")
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	total, err := model.GetWorkflowListTotal(query)
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ListResponse{
+		Status:  "ok",
+		Message: "success",
+		Data:    workflows,
+		Total:   total,
+	})
+}
+
+// @Summary Get workflow
+// @Description Get workflow
+// @Tags workflow
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "workflow id"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /workflows/{id} [get]
+func GetWorkflow(c *gin.Context) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	w, err := model.GetWorkflow(bson.ObjectIdHex(id))
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+	HandleSuccessData(c, w)
+}
+
+// @Summary Put workflow
+// @Description Put workflow
+// @Tags workflow
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param item body model.Workflow true "workflow item"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /workflows [put]
+func PutWorkflow(c *gin.Context) {
+	var item model.Workflow
+	if err := c.ShouldBindJSON(&item); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	// 校验工作流
+	if err := services.ValidateWorkflow(item); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	// UserId
+	item.UserId = services.GetCurrentUserId(c)
+
+	if err := item.Add(); err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	HandleSuccessData(c, item)
+}
+
+// @Summary Post workflow
+// @Description Post workflow
+// @Tags workflow
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "workflow id"
+// @Param item body model.Workflow true "workflow item"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /workflows/{id} [post]
+func PostWorkflow(c *gin.Context) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	var item model.Workflow
+	if err := c.ShouldBindJSON(&item); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	// 校验工作流
+	if err := services.ValidateWorkflow(item); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+
+	if err := model.UpdateWorkflow(bson.ObjectIdHex(id), item); err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	HandleSuccess(c)
+}
+
+// @Summary Delete workflow
+// @Description Delete workflow
+// @Tags workflow
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "workflow id"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /workflows/{id} [delete]
+func DeleteWorkflow(c *gin.Context) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	if err := model.RemoveWorkflow(bson.ObjectIdHex(id)); err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	// 删除执行记录
+	if err := model.RemoveWorkflowRunsByWorkflowId(bson.ObjectIdHex(id)); err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	HandleSuccess(c)
+}
+
+// @Summary Run workflow
+// @Description Run workflow
+// @Tags workflow
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "workflow id"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /workflows/{id}/run [post]
+func RunWorkflow(c *gin.Context) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	w, err := model.GetWorkflow(bson.ObjectIdHex(id))
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	// 需要有工作流中所有爬虫的运行权限
+	ok, err := services.CheckWorkflowStepsPermission(services.GetCurrentUser(c), services.GetCurrentToken(c), w.Steps, constants.PermissionSpiderRun)
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+	if !ok {
+		HandleErrorF(http.StatusForbidden, c, "permission denied: "+constants.PermissionSpiderRun)
+		return
+	}
+
+	run, err := services.RunWorkflow(w, services.GetCurrentUserId(c))
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	HandleSuccessData(c, run.Id)
+}
+
+// @Summary Get workflow run list
+// @Description Get workflow run list
+// @Tags workflow
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "workflow id"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /workflows/{id}/runs [get]
+func GetWorkflowRunList(c *gin.Context) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	data := WorkflowRunListRequestData{}
+	if err := c.ShouldBindQuery(&data); err != nil {
+		HandleError(http.StatusBadRequest, c, err)
+		return
+	}
+	if data.PageNum == 0 {
+		data.PageNum = 1
+	}
+	if data.PageSize == 0 {
+		data.PageSize = 10
+	}
+
+	query := bson.M{
+		"workflow_id": bson.ObjectIdHex(id),
+	}
+	if data.Status != "" {
+		query["status"] = data.Status
+	}
+
+	runs, err := model.GetWorkflowRunList(query, (data.PageNum-1)*data.PageSize, data.PageSize, "-create_ts")
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	total, err := model.GetWorkflowRunListTotal(query)
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ListResponse{
+		Status:  "ok",
+		Message: "success",
+		Data:    runs,
+		Total:   total,
+	})
+}
+
+// @Summary Get workflow run
+// @Description Get workflow run with its tasks
+// @Tags workflow
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "workflow run id"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /workflow_runs/{id} [get]
+func GetWorkflowRun(c *gin.Context) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	run, err := model.GetWorkflowRun(bson.ObjectIdHex(id))
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	// 子任务
+	tasks, err := run.GetTasks()
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+	run.Tasks = tasks
+
+	HandleSuccessData(c, run)
+}
+
+// @Summary Cancel workflow run
+// @Description Cancel workflow run
+// @Tags workflow
+// @Produce json
+// @Param Authorization header string true "Authorization token"
+// @Param id path string true "workflow run id"
+// @Success 200 json string Response
+// @Failure 500 json string Response
+// @Router /workflow_runs/{id}/cancel [post]
+func CancelWorkflowRun(c *gin.Context) {
+	id := c.Param("id")
+
+	if !bson.IsObjectIdHex(id) {
+		HandleErrorF(http.StatusBadRequest, c, "invalid id")
+		return
+	}
+
+	run, err := model.GetWorkflowRun(bson.ObjectIdHex(id))
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	// 需要有工作流中所有爬虫的运行权限
+	ok, err := services.CheckWorkflowStepsPermission(services.GetCurrentUser(c), services.GetCurrentToken(c), run.Definition, constants.PermissionSpiderRun)
+	if err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+	if !ok {
+		HandleErrorF(http.StatusForbidden, c, "permission denied: "+constants.PermissionSpiderRun)
+		return
+	}
+
+	if err := services.CancelWorkflowRun(bson.ObjectIdHex(id)); err != nil {
+		HandleError(http.StatusInternalServerError, c, err)
+		return
+	}
+
+	HandleSuccess(c)
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"crawlab/constants"
+	"crawlab/database"
+	"crawlab/model"
+	"encoding/json"
+	"github.com/apex/log"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/spf13/viper"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// 审计日志中脱敏后的值
+const auditMaskedValue = "******"
+
+// 不记录变更的字段
+var auditIgnoredFields = map[string]bool{
+	"update_ts": true,
+}
+
+// 请求参数中不记录的字段（包括嵌套对象中的字段，如 result_sinks[].secret_key）
+var auditDetailIgnoredKeys = map[string]bool{
+	"password":     true,
+	"token":        true,
+	"content":      true,
+	"value":        true,
+	"git_password": true,
+	"secret_key":   true,
+	"dsn":          true,
+}
+
+func InitAuditService() error {
+	s, c := database.GetCol("audit_logs")
+	defer s.Close()
+
+	// 过期的审计日志由 MongoDB 自动删除
+	if err := c.EnsureIndex(mgo.Index{
+		Key:         []string{"expire_ts"},
+		Sparse:      true,
+		ExpireAfter: 0 * time.Second,
+	}); err != nil {
+		log.Errorf("ensure audit log index error: %s", err.Error())
+		return err
+	}
+	_ = c.EnsureIndex(mgo.Index{
+		Key: []string{"-create_ts"},
+	})
+	_ = c.EnsureIndex(mgo.Index{
+		Key: []string{"user_id", "-create_ts"},
+	})
+	_ = c.EnsureIndex(mgo.Index{
+		Key: []string{"resource_type", "resource_id", "-create_ts"},
+	})
+	return nil
+}
+
+// 审计日志保留天数，0 表示永久保留
+func GetAuditRetentionDays() int {
+	if !viper.IsSet("audit.retentionDays") {
+		return constants.AuditRetentionDaysDefault
+	}
+	return viper.GetInt("audit.retentionDays")
+}
+
+func AddAuditLog(l model.AuditLog) error {
+	if days := GetAuditRetentionDays(); days > 0 {
+		l.ExpireTs = time.Now().AddDate(0, 0, days)
+	}
+	return l.Add()
+}
+
+// 比较资源变更前后的字段
+func DiffAuditSnapshots(before bson.M, after bson.M, maskedFields []string) []model.AuditLogChange {
+	masked := map[string]bool{}
+	for _, f := range maskedFields {
+		masked[f] = true
+	}
+
+	fieldSet := map[string]bool{}
+	for k := range before {
+		fieldSet[k] = true
+	}
+	for k := range after {
+		fieldSet[k] = true
+	}
+	var fields []string
+	for k := range fieldSet {
+		if !auditIgnoredFields[k] {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []model.AuditLogChange{}
+	for _, f := range fields {
+		beforeValue, beforeOk := before[f]
+		afterValue, afterOk := after[f]
+		if beforeOk == afterOk && reflect.DeepEqual(beforeValue, afterValue) {
+			continue
+		}
+		if masked[f] {
+			if beforeOk {
+				beforeValue = auditMaskedValue
+			}
+			if afterOk {
+				afterValue = auditMaskedValue
+			}
+		}
+		changes = append(changes, model.AuditLogChange{
+			Field:  f,
+			Before: beforeValue,
+			After:  afterValue,
+		})
+	}
+	return changes
+}
+
+// 脱敏并截断请求参数
+func GetAuditDetail(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return ""
+	}
+	removeAuditDetailIgnoredKeys(data)
+
+	detail, err := json.Marshal(data)
+	if err != nil {
+		return ""
+	}
+	if len(detail) > constants.AuditDetailMaxLength {
+		return string(detail[:constants.AuditDetailMaxLength]) + "..."
+	}
+	return string(detail)
+}
+
+// 递归删除请求参数中不记录的字段
+func removeAuditDetailIgnoredKeys(data interface{}) {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			if auditDetailIgnoredKeys[k] {
+				delete(v, k)
+				continue
+			}
+			removeAuditDetailIgnoredKeys(item)
+		}
+	case []interface{}:
+		for _, item := range v {
+			removeAuditDetailIgnoredKeys(item)
+		}
+	}
+}
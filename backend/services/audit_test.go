@@ -0,0 +1,37 @@
+package services
+
+import (
+	"github.com/globalsign/mgo/bson"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestDiffAuditSnapshots(t *testing.T) {
+	Convey("Test DiffAuditSnapshots", t, func() {
+		before := bson.M{"name": "a", "cmd": "python main.py", "password": "x", "update_ts": 1}
+		after := bson.M{"name": "a", "cmd": "scrapy crawl a", "password": "y", "col": "results", "update_ts": 2}
+
+		changes := DiffAuditSnapshots(before, after, []string{"password"})
+		So(len(changes), ShouldEqual, 3)
+		So(changes[0].Field, ShouldEqual, "cmd")
+		So(changes[0].Before, ShouldEqual, "python main.py")
+		So(changes[0].After, ShouldEqual, "scrapy crawl a")
+		So(changes[1].Field, ShouldEqual, "col")
+		So(changes[1].Before, ShouldBeNil)
+		So(changes[2].Field, ShouldEqual, "password")
+		So(changes[2].After, ShouldEqual, auditMaskedValue)
+
+		// 删除时记录所有字段
+		changes = DiffAuditSnapshots(before, nil, nil)
+		So(len(changes), ShouldEqual, 3)
+	})
+}
+
+func TestGetAuditDetail(t *testing.T) {
+	Convey("Test GetAuditDetail", t, func() {
+		So(GetAuditDetail([]byte(`{"username":"a","password":"secret"}`)), ShouldEqual, `{"username":"a"}`)
+		So(GetAuditDetail([]byte(`{"result_sinks":[{"type":"s3","secret_key":"k","dsn":"d"}]}`)), ShouldEqual, `{"result_sinks":[{"type":"s3"}]}`)
+		So(GetAuditDetail([]byte(`not json`)), ShouldEqual, "")
+		So(GetAuditDetail(nil), ShouldEqual, "")
+	})
+}
@@ -6,15 +6,27 @@ import (
 	"github.com/globalsign/mgo/bson"
 )
 
+// 任务、定时任务列表的权限筛选，普通用户可以看到自己的数据和有角色的项目中爬虫的数据
 func GetAuthQuery(query bson.M, c *gin.Context) bson.M {
+	return getAuthQuery(query, c, "spider_id")
+}
+
+// 工作流列表的权限筛选，普通用户可以看到自己的工作流和包含有角色的项目中爬虫的工作流
+func GetWorkflowAuthQuery(query bson.M, c *gin.Context) bson.M {
+	return getAuthQuery(query, c, "steps.spider_id")
+}
+
+func getAuthQuery(query bson.M, c *gin.Context, spiderIdKey string) bson.M {
 	user := GetCurrentUser(c)
 	if user.Role == constants.RoleAdmin {
 		// 获得所有数据
 		return query
 	} else {
-		// 只获取自己的数据
-		query["user_id"] = user.Id
+		// 获取自己的数据和所在项目的数据
+		query["$or"] = []bson.M{
+			{"user_id": user.Id},
+			{spiderIdKey: bson.M{"$in": GetUserProjectSpiderIds(user)}},
+		}
 		return query
 	}
 }
-
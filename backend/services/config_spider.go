@@ -2,7 +2,6 @@ package services
 
 import (
 	"crawlab/constants"
-	"crawlab/database"
 	"crawlab/entity"
 	"crawlab/model"
 	"crawlab/model/config_spider"
@@ -11,13 +10,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/apex/log"
-	"github.com/globalsign/mgo/bson"
 	uuid "github.com/satori/go.uuid"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v2"
 	"os"
 	"path/filepath"
-	"runtime/debug"
 	"strings"
 )
 
@@ -207,30 +204,22 @@ func ProcessSpiderFilesFromConfigData(spider model.Spider, configData entity.Con
 		return err
 	}
 
-	// 获取 GridFS 实例
-	s, gf := database.GetGridFs("files")
-	defer s.Close()
-
-	// 判断文件是否已经存在
-	var gfFile model.GridFs
-	if err := gf.Find(bson.M{"filename": spiderZipFileName}).One(&gfFile); err == nil {
-		// 已经存在文件，则删除
-		if err := gf.RemoveId(gfFile.Id); err != nil {
-			log.Errorf("remove grid fs error: %s", err.Error())
-			debug.PrintStack()
-			return err
-		}
-	}
-
-	// 上传到GridFs
+	// 上传到GridFs（保留历史版本的文件）
 	fid, err := UploadToGridFs(spiderZipFileName, tmpFilePath)
 	if err != nil {
 		log.Errorf("upload to grid fs error: %s", err.Error())
 		return err
 	}
 
+	// 记录版本
+	v, err := AddSpiderVersion(spider, fid, spider.UserId, "")
+	if err != nil {
+		return err
+	}
+
 	// 保存爬虫 FileId
 	spider.FileId = fid
+	spider.Version = v.Version
 	_ = spider.Save()
 
 	// 获取爬虫同步实例
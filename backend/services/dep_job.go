@@ -0,0 +1,150 @@
+package services
+
+import (
+	"crawlab/constants"
+	"crawlab/entity"
+	"crawlab/model"
+	"crawlab/services/rpc"
+	"errors"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/globalsign/mgo/bson"
+	"github.com/spf13/viper"
+	"sync"
+	"time"
+)
+
+// 依赖安装任务请求
+type DepJobRequest struct {
+	Type     string          `json:"type"`
+	Lang     string          `json:"lang"`
+	DepName  string          `json:"dep_name"`
+	NodeIds  []bson.ObjectId `json:"node_ids"`
+	AllNodes bool            `json:"all_nodes"` // 在所有在线节点上执行
+}
+
+// 单个节点安装超时（秒）
+func getDepJobTimeout() int {
+	if timeout := viper.GetInt("deps.installTimeout"); timeout > 0 {
+		return timeout
+	}
+	return constants.DepJobTimeoutDefault
+}
+
+// 创建依赖安装任务
+func CreateDepJob(req DepJobRequest, user *model.User) (model.DepJob, error) {
+	switch req.Type {
+	case constants.DepJobTypeInstallDep, constants.DepJobTypeUninstallDep:
+		if req.DepName == "" {
+			return model.DepJob{}, errors.New("dep_name should not be empty")
+		}
+	case constants.DepJobTypeInstallLang:
+	default:
+		return model.DepJob{}, errors.New("invalid dep job type: " + req.Type)
+	}
+
+	// 目标节点
+	var nodes []model.Node
+	var err error
+	if req.AllNodes {
+		nodes, err = model.GetNodeList(bson.M{"status": constants.StatusOnline})
+	} else {
+		nodes, err = model.GetNodeList(bson.M{"_id": bson.M{"$in": req.NodeIds}})
+	}
+	if err != nil {
+		return model.DepJob{}, err
+	}
+	if len(nodes) == 0 {
+		return model.DepJob{}, errors.New("no node is selected")
+	}
+
+	job := model.DepJob{
+		Type:    req.Type,
+		Lang:    req.Lang,
+		DepName: req.DepName,
+		Status:  constants.DepJobStatusRunning,
+	}
+	if user != nil {
+		job.UserId = user.Id
+		job.Username = user.Username
+	}
+	for _, node := range nodes {
+		job.Nodes = append(job.Nodes, model.DepJobNode{
+			NodeId:   node.Id,
+			NodeName: node.Name,
+			Status:   constants.DepJobStatusPending,
+		})
+	}
+	if err := job.Add(); err != nil {
+		return job, err
+	}
+	return job, nil
+}
+
+// 在所有目标节点上并行执行依赖安装任务，等待全部完成
+func RunDepJob(job model.DepJob) (model.DepJob, error) {
+	var wg sync.WaitGroup
+	for _, n := range job.Nodes {
+		wg.Add(1)
+		go func(n model.DepJobNode) {
+			defer wg.Done()
+			runDepJobNode(job, n)
+		}(n)
+	}
+	wg.Wait()
+
+	return model.FinishDepJob(job.Id)
+}
+
+func runDepJobNode(job model.DepJob, n model.DepJobNode) {
+	n.Status = constants.DepJobStatusRunning
+	n.StartTs = time.Now()
+	_ = model.UpdateDepJobNode(job.Id, n)
+
+	output, err := execDepJob(job, n.NodeId.Hex())
+
+	n.Stdout = truncateDepJobOutput(output.Stdout)
+	n.Stderr = truncateDepJobOutput(output.Stderr)
+	n.FinishTs = time.Now()
+	n.Duration = n.FinishTs.Sub(n.StartTs).Seconds()
+	if err != nil {
+		log.Errorf("dep job error: %s, job_id: %s, node_id: %s", err.Error(), job.Id.Hex(), n.NodeId.Hex())
+		n.Status = constants.DepJobStatusError
+		n.Error = err.Error()
+	} else {
+		n.Status = constants.DepJobStatusFinished
+	}
+	_ = model.UpdateDepJobNode(job.Id, n)
+}
+
+// 在本地或通过 RPC 在远端节点执行
+func execDepJob(job model.DepJob, nodeId string) (entity.CmdOutput, error) {
+	isMaster := IsMasterNode(nodeId)
+	timeout := getDepJobTimeout()
+	switch job.Type {
+	case constants.DepJobTypeInstallDep:
+		if isMaster {
+			return rpc.InstallDepLocal(job.Lang, job.DepName)
+		}
+		return rpc.InstallDepRemote(nodeId, job.Lang, job.DepName, timeout)
+	case constants.DepJobTypeUninstallDep:
+		if isMaster {
+			return rpc.UninstallDepLocal(job.Lang, job.DepName)
+		}
+		return rpc.UninstallDepRemote(nodeId, job.Lang, job.DepName, timeout)
+	case constants.DepJobTypeInstallLang:
+		if isMaster {
+			return rpc.InstallLangLocal(job.Lang)
+		}
+		return rpc.InstallLangRemote(nodeId, job.Lang, timeout)
+	}
+	return entity.CmdOutput{}, errors.New(fmt.Sprintf("invalid dep job type: %s", job.Type))
+}
+
+// 只保留输出的最后一部分
+func truncateDepJobOutput(str string) string {
+	if len(str) <= constants.DepJobOutputMaxSize {
+		return str
+	}
+	return "...\n" + str[len(str)-constants.DepJobOutputMaxSize:]
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"crawlab/constants"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestDepJob(t *testing.T) {
+	Convey("Test CreateDepJob validation", t, func() {
+		_, err := CreateDepJob(DepJobRequest{Type: "unknown"}, nil)
+		So(err, ShouldNotBeNil)
+
+		_, err = CreateDepJob(DepJobRequest{Type: constants.DepJobTypeInstallDep, Lang: constants.Python}, nil)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test truncateDepJobOutput", t, func() {
+		So(truncateDepJobOutput("ok"), ShouldEqual, "ok")
+
+		output := strings.Repeat("a", constants.DepJobOutputMaxSize) + "end"
+		truncated := truncateDepJobOutput(output)
+		So(strings.HasPrefix(truncated, "...\n"), ShouldBeTrue)
+		So(strings.HasSuffix(truncated, "end"), ShouldBeTrue)
+		So(len(truncated), ShouldEqual, constants.DepJobOutputMaxSize+4)
+	})
+}
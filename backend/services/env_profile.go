@@ -0,0 +1,382 @@
+package services
+
+import (
+	"crawlab/constants"
+	"crawlab/entity"
+	"crawlab/lib/cron"
+	"crawlab/model"
+	"crawlab/services/rpc"
+	"crawlab/utils"
+	"errors"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/globalsign/mgo/bson"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 依赖偏差
+type EnvPackageDrift struct {
+	Lang      string `json:"lang"`
+	Name      string `json:"name"`
+	Expected  string `json:"expected"`  // 环境配置中的版本
+	Installed string `json:"installed"` // 节点上已安装的版本
+}
+
+// 节点相对环境配置的偏差
+type EnvProfileDrift struct {
+	ProfileId         bson.ObjectId     `json:"profile_id"`
+	ProfileName       string            `json:"profile_name"`
+	NodeId            bson.ObjectId     `json:"node_id"`
+	NodeName          string            `json:"node_name"`
+	InSync            bool              `json:"in_sync"`
+	MissingLangs      []string          `json:"missing_langs"`
+	MissingPackages   []EnvPackageDrift `json:"missing_packages"`
+	VersionMismatches []EnvPackageDrift `json:"version_mismatches"`
+	Error             string            `json:"error"`
+	CheckTs           time.Time         `json:"check_ts"`
+}
+
+// 正在修复的节点，key 为 环境配置ID:节点ID
+var reconcilingEnvNodes sync.Map
+
+// 校验环境配置
+func ValidateEnvProfile(p model.EnvProfile) error {
+	if p.Name == "" {
+		return errors.New("name should not be empty")
+	}
+	for _, lang := range p.Langs {
+		if utils.GetLangFromLangNamePlain(lang).Name == "" {
+			return errors.New("invalid lang: " + lang)
+		}
+	}
+	for _, pkg := range p.Packages {
+		if pkg.Lang != constants.Python && pkg.Lang != constants.Nodejs {
+			return errors.New("invalid package lang: " + pkg.Lang)
+		}
+		if pkg.Name == "" {
+			return errors.New("package name should not be empty")
+		}
+	}
+	return nil
+}
+
+// 获取环境配置分配的节点（按节点ID或节点标签）
+func GetEnvProfileNodes(p model.EnvProfile) ([]model.Node, error) {
+	var or []bson.M
+	if len(p.NodeIds) > 0 {
+		or = append(or, bson.M{"_id": bson.M{"$in": p.NodeIds}})
+	}
+	if len(p.NodeTags) > 0 {
+		or = append(or, bson.M{"tags": bson.M{"$in": p.NodeTags}})
+	}
+	if len(or) == 0 {
+		return []model.Node{}, nil
+	}
+	return model.GetNodeList(bson.M{"$or": or})
+}
+
+// 依赖名称规范化，pip 中 "_" 与 "-" 等价且不区分大小写
+func normalizeDepName(name string) string {
+	return strings.Replace(strings.ToLower(name), "_", "-", -1)
+}
+
+// 对比环境配置中的依赖与已安装依赖
+func compareEnvPackages(pkgs []model.EnvPackage, installed map[string][]entity.Dependency) (missing []EnvPackageDrift, mismatches []EnvPackageDrift) {
+	for _, pkg := range pkgs {
+		drift := EnvPackageDrift{
+			Lang:     pkg.Lang,
+			Name:     pkg.Name,
+			Expected: pkg.Version,
+		}
+
+		var dep *entity.Dependency
+		for i, d := range installed[pkg.Lang] {
+			if normalizeDepName(d.Name) == normalizeDepName(pkg.Name) {
+				dep = &installed[pkg.Lang][i]
+				break
+			}
+		}
+
+		if dep == nil {
+			missing = append(missing, drift)
+		} else if pkg.Version != "" && dep.Version != pkg.Version {
+			drift.Installed = dep.Version
+			mismatches = append(mismatches, drift)
+		}
+	}
+	return missing, mismatches
+}
+
+// 检查节点相对环境配置的偏差
+func CheckEnvProfileDrift(p model.EnvProfile, node model.Node) EnvProfileDrift {
+	drift := EnvProfileDrift{
+		ProfileId:   p.Id,
+		ProfileName: p.Name,
+		NodeId:      node.Id,
+		NodeName:    node.Name,
+		CheckTs:     time.Now(),
+	}
+
+	isLocal := IsMasterNode(node.Id.Hex())
+	if !isLocal && node.Status != constants.StatusOnline {
+		drift.Error = "node is offline"
+		return drift
+	}
+
+	// 语言
+	for _, lang := range p.Langs {
+		status, err := GetLangInstallStatus(node.Id.Hex(), utils.GetLangFromLangNamePlain(lang))
+		if err != nil {
+			drift.Error = err.Error()
+			return drift
+		}
+		if status != constants.InstallStatusInstalled {
+			drift.MissingLangs = append(drift.MissingLangs, lang)
+		}
+	}
+
+	// 依赖
+	installed := map[string][]entity.Dependency{}
+	for _, pkg := range p.Packages {
+		if _, ok := installed[pkg.Lang]; ok {
+			continue
+		}
+		var deps []entity.Dependency
+		var err error
+		if isLocal {
+			deps, err = rpc.GetInstalledDepsLocal(pkg.Lang)
+		} else {
+			deps, err = rpc.GetInstalledDepsRemote(node.Id.Hex(), pkg.Lang)
+		}
+		if err != nil {
+			drift.Error = err.Error()
+			return drift
+		}
+		installed[pkg.Lang] = deps
+	}
+	drift.MissingPackages, drift.VersionMismatches = compareEnvPackages(p.Packages, installed)
+
+	drift.InSync = len(drift.MissingLangs) == 0 && len(drift.MissingPackages) == 0 && len(drift.VersionMismatches) == 0
+	return drift
+}
+
+// 并行检查多个节点的偏差
+func CheckEnvProfileDriftList(p model.EnvProfile, nodes []model.Node) []EnvProfileDrift {
+	drifts := make([]EnvProfileDrift, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node model.Node) {
+			defer wg.Done()
+			drifts[i] = CheckEnvProfileDrift(p, node)
+		}(i, node)
+	}
+	wg.Wait()
+	return drifts
+}
+
+// 根据偏差在节点上安装缺失的语言和依赖，语言先于依赖安装
+// wait 为 false 时创建安装任务后立即返回，安装在后台执行
+func ReconcileEnvProfile(p model.EnvProfile, nodes []model.Node, user *model.User, wait bool) ([]model.DepJob, error) {
+	// 跳过正在修复的节点
+	var keys []string
+	var drifts []EnvProfileDrift
+	for _, drift := range CheckEnvProfileDriftList(p, nodes) {
+		if drift.Error != "" || drift.InSync {
+			continue
+		}
+		key := p.Id.Hex() + ":" + drift.NodeId.Hex()
+		if _, loaded := reconcilingEnvNodes.LoadOrStore(key, true); loaded {
+			continue
+		}
+		keys = append(keys, key)
+		drifts = append(drifts, drift)
+	}
+	release := func() {
+		for _, key := range keys {
+			reconcilingEnvNodes.Delete(key)
+		}
+	}
+
+	// 按语言和依赖汇总需要安装的节点
+	langNodes := map[string][]bson.ObjectId{}
+	pkgNodes := map[string][]bson.ObjectId{}
+	pkgMap := map[string]model.EnvPackage{}
+	for _, drift := range drifts {
+		for _, lang := range drift.MissingLangs {
+			langNodes[lang] = append(langNodes[lang], drift.NodeId)
+		}
+		for _, d := range append(drift.MissingPackages, drift.VersionMismatches...) {
+			pkg := model.EnvPackage{Lang: d.Lang, Name: d.Name, Version: d.Expected}
+			key := pkg.Lang + ":" + pkg.GetDepName()
+			pkgMap[key] = pkg
+			pkgNodes[key] = append(pkgNodes[key], drift.NodeId)
+		}
+	}
+
+	// 创建安装任务
+	var langJobs, pkgJobs []model.DepJob
+	for _, lang := range sortedKeys(langNodes) {
+		job, err := CreateDepJob(DepJobRequest{
+			Type:    constants.DepJobTypeInstallLang,
+			Lang:    lang,
+			NodeIds: langNodes[lang],
+		}, user)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		langJobs = append(langJobs, job)
+	}
+	for _, key := range sortedKeys(pkgNodes) {
+		pkg := pkgMap[key]
+		job, err := CreateDepJob(DepJobRequest{
+			Type:    constants.DepJobTypeInstallDep,
+			Lang:    pkg.Lang,
+			DepName: pkg.GetDepName(),
+			NodeIds: pkgNodes[key],
+		}, user)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		pkgJobs = append(pkgJobs, job)
+	}
+
+	run := func() []model.DepJob {
+		defer release()
+		var jobs []model.DepJob
+		for _, list := range [][]model.DepJob{langJobs, pkgJobs} {
+			for _, job := range list {
+				job, err := RunDepJob(job)
+				if err != nil {
+					log.Errorf("reconcile env profile error: %s, profile_id: %s", err.Error(), p.Id.Hex())
+					debug.PrintStack()
+				}
+				jobs = append(jobs, job)
+			}
+		}
+		return jobs
+	}
+
+	if !wait {
+		go run()
+		return append(langJobs, pkgJobs...), nil
+	}
+	return run(), nil
+}
+
+func sortedKeys(m map[string][]bson.ObjectId) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 自动修复开启了 auto_reconcile 的环境配置
+func ReconcileEnvProfiles() {
+	profiles, err := model.GetEnvProfileList(bson.M{"auto_reconcile": true}, 0, 0, "_id")
+	if err != nil {
+		log.Errorf("get env profile list error: %s", err.Error())
+		debug.PrintStack()
+		return
+	}
+
+	for _, p := range profiles {
+		nodes, err := GetEnvProfileNodes(p)
+		if err != nil {
+			log.Errorf("get env profile nodes error: %s", err.Error())
+			debug.PrintStack()
+			continue
+		}
+
+		// 只修复在线节点
+		var onlineNodes []model.Node
+		for _, node := range nodes {
+			if node.Status == constants.StatusOnline {
+				onlineNodes = append(onlineNodes, node)
+			}
+		}
+		if _, err := ReconcileEnvProfile(p, onlineNodes, nil, true); err != nil {
+			log.Errorf("reconcile env profile error: %s, profile_id: %s", err.Error(), p.Id.Hex())
+			debug.PrintStack()
+		}
+	}
+}
+
+// 确保当前节点满足爬虫要求的环境配置，不满足时先修复
+func EnsureSpiderEnvProfile(spider model.Spider) error {
+	if spider.EnvProfileId == "" {
+		return nil
+	}
+
+	p, err := model.GetEnvProfile(spider.EnvProfileId)
+	if err != nil {
+		return errors.New("cannot find env profile: " + err.Error())
+	}
+
+	node, err := model.GetCurrentNode()
+	if err != nil {
+		return err
+	}
+
+	// 等待正在进行的修复完成
+	key := p.Id.Hex() + ":" + node.Id.Hex()
+	for i := 0; i < getDepJobTimeout(); i++ {
+		if _, ok := reconcilingEnvNodes.Load(key); !ok {
+			break
+		}
+		time.Sleep(1 * time.Second)
+	}
+
+	drift := CheckEnvProfileDrift(p, node)
+	if drift.InSync {
+		return nil
+	}
+	if drift.Error == "" {
+		if _, err := ReconcileEnvProfile(p, []model.Node{node}, nil, true); err != nil {
+			return err
+		}
+		drift = CheckEnvProfileDrift(p, node)
+		if drift.InSync {
+			return nil
+		}
+	}
+	if drift.Error != "" {
+		return errors.New(fmt.Sprintf("env profile \"%s\" check error: %s", p.Name, drift.Error))
+	}
+	return errors.New(fmt.Sprintf("env profile \"%s\" is not satisfied: %s", p.Name, formatEnvProfileDrift(drift)))
+}
+
+func formatEnvProfileDrift(drift EnvProfileDrift) string {
+	var items []string
+	for _, lang := range drift.MissingLangs {
+		items = append(items, "missing lang "+lang)
+	}
+	for _, d := range drift.MissingPackages {
+		items = append(items, "missing "+d.Name)
+	}
+	for _, d := range drift.VersionMismatches {
+		items = append(items, fmt.Sprintf("%s %s (expected %s)", d.Name, d.Installed, d.Expected))
+	}
+	return strings.Join(items, ", ")
+}
+
+// 初始化环境配置服务
+func InitEnvProfileService() error {
+	cronExec := cron.New(cron.WithSeconds())
+	spec := fmt.Sprintf("@every %ds", constants.EnvProfileReconcileIntervalSeconds)
+	if _, err := cronExec.AddFunc(spec, ReconcileEnvProfiles); err != nil {
+		log.Errorf("add env profile cron error: %s", err.Error())
+		debug.PrintStack()
+		return err
+	}
+	cronExec.Start()
+	return nil
+}
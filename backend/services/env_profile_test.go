@@ -0,0 +1,53 @@
+package services
+
+import (
+	"crawlab/constants"
+	"crawlab/entity"
+	"crawlab/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestEnvProfile(t *testing.T) {
+	Convey("Test EnvPackage.GetDepName", t, func() {
+		pkg := model.EnvPackage{Lang: constants.Python, Name: "requests", Version: "2.22.0"}
+		So(pkg.GetDepName(), ShouldEqual, "requests==2.22.0")
+
+		pkg = model.EnvPackage{Lang: constants.Nodejs, Name: "puppeteer", Version: "2.1.1"}
+		So(pkg.GetDepName(), ShouldEqual, "puppeteer@2.1.1")
+
+		pkg = model.EnvPackage{Lang: constants.Python, Name: "scrapy"}
+		So(pkg.GetDepName(), ShouldEqual, "scrapy")
+	})
+
+	Convey("Test compareEnvPackages", t, func() {
+		pkgs := []model.EnvPackage{
+			{Lang: constants.Python, Name: "Scrapy_Splash", Version: "0.7.2"},
+			{Lang: constants.Python, Name: "requests", Version: "2.22.0"},
+			{Lang: constants.Python, Name: "pymongo"},
+			{Lang: constants.Nodejs, Name: "puppeteer", Version: "2.1.1"},
+		}
+		installed := map[string][]entity.Dependency{
+			constants.Python: {
+				{Name: "scrapy-splash", Version: "0.7.2"},
+				{Name: "requests", Version: "2.21.0"},
+			},
+		}
+
+		missing, mismatches := compareEnvPackages(pkgs, installed)
+		So(len(missing), ShouldEqual, 2)
+		So(missing[0].Name, ShouldEqual, "pymongo")
+		So(missing[1].Name, ShouldEqual, "puppeteer")
+		So(len(mismatches), ShouldEqual, 1)
+		So(mismatches[0].Name, ShouldEqual, "requests")
+		So(mismatches[0].Installed, ShouldEqual, "2.21.0")
+		So(mismatches[0].Expected, ShouldEqual, "2.22.0")
+	})
+
+	Convey("Test ValidateEnvProfile", t, func() {
+		So(ValidateEnvProfile(model.EnvProfile{}), ShouldNotBeNil)
+		So(ValidateEnvProfile(model.EnvProfile{Name: "p", Langs: []string{"cobol"}}), ShouldNotBeNil)
+		So(ValidateEnvProfile(model.EnvProfile{Name: "p", Packages: []model.EnvPackage{{Lang: "go", Name: "x"}}}), ShouldNotBeNil)
+		So(ValidateEnvProfile(model.EnvProfile{Name: "p", Packages: []model.EnvPackage{{Lang: constants.Python, Name: "requests"}}}), ShouldBeNil)
+	})
+}
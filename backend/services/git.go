@@ -215,11 +215,16 @@ func SyncSpiderGit(s model.Spider) (err error) {
 			SaveSpiderGitSyncError(s, err.Error())
 			return err
 		}
+		password, err := s.GetGitPassword()
+		if err != nil {
+			SaveSpiderGitSyncError(s, err.Error())
+			return err
+		}
 		gitUrl = fmt.Sprintf(
 			"%s://%s:%s@%s%s",
 			u.Scheme,
 			s.GitUsername,
-			s.GitPassword,
+			password,
 			u.Hostname(),
 			u.Path,
 		)
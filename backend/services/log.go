@@ -142,6 +142,12 @@ func InitLogIndexes() error {
 	_ = c.EnsureIndex(mgo.Index{
 		Key: []string{"task_id", "msg"},
 	})
+	_ = c.EnsureIndex(mgo.Index{
+		Key: []string{"task_id", "level", "seq"},
+	})
+	_ = c.EnsureIndex(mgo.Index{
+		Key: []string{"task_id", "stream", "seq"},
+	})
 	_ = c.EnsureIndex(mgo.Index{
 		Key:         []string{"expire_ts"},
 		Sparse:      true,
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"crawlab/constants"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// JSON 日志中表示级别的字段
+var logLevelJsonKeys = []string{"level", "levelname", "severity", "lvl", "loglevel"}
+
+// Python logging / Scrapy 格式中的级别，如 "WARNING:root:..." 或 "[scrapy.core.engine] INFO: ..."
+var logLevelRegex = regexp.MustCompile(`(?:^|[\s\[|\-])(DEBUG|INFO|WARNING|WARN|ERROR|CRITICAL|FATAL)(?:[\]\s:|\-]|$)`)
+
+// 日志级别的别名
+var logLevelAliases = map[string]string{
+	"debug":    constants.LogLevelDebug,
+	"trace":    constants.LogLevelDebug,
+	"info":     constants.LogLevelInfo,
+	"notice":   constants.LogLevelInfo,
+	"warning":  constants.LogLevelWarning,
+	"warn":     constants.LogLevelWarning,
+	"error":    constants.LogLevelError,
+	"err":      constants.LogLevelError,
+	"critical": constants.LogLevelCritical,
+	"fatal":    constants.LogLevelCritical,
+}
+
+// 日志级别解析器，每个输出流一个，多行日志（如 Traceback）沿用上一行的级别
+type LogLevelParser struct {
+	errorRegex *regexp.Regexp
+	lastLevel  string
+}
+
+// errorRegexPattern 为用户设置的错误日志正则，无法识别级别的行匹配时视为错误
+func NewLogLevelParser(errorRegexPattern string) *LogLevelParser {
+	if errorRegexPattern == "" {
+		errorRegexPattern = constants.ErrorRegexPattern
+	}
+	errorRegex, err := regexp.Compile("(?i)" + errorRegexPattern)
+	if err != nil {
+		errorRegex = regexp.MustCompile("(?i)" + constants.ErrorRegexPattern)
+	}
+	return &LogLevelParser{errorRegex: errorRegex}
+}
+
+func (p *LogLevelParser) Parse(line string) string {
+	level := p.parse(line)
+	p.lastLevel = level
+	return level
+}
+
+func (p *LogLevelParser) parse(line string) string {
+	trimmed := strings.TrimSpace(line)
+
+	// JSON 格式
+	if strings.HasPrefix(trimmed, "{") {
+		if level := parseJsonLogLevel(trimmed); level != "" {
+			return level
+		}
+	}
+
+	// Python logging / Scrapy 格式
+	if m := logLevelRegex.FindStringSubmatch(line); m != nil {
+		return logLevelAliases[strings.ToLower(m[1])]
+	}
+
+	// 缩进的续行沿用上一行的级别
+	if p.lastLevel != "" && trimmed != "" && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+		return p.lastLevel
+	}
+
+	if p.errorRegex.MatchString(line) {
+		return constants.LogLevelError
+	}
+	return constants.LogLevelInfo
+}
+
+func parseJsonLogLevel(line string) string {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &data); err != nil {
+		return ""
+	}
+	for _, key := range logLevelJsonKeys {
+		value, ok := data[key].(string)
+		if !ok {
+			continue
+		}
+		if level, ok := logLevelAliases[strings.ToLower(value)]; ok {
+			return level
+		}
+	}
+	return ""
+}
+
+// 是否为错误级别
+func IsErrorLogLevel(level string) bool {
+	return level == constants.LogLevelError || level == constants.LogLevelCritical
+}
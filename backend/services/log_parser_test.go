@@ -0,0 +1,37 @@
+package services
+
+import (
+	"crawlab/constants"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLogLevelParser(t *testing.T) {
+	Convey("Test LogLevelParser", t, func() {
+		parser := NewLogLevelParser("")
+
+		Convey("should parse python logging format", func() {
+			So(parser.Parse("WARNING:root:disk almost full"), ShouldEqual, constants.LogLevelWarning)
+			So(parser.Parse("2020-03-01 10:00:00,123 - myspider - ERROR - failed"), ShouldEqual, constants.LogLevelError)
+		})
+
+		Convey("should parse scrapy format", func() {
+			So(parser.Parse("2020-03-01 10:00:00 [scrapy.core.engine] INFO: Spider opened"), ShouldEqual, constants.LogLevelInfo)
+			So(parser.Parse("2020-03-01 10:00:00 [scrapy.core.scraper] DEBUG: Scraped from <200 http://example.com>"), ShouldEqual, constants.LogLevelDebug)
+		})
+
+		Convey("should parse json lines", func() {
+			So(parser.Parse(`{"level": "warn", "msg": "retrying"}`), ShouldEqual, constants.LogLevelWarning)
+			So(parser.Parse(`{"severity": "FATAL", "msg": "crashed"}`), ShouldEqual, constants.LogLevelCritical)
+		})
+
+		Convey("should keep level of traceback lines", func() {
+			So(parser.Parse("Traceback (most recent call last):"), ShouldEqual, constants.LogLevelError)
+			So(parser.Parse(`  File "main.py", line 1, in <module>`), ShouldEqual, constants.LogLevelError)
+		})
+
+		Convey("should default to info", func() {
+			So(parser.Parse("hello world"), ShouldEqual, constants.LogLevelInfo)
+		})
+	})
+}
@@ -0,0 +1,171 @@
+package log_sink
+
+import (
+	"context"
+	"crawlab/constants"
+	"crawlab/model"
+	"encoding/json"
+	"errors"
+	"github.com/apex/log"
+	"github.com/globalsign/mgo/bson"
+	"github.com/olivere/elastic/v7"
+	"github.com/spf13/viper"
+	"time"
+)
+
+// ===================== Elasticsearch =====================
+// 按批次调用 Bulk API 写入，每条日志带有任务ID、序号、级别和输出流
+type EsLogStore struct {
+	Client *elastic.Client
+	Index  string
+}
+
+// 日志文档，@timestamp 和 @msg 与旧版保持一致
+type esLogDoc struct {
+	Timestamp time.Time `json:"@timestamp"`
+	Message   string    `json:"@msg"`
+	TaskId    string    `json:"task_id"`
+	Seq       int64     `json:"seq"`
+	Stream    string    `json:"stream"`
+	Level     string    `json:"level"`
+}
+
+var esLogMapping = map[string]interface{}{
+	"properties": map[string]interface{}{
+		"@timestamp": map[string]interface{}{"type": "date"},
+		"@msg":       map[string]interface{}{"type": "text"},
+		"task_id":    map[string]interface{}{"type": "keyword"},
+		"seq":        map[string]interface{}{"type": "long"},
+		"stream":     map[string]interface{}{"type": "keyword"},
+		"level":      map[string]interface{}{"type": "keyword"},
+	},
+}
+
+func NewEsLogStore() (*EsLogStore, error) {
+	url := viper.GetString("setting.esClient")
+	if url == "" {
+		return nil, errors.New("setting.esClient is empty")
+	}
+	client, err := elastic.NewClient(elastic.SetURL(url), elastic.SetSniff(false))
+	if err != nil {
+		return nil, err
+	}
+	index := viper.GetString("log.es.index")
+	if index == "" {
+		index = viper.GetString("setting.spiderLogIndex")
+	}
+
+	// 创建索引并设置字段类型
+	ctx := context.Background()
+	exists, err := client.IndexExists(index).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if _, err := client.CreateIndex(index).BodyJson(map[string]interface{}{
+			"mappings": esLogMapping,
+		}).Do(ctx); err != nil {
+			return nil, err
+		}
+	} else if _, err := client.PutMapping().Index(index).BodyJson(esLogMapping).Do(ctx); err != nil {
+		log.Warnf("put es log mapping error: %s", err.Error())
+	}
+
+	return &EsLogStore{Client: client, Index: index}, nil
+}
+
+func (e *EsLogStore) GetType() string {
+	return constants.LogSinkEs
+}
+
+func (e *EsLogStore) Write(items []model.LogItem) error {
+	bulk := e.Client.Bulk().Index(e.Index)
+	for _, l := range items {
+		bulk.Add(elastic.NewBulkIndexRequest().Id(l.Id.Hex()).Doc(esLogDoc{
+			Timestamp: l.Ts,
+			Message:   l.Message,
+			TaskId:    l.TaskId,
+			Seq:       l.Seq,
+			Stream:    l.Stream,
+			Level:     l.Level,
+		}))
+	}
+	res, err := bulk.Do(context.Background())
+	if err != nil {
+		return err
+	}
+	if res.Errors {
+		for _, item := range res.Failed() {
+			if item.Error != nil {
+				return errors.New("es bulk error: " + item.Error.Reason)
+			}
+		}
+		return errors.New("es bulk error")
+	}
+	return nil
+}
+
+func (e *EsLogStore) search(query elastic.Query, from int, size int) ([]model.LogItem, int, error) {
+	res, err := e.Client.Search(e.Index).
+		Query(query).
+		Sort("seq", true).
+		From(from).
+		Size(size).
+		TrackTotalHits(true).
+		Do(context.Background())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items := []model.LogItem{}
+	for _, hit := range res.Hits.Hits {
+		var doc esLogDoc
+		if err := json.Unmarshal(hit.Source, &doc); err != nil {
+			continue
+		}
+		l := model.LogItem{
+			Message: doc.Message,
+			TaskId:  doc.TaskId,
+			Seq:     doc.Seq,
+			Stream:  doc.Stream,
+			Level:   doc.Level,
+			Ts:      doc.Timestamp,
+		}
+		if bson.IsObjectIdHex(hit.Id) {
+			l.Id = bson.ObjectIdHex(hit.Id)
+		}
+		items = append(items, l)
+	}
+	return items, int(res.TotalHits()), nil
+}
+
+func (e *EsLogStore) GetLogItems(query LogQuery) ([]model.LogItem, int, error) {
+	q := elastic.NewBoolQuery().Filter(elastic.NewTermQuery("task_id", query.TaskId))
+	if len(query.Levels) > 0 {
+		q = q.Filter(elastic.NewTermsQuery("level", toInterfaces(query.Levels)...))
+	}
+	if len(query.Streams) > 0 {
+		q = q.Filter(elastic.NewTermsQuery("stream", toInterfaces(query.Streams)...))
+	}
+	if query.Keyword != "" {
+		q = q.Must(elastic.NewMatchPhraseQuery("@msg", query.Keyword))
+	}
+	return e.search(q, query.skip(), query.PageSize)
+}
+
+func (e *EsLogStore) GetLogItemsAfterSeq(taskId string, seq int64, limit int) ([]model.LogItem, error) {
+	q := elastic.NewBoolQuery().Filter(
+		elastic.NewTermQuery("task_id", taskId),
+		elastic.NewRangeQuery("seq").Gt(seq),
+	)
+	items, _, err := e.search(q, 0, limit)
+	return items, err
+}
+
+func toInterfaces(list []string) []interface{} {
+	var res []interface{}
+	for _, item := range list {
+		res = append(res, item)
+	}
+	return res
+}
@@ -0,0 +1,192 @@
+package log_sink
+
+import (
+	"bufio"
+	"crawlab/constants"
+	"crawlab/model"
+	"crawlab/utils"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ===================== 本地文件 =====================
+// 每个任务一个目录，日志按 JSON Lines 写入，超过大小后轮转。
+// 日志保存在执行任务的节点上，只有在主节点执行或共享目录时才能从主节点读取。
+type FileLogStore struct {
+	Path       string // 日志目录
+	MaxSize    int64  // 单个文件最大字节数
+	MaxBackups int    // 保留的轮转文件数
+	lock       sync.Mutex
+}
+
+const fileLogName = "task.log"
+
+func NewFileLogStore() (*FileLogStore, error) {
+	path := viper.GetString("log.file.path")
+	if path == "" {
+		path = filepath.Join(viper.GetString("log.path"), "tasks")
+	}
+	maxSize := viper.GetInt64("log.file.maxSize")
+	if maxSize <= 0 {
+		maxSize = 100
+	}
+	maxBackups := viper.GetInt("log.file.maxBackups")
+	if maxBackups <= 0 {
+		maxBackups = 5
+	}
+	if err := os.MkdirAll(path, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &FileLogStore{
+		Path:       path,
+		MaxSize:    maxSize * 1024 * 1024,
+		MaxBackups: maxBackups,
+	}, nil
+}
+
+func (f *FileLogStore) GetType() string {
+	return constants.LogSinkFile
+}
+
+func (f *FileLogStore) getFilePath(taskId string, index int) string {
+	name := fileLogName
+	if index > 0 {
+		name = fmt.Sprintf("%s.%d", fileLogName, index)
+	}
+	return filepath.Join(f.Path, taskId, name)
+}
+
+// 轮转日志文件，task.log -> task.log.1 -> task.log.2 ...
+func (f *FileLogStore) rotate(taskId string) error {
+	_ = os.Remove(f.getFilePath(taskId, f.MaxBackups))
+	for i := f.MaxBackups - 1; i >= 0; i-- {
+		src := f.getFilePath(taskId, i)
+		if !utils.Exists(src) {
+			continue
+		}
+		if err := os.Rename(src, f.getFilePath(taskId, i+1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FileLogStore) Write(items []model.LogItem) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	// 按任务分组
+	taskItems := map[string][]model.LogItem{}
+	for _, l := range items {
+		taskItems[l.TaskId] = append(taskItems[l.TaskId], l)
+	}
+
+	for taskId, list := range taskItems {
+		if err := os.MkdirAll(filepath.Join(f.Path, taskId), os.ModePerm); err != nil {
+			return err
+		}
+		if err := f.writeTaskLogs(taskId, list); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FileLogStore) writeTaskLogs(taskId string, items []model.LogItem) error {
+	var size int64
+	if info, err := os.Stat(f.getFilePath(taskId, 0)); err == nil {
+		size = info.Size()
+	}
+
+	file, err := os.OpenFile(f.getFilePath(taskId, 0), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	for _, l := range items {
+		data, err := json.Marshal(l)
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+
+		// 超过大小时轮转
+		if size > 0 && size+int64(len(data)) > f.MaxSize {
+			_ = file.Close()
+			if err := f.rotate(taskId); err != nil {
+				return err
+			}
+			file, err = os.OpenFile(f.getFilePath(taskId, 0), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				return err
+			}
+			size = 0
+		}
+
+		n, err := file.Write(data)
+		if err != nil {
+			return err
+		}
+		size += int64(n)
+	}
+	return nil
+}
+
+// 按写入顺序读取任务的全部日志
+func (f *FileLogStore) readTaskLogs(taskId string, filter func(l model.LogItem) bool) ([]model.LogItem, error) {
+	var items []model.LogItem
+	for i := f.MaxBackups; i >= 0; i-- {
+		path := f.getFilePath(taskId, i)
+		if !utils.Exists(path) {
+			continue
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return items, err
+		}
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+		for scanner.Scan() {
+			var l model.LogItem
+			if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+				continue
+			}
+			if filter(l) {
+				items = append(items, l)
+			}
+		}
+		_ = file.Close()
+	}
+	sortLogItems(items)
+	return items, nil
+}
+
+func (f *FileLogStore) GetLogItems(query LogQuery) ([]model.LogItem, int, error) {
+	filter, err := query.matcher()
+	if err != nil {
+		return nil, 0, err
+	}
+	items, err := f.readTaskLogs(query.TaskId, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	return pageLogItems(items, query), len(items), nil
+}
+
+func (f *FileLogStore) GetLogItemsAfterSeq(taskId string, seq int64, limit int) ([]model.LogItem, error) {
+	items, err := f.readTaskLogs(taskId, func(l model.LogItem) bool {
+		return l.Seq > seq
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
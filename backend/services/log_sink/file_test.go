@@ -0,0 +1,67 @@
+package log_sink
+
+import (
+	"crawlab/constants"
+	"crawlab/model"
+	"github.com/globalsign/mgo/bson"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFileLogStore(t *testing.T) {
+	Convey("Test FileLogStore", t, func() {
+		dir, err := ioutil.TempDir("", "crawlab-task-logs")
+		So(err, ShouldBeNil)
+		defer func() { _ = os.RemoveAll(dir) }()
+
+		store := &FileLogStore{Path: dir, MaxSize: 512, MaxBackups: 2}
+		var items []model.LogItem
+		for i := 1; i <= 10; i++ {
+			level := constants.LogLevelInfo
+			if i%5 == 0 {
+				level = constants.LogLevelError
+			}
+			items = append(items, model.LogItem{
+				Id:      bson.NewObjectId(),
+				TaskId:  "task-1",
+				Seq:     int64(i),
+				Message: "line",
+				Stream:  constants.LogStreamStdout,
+				Level:   level,
+				Ts:      time.Now(),
+			})
+		}
+		So(store.Write(items), ShouldBeNil)
+
+		Convey("should rotate and keep backups", func() {
+			_, err := os.Stat(store.getFilePath("task-1", 1))
+			So(err, ShouldBeNil)
+			_, err = os.Stat(store.getFilePath("task-1", 3))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("should read logs after seq in order", func() {
+			list, err := store.GetLogItemsAfterSeq("task-1", 8, 100)
+			So(err, ShouldBeNil)
+			So(len(list), ShouldEqual, 2)
+			So(list[0].Seq, ShouldEqual, 9)
+		})
+
+		Convey("should filter by level", func() {
+			list, total, err := store.GetLogItems(LogQuery{
+				TaskId:   "task-1",
+				Levels:   []string{constants.LogLevelError},
+				PageNum:  1,
+				PageSize: 10,
+			})
+			So(err, ShouldBeNil)
+			So(total, ShouldBeGreaterThan, 0)
+			for _, l := range list {
+				So(l.Level, ShouldEqual, constants.LogLevelError)
+			}
+		})
+	})
+}
@@ -0,0 +1,203 @@
+package log_sink
+
+import (
+	"crawlab/constants"
+	"crawlab/model"
+	"github.com/apex/log"
+	"github.com/spf13/viper"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 任务日志写入
+type LogSink interface {
+	// 存储方式
+	GetType() string
+	// 批量写入日志
+	Write(items []model.LogItem) error
+}
+
+// 任务日志读取
+type LogSource interface {
+	// 存储方式
+	GetType() string
+	// 分页查询日志，返回日志和总数
+	GetLogItems(query LogQuery) ([]model.LogItem, int, error)
+	// 获取序号大于 seq 的日志，按序号排序
+	GetLogItemsAfterSeq(taskId string, seq int64, limit int) ([]model.LogItem, error)
+}
+
+// 日志查询条件
+type LogQuery struct {
+	TaskId   string
+	Keyword  string
+	Levels   []string
+	Streams  []string
+	PageNum  int
+	PageSize int
+}
+
+func (q LogQuery) skip() int {
+	if q.PageNum < 1 {
+		return 0
+	}
+	return (q.PageNum - 1) * q.PageSize
+}
+
+// 同一种存储方式同时实现写入和读取
+type logStore interface {
+	GetType() string
+	Write(items []model.LogItem) error
+	GetLogItems(query LogQuery) ([]model.LogItem, int, error)
+	GetLogItemsAfterSeq(taskId string, seq int64, limit int) ([]model.LogItem, error)
+}
+
+var storeFactories = map[string]func() (logStore, error){
+	constants.LogSinkMongo: func() (logStore, error) { return NewMongoLogStore(), nil },
+	constants.LogSinkFile:  func() (logStore, error) { return NewFileLogStore() },
+	constants.LogSinkEs:    func() (logStore, error) { return NewEsLogStore() },
+	constants.LogSinkLoki:  func() (logStore, error) { return NewLokiLogStore() },
+}
+
+var initOnce sync.Once
+var sinks []LogSink
+var source LogSource
+
+// 配置的存储方式，未配置时兼容旧版 setting.esClient
+func getSinkTypes() []string {
+	str := viper.GetString("log.sinks")
+	if str == "" {
+		str = constants.LogSinkMongo
+		if viper.GetString("setting.esClient") != "" {
+			str += "," + constants.LogSinkEs
+		}
+	}
+	var types []string
+	for _, t := range strings.Split(str, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+func initLogStores() {
+	stores := map[string]logStore{}
+	for _, t := range getSinkTypes() {
+		factory, ok := storeFactories[t]
+		if !ok {
+			log.Errorf("invalid log sink: %s", t)
+			continue
+		}
+		store, err := factory()
+		if err != nil {
+			log.Errorf("init log sink %s error: %s", t, err.Error())
+			debug.PrintStack()
+			continue
+		}
+		stores[t] = store
+		sinks = append(sinks, store)
+	}
+
+	// 读取方式，未配置时使用第一个写入方式
+	sourceType := viper.GetString("log.source")
+	if sourceType == "" && len(sinks) > 0 {
+		sourceType = sinks[0].GetType()
+	}
+	if store, ok := stores[sourceType]; ok {
+		source = store
+	} else if factory, ok := storeFactories[sourceType]; ok {
+		if store, err := factory(); err == nil {
+			source = store
+		}
+	}
+
+	// 至少写入和读取 MongoDB
+	if len(sinks) == 0 {
+		sinks = append(sinks, NewMongoLogStore())
+	}
+	if source == nil {
+		source = NewMongoLogStore()
+	}
+}
+
+func GetLogSinks() []LogSink {
+	initOnce.Do(initLogStores)
+	return sinks
+}
+
+func GetLogSource() LogSource {
+	initOnce.Do(initLogStores)
+	return source
+}
+
+// 写入所有配置的存储，返回第一个错误
+func WriteLogItems(items []model.LogItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	var firstErr error
+	for _, sink := range GetLogSinks() {
+		if err := sink.Write(items); err != nil {
+			log.Errorf("write logs to %s error: %s", sink.GetType(), err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// 内存中筛选日志，用于不支持查询的存储方式
+func (q LogQuery) matcher() (func(l model.LogItem) bool, error) {
+	var keywordRegex *regexp.Regexp
+	if q.Keyword != "" {
+		var err error
+		keywordRegex, err = regexp.Compile("(?i)" + q.Keyword)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return func(l model.LogItem) bool {
+		if len(q.Levels) > 0 && !containsString(q.Levels, l.Level) {
+			return false
+		}
+		if len(q.Streams) > 0 && !containsString(q.Streams, l.Stream) {
+			return false
+		}
+		if keywordRegex != nil && !keywordRegex.MatchString(l.Message) {
+			return false
+		}
+		return true
+	}, nil
+}
+
+func containsString(list []string, str string) bool {
+	for _, item := range list {
+		if item == str {
+			return true
+		}
+	}
+	return false
+}
+
+func sortLogItems(items []model.LogItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Seq < items[j].Seq
+	})
+}
+
+func pageLogItems(items []model.LogItem, query LogQuery) []model.LogItem {
+	skip := query.skip()
+	if skip >= len(items) {
+		return []model.LogItem{}
+	}
+	end := skip + query.PageSize
+	if query.PageSize <= 0 || end > len(items) {
+		end = len(items)
+	}
+	return items[skip:end]
+}
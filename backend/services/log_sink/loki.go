@@ -0,0 +1,242 @@
+package log_sink
+
+import (
+	"crawlab/constants"
+	"crawlab/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imroc/req"
+	"github.com/spf13/viper"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ===================== Loki =====================
+// 通过 push API 写入，任务ID、级别和输出流作为标签，日志行为包含序号的 JSON
+type LokiLogStore struct {
+	Url    string
+	Tenant string // 多租户时的 X-Scope-OrgID
+}
+
+// Loki 单次查询的最大条数
+const lokiQueryLimit = 5000
+
+// 写入 Loki 的日志行
+type lokiLogLine struct {
+	Seq     int64  `json:"seq"`
+	Message string `json:"msg"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][]string        `json:"values"`
+}
+
+type lokiQueryResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string            `json:"resultType"`
+		Result     []json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+type lokiVector struct {
+	Value []interface{} `json:"value"`
+}
+
+func NewLokiLogStore() (*LokiLogStore, error) {
+	url := strings.TrimRight(viper.GetString("log.loki.url"), "/")
+	if url == "" {
+		return nil, errors.New("log.loki.url is empty")
+	}
+	return &LokiLogStore{
+		Url:    url,
+		Tenant: viper.GetString("log.loki.tenant"),
+	}, nil
+}
+
+func (k *LokiLogStore) GetType() string {
+	return constants.LogSinkLoki
+}
+
+func (k *LokiLogStore) header() req.Header {
+	header := req.Header{}
+	if k.Tenant != "" {
+		header["X-Scope-OrgID"] = k.Tenant
+	}
+	return header
+}
+
+func (k *LokiLogStore) Write(items []model.LogItem) error {
+	// 按标签分组
+	streams := map[string]*lokiStream{}
+	var keys []string
+	for _, l := range items {
+		key := l.TaskId + "|" + l.Stream + "|" + l.Level
+		s, ok := streams[key]
+		if !ok {
+			s = &lokiStream{Stream: map[string]string{
+				"job":     "crawlab",
+				"task_id": l.TaskId,
+				"stream":  l.Stream,
+				"level":   l.Level,
+			}}
+			streams[key] = s
+			keys = append(keys, key)
+		}
+		line, err := json.Marshal(lokiLogLine{Seq: l.Seq, Message: l.Message})
+		if err != nil {
+			return err
+		}
+		s.Values = append(s.Values, []string{strconv.FormatInt(l.Ts.UnixNano(), 10), string(line)})
+	}
+
+	var data struct {
+		Streams []*lokiStream `json:"streams"`
+	}
+	for _, key := range keys {
+		data.Streams = append(data.Streams, streams[key])
+	}
+
+	res, err := req.Post(k.Url+"/loki/api/v1/push", k.header(), req.BodyJSON(&data))
+	if err != nil {
+		return err
+	}
+	if res.Response().StatusCode >= http.StatusBadRequest {
+		return errors.New("loki push error: " + res.String())
+	}
+	return nil
+}
+
+// 生成 LogQL 选择器
+func (k *LokiLogStore) selector(query LogQuery) string {
+	labels := []string{fmt.Sprintf(`task_id=%q`, query.TaskId)}
+	if len(query.Levels) > 0 {
+		labels = append(labels, fmt.Sprintf(`level=~%q`, strings.Join(query.Levels, "|")))
+	}
+	if len(query.Streams) > 0 {
+		labels = append(labels, fmt.Sprintf(`stream=~%q`, strings.Join(query.Streams, "|")))
+	}
+	expr := "{" + strings.Join(labels, ",") + "}"
+	if query.Keyword != "" {
+		expr += fmt.Sprintf(` |~ %q`, "(?i)"+query.Keyword)
+	}
+	return expr
+}
+
+// 查询范围从任务创建时间开始
+func (k *LokiLogStore) getStartTs(taskId string) time.Time {
+	if t, err := model.GetTask(taskId); err == nil && !t.CreateTs.IsZero() {
+		return t.CreateTs.Add(-time.Minute)
+	}
+	return time.Now().AddDate(0, 0, -30)
+}
+
+func (k *LokiLogStore) query(path string, params req.QueryParam) (lokiQueryResponse, error) {
+	var res lokiQueryResponse
+	r, err := req.Get(k.Url+path, k.header(), params)
+	if err != nil {
+		return res, err
+	}
+	if r.Response().StatusCode >= http.StatusBadRequest {
+		return res, errors.New("loki query error: " + r.String())
+	}
+	if err := r.ToJSON(&res); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+func (k *LokiLogStore) queryLogItems(expr string, taskId string, limit int) ([]model.LogItem, error) {
+	res, err := k.query("/loki/api/v1/query_range", req.QueryParam{
+		"query":     expr,
+		"start":     k.getStartTs(taskId).UnixNano(),
+		"end":       time.Now().UnixNano(),
+		"limit":     limit,
+		"direction": "forward",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	items := []model.LogItem{}
+	for _, raw := range res.Data.Result {
+		var s lokiStream
+		if err := json.Unmarshal(raw, &s); err != nil {
+			continue
+		}
+		for _, value := range s.Values {
+			if len(value) < 2 {
+				continue
+			}
+			var line lokiLogLine
+			if err := json.Unmarshal([]byte(value[1]), &line); err != nil {
+				continue
+			}
+			ns, _ := strconv.ParseInt(value[0], 10, 64)
+			items = append(items, model.LogItem{
+				Message: line.Message,
+				TaskId:  s.Stream["task_id"],
+				Seq:     line.Seq,
+				Stream:  s.Stream["stream"],
+				Level:   s.Stream["level"],
+				Ts:      time.Unix(0, ns),
+			})
+		}
+	}
+	sortLogItems(items)
+	return items, nil
+}
+
+// 统计日志条数
+func (k *LokiLogStore) count(expr string, taskId string) (int, error) {
+	start := k.getStartTs(taskId)
+	rangeSeconds := int(time.Since(start).Seconds()) + 1
+	res, err := k.query("/loki/api/v1/query", req.QueryParam{
+		"query": fmt.Sprintf("sum(count_over_time(%s[%ds]))", expr, rangeSeconds),
+		"time":  time.Now().UnixNano(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(res.Data.Result) == 0 {
+		return 0, nil
+	}
+	var v lokiVector
+	if err := json.Unmarshal(res.Data.Result[0], &v); err != nil || len(v.Value) < 2 {
+		return 0, err
+	}
+	str, _ := v.Value[1].(string)
+	total, _ := strconv.Atoi(str)
+	return total, nil
+}
+
+func (k *LokiLogStore) GetLogItems(query LogQuery) ([]model.LogItem, int, error) {
+	expr := k.selector(query)
+
+	// Loki 不支持跳过，取到当前页为止的日志后截取
+	limit := query.skip() + query.PageSize
+	if query.PageSize <= 0 || limit > lokiQueryLimit {
+		limit = lokiQueryLimit
+	}
+	items, err := k.queryLogItems(expr, query.TaskId, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := k.count(expr, query.TaskId)
+	if err != nil {
+		total = len(items)
+	}
+	return pageLogItems(items, query), total, nil
+}
+
+func (k *LokiLogStore) GetLogItemsAfterSeq(taskId string, seq int64, limit int) ([]model.LogItem, error) {
+	expr := k.selector(LogQuery{TaskId: taskId}) + fmt.Sprintf(" | json | seq > %d", seq)
+	if limit <= 0 || limit > lokiQueryLimit {
+		limit = lokiQueryLimit
+	}
+	return k.queryLogItems(expr, taskId, limit)
+}
@@ -0,0 +1,30 @@
+package log_sink
+
+import (
+	"crawlab/constants"
+	"crawlab/model"
+)
+
+// ===================== MongoDB =====================
+type MongoLogStore struct{}
+
+func NewMongoLogStore() *MongoLogStore {
+	return &MongoLogStore{}
+}
+
+func (m *MongoLogStore) GetType() string {
+	return constants.LogSinkMongo
+}
+
+func (m *MongoLogStore) Write(items []model.LogItem) error {
+	return model.AddLogItems(items)
+}
+
+func (m *MongoLogStore) GetLogItems(query LogQuery) ([]model.LogItem, int, error) {
+	t := model.Task{Id: query.TaskId}
+	return t.GetLogItems(query.Keyword, query.Levels, query.Streams, query.PageNum, query.PageSize)
+}
+
+func (m *MongoLogStore) GetLogItemsAfterSeq(taskId string, seq int64, limit int) ([]model.LogItem, error) {
+	return model.GetLogItemListAfterSeq(taskId, seq, limit)
+}
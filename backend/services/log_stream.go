@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"crawlab/constants"
+	"crawlab/database"
+	"crawlab/model"
+	"crawlab/services/log_sink"
+	"encoding/json"
+	"github.com/apex/log"
+	"github.com/gomodule/redigo/redis"
+	"runtime/debug"
+	"time"
+)
+
+// 实时日志消息，由执行任务的节点通过 Redis 发布
+type TaskLogStreamMessage struct {
+	Type string        `json:"type"`
+	Log  model.LogItem `json:"log"`
+}
+
+// 每次从数据库回放的日志条数
+const taskLogReplayBatchSize = 1000
+
+// 检查任务是否结束的间隔
+const taskLogStatusCheckInterval = 5 * time.Second
+
+func getTaskLogChannel(taskId string) string {
+	return constants.ChannelTaskLog + taskId
+}
+
+func publishTaskLogMessage(taskId string, msg TaskLogStreamMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if err := database.RedisClient.RPushCapped(
+		constants.TaskLogTailKey+taskId,
+		data,
+		constants.TaskLogTailSize,
+		constants.TaskLogTailExpire*time.Second,
+	); err != nil {
+		return err
+	}
+	if _, err := database.RedisClient.Publish(getTaskLogChannel(taskId), string(data)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 发布一条任务日志
+func PublishTaskLog(l model.LogItem) {
+	msg := TaskLogStreamMessage{Type: constants.TaskLogStreamLog, Log: l}
+	if err := publishTaskLogMessage(l.TaskId, msg); err != nil {
+		log.Errorf("publish task log error: %s", err.Error())
+	}
+}
+
+// 发布任务日志结束
+func PublishTaskLogEnd(taskId string) {
+	msg := TaskLogStreamMessage{Type: constants.TaskLogStreamEnd, Log: model.LogItem{TaskId: taskId}}
+	if err := publishTaskLogMessage(taskId, msg); err != nil {
+		log.Errorf("publish task log end error: %s", err.Error())
+	}
+}
+
+func isTaskFinished(taskId string) bool {
+	t, err := model.GetTask(taskId)
+	if err != nil {
+		return true
+	}
+	return t.Status != constants.StatusPending && t.Status != constants.StatusRunning
+}
+
+// 实时获取任务日志，先回放序号大于 seq 的日志，再推送新日志，任务结束后关闭频道
+func StreamTaskLog(ctx context.Context, taskId string, seq int64) (<-chan model.LogItem, error) {
+	// 先订阅，避免回放期间丢失日志
+	live := make(chan TaskLogStreamMessage, constants.TaskLogTailSize)
+	if err := database.RedisClient.SubscribeOnce(ctx, func(message redis.Message) error {
+		var msg TaskLogStreamMessage
+		if err := json.Unmarshal(message.Data, &msg); err != nil {
+			return err
+		}
+		select {
+		case live <- msg:
+		case <-ctx.Done():
+		}
+		return nil
+	}, getTaskLogChannel(taskId)); err != nil {
+		log.Errorf("subscribe task log error: %s", err.Error())
+		debug.PrintStack()
+		return nil, err
+	}
+
+	ch := make(chan model.LogItem)
+	go func() {
+		defer close(ch)
+
+		send := func(l model.LogItem) bool {
+			if l.Seq <= seq {
+				return true
+			}
+			select {
+			case ch <- l:
+				seq = l.Seq
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		// 回放数据库中的日志
+		for {
+			items, err := log_sink.GetLogSource().GetLogItemsAfterSeq(taskId, seq, taskLogReplayBatchSize)
+			if err != nil {
+				log.Errorf("get task log error: %s", err.Error())
+				return
+			}
+			for _, l := range items {
+				if !send(l) {
+					return
+				}
+			}
+			if len(items) < taskLogReplayBatchSize {
+				break
+			}
+		}
+
+		// 回放尚未写入数据库的日志
+		ended := false
+		tail, _ := database.RedisClient.LRange(constants.TaskLogTailKey+taskId, 0, -1)
+		for _, data := range tail {
+			var msg TaskLogStreamMessage
+			if err := json.Unmarshal([]byte(data), &msg); err != nil {
+				continue
+			}
+			if msg.Type == constants.TaskLogStreamEnd {
+				ended = true
+				continue
+			}
+			if !send(msg.Log) {
+				return
+			}
+		}
+		if ended || isTaskFinished(taskId) {
+			return
+		}
+
+		// 推送新日志，回放过的日志按序号跳过
+		replayed := seq
+		finishedChecks := 0
+		ticker := time.NewTicker(taskLogStatusCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case msg := <-live:
+				if msg.Type == constants.TaskLogStreamEnd {
+					return
+				}
+				if msg.Log.Seq <= replayed {
+					continue
+				}
+				select {
+				case ch <- msg.Log:
+				case <-ctx.Done():
+					return
+				}
+			case <-ticker.C:
+				// 执行节点异常退出时不会发布结束消息，任务结束后再等待一个周期
+				if !isTaskFinished(taskId) || len(live) > 0 {
+					finishedChecks = 0
+					continue
+				}
+				finishedChecks++
+				if finishedChecks >= 2 {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -2,6 +2,7 @@ package msg_handler
 
 import (
 	"crawlab/model"
+	"crawlab/services/spider_handler"
 	"crawlab/utils"
 	"github.com/globalsign/mgo/bson"
 	"github.com/spf13/viper"
@@ -13,6 +14,9 @@ type Spider struct {
 }
 
 func (s *Spider) Handle() error {
+	// 移除本地的爬虫独立依赖环境
+	spider_handler.RemoveSpiderEnvs(s.SpiderId)
+
 	// 移除本地的爬虫目录
 	spider, err := model.GetSpider(bson.ObjectIdHex(s.SpiderId))
 	if err != nil {
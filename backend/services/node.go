@@ -28,6 +28,8 @@ type Data struct {
 	Master       bool      `json:"master"`
 	UpdateTs     time.Time `json:"update_ts"`
 	UpdateTsUnix int64     `json:"update_ts_unix"`
+
+	Labels map[string]string `json:"labels"` // 配置文件中的节点标签
 }
 
 // 所有调用IsMasterNode的方法，都永远会在master节点执行，所以GetCurrentNode方法返回永远是master节点
@@ -92,6 +94,13 @@ func UpdateNodeStatus() {
 			if err := database.RedisClient.HDel("nodes", data.Key); err != nil {
 				log.Errorf("delete redis node key error:%s, key:%s", err.Error(), data.Key)
 			}
+
+			// 离线节点上运行中的任务置为异常
+			if node, err := model.GetNodeByKey(data.Key); err == nil {
+				if err := HandleAbnormalTasks(node.Id); err != nil {
+					log.Errorf("handle abnormal tasks error: %s, node_id: %s", err.Error(), node.Id.Hex())
+				}
+			}
 			continue
 		}
 
@@ -103,6 +112,18 @@ func UpdateNodeStatus() {
 	list, _ = database.RedisClient.HKeys("nodes")
 	// 重置不在redis的key为offline
 	model.ResetNodeStatusToOffline(list)
+
+	// 离线节点未确认的任务消息放回公共队列
+	nodes, err := model.GetNodeList(bson.M{"status": constants.StatusOffline})
+	if err != nil {
+		log.Errorf("get offline nodes error: %s", err.Error())
+		return
+	}
+	for _, node := range nodes {
+		if err := RequeueTaskMessages(node.Id); err != nil {
+			log.Errorf("requeue task messages error: %s, node_id: %s", err.Error(), node.Id.Hex())
+		}
+	}
 }
 
 func getNodeName(data *Data) string {
@@ -142,6 +163,7 @@ func handleNodeInfo(key string, data *Data) {
 			Mac:          data.Mac,
 			Status:       constants.StatusOnline,
 			IsMaster:     data.Master,
+			Labels:       data.Labels,
 			UpdateTs:     time.Now(),
 			UpdateTsUnix: time.Now().Unix(),
 		}
@@ -153,6 +175,16 @@ func handleNodeInfo(key string, data *Data) {
 		// 数据库存在该节点
 		node.Status = constants.StatusOnline
 		node.UpdateTs = time.Now()
+
+		// 配置文件中的标签只补充节点没有的键，不覆盖页面上修改的值
+		for key, value := range data.Labels {
+			if node.Labels == nil {
+				node.Labels = map[string]string{}
+			}
+			if _, ok := node.Labels[key]; !ok {
+				node.Labels[key] = value
+			}
+		}
 		node.UpdateTsUnix = time.Now().Unix()
 		if err := node.Save(); err != nil {
 			log.Errorf(err.Error())
@@ -201,6 +233,7 @@ func UpdateNodeData() {
 		Master:       model.IsMaster(),
 		UpdateTs:     time.Now(),
 		UpdateTsUnix: time.Now().Unix(),
+		Labels:       ParseNodeLabels(viper.GetString("server.register.labels")),
 	}
 
 	// 注册节点到Redis
@@ -302,7 +335,7 @@ func InitNodeService() error {
 	}
 
 	// 更新在当前节点执行中的任务状态为：abnormal
-	if err := model.UpdateTaskToAbnormal(node.Id); err != nil {
+	if err := HandleAbnormalTasks(node.Id); err != nil {
 		debug.PrintStack()
 		return err
 	}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"crawlab/constants"
+	"crawlab/database"
+	"crawlab/model"
+	"errors"
+	"fmt"
+	"github.com/globalsign/mgo/bson"
+	"math/rand"
+	"strings"
+)
+
+// 标签选择条件
+type LabelRequirement struct {
+	Key   string
+	Op    string // = / != / exists / !exists
+	Value string
+}
+
+// 标签选择器，多个条件之间为"且"的关系，例如 "region=eu, proxy=residential"
+type LabelSelector []LabelRequirement
+
+// 解析标签选择器，支持 key=value、key!=value、key（存在）、!key（不存在）
+func ParseLabelSelector(str string) (LabelSelector, error) {
+	var selector LabelSelector
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		var req LabelRequirement
+		if idx := strings.Index(item, "!="); idx >= 0 {
+			req = LabelRequirement{Key: item[:idx], Op: "!=", Value: item[idx+2:]}
+		} else if idx := strings.Index(item, "="); idx >= 0 {
+			req = LabelRequirement{Key: item[:idx], Op: "=", Value: strings.TrimPrefix(item[idx+1:], "=")}
+		} else if strings.HasPrefix(item, "!") {
+			req = LabelRequirement{Key: item[1:], Op: "!exists"}
+		} else {
+			req = LabelRequirement{Key: item, Op: "exists"}
+		}
+		req.Key = strings.TrimSpace(req.Key)
+		req.Value = strings.TrimSpace(req.Value)
+		if req.Key == "" {
+			return nil, errors.New("invalid label selector: " + str)
+		}
+		selector = append(selector, req)
+	}
+	return selector, nil
+}
+
+// 校验标签选择器
+func ValidateLabelSelector(str string) error {
+	_, err := ParseLabelSelector(str)
+	return err
+}
+
+// 标签是否满足选择器
+func (s LabelSelector) Matches(labels map[string]string) bool {
+	for _, req := range s {
+		value, ok := labels[req.Key]
+		switch req.Op {
+		case "=":
+			if !ok || value != req.Value {
+				return false
+			}
+		case "!=":
+			if ok && value == req.Value {
+				return false
+			}
+		case "exists":
+			if !ok {
+				return false
+			}
+		case "!exists":
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// 解析节点标签配置，格式与选择器相同，例如 "region=eu, proxy=residential"
+func ParseNodeLabels(str string) map[string]string {
+	labels := map[string]string{}
+	for _, item := range strings.Split(str, ",") {
+		arr := strings.SplitN(item, "=", 2)
+		key := strings.TrimSpace(arr[0])
+		if key == "" {
+			continue
+		}
+		if len(arr) == 2 {
+			labels[key] = strings.TrimSpace(arr[1])
+		} else {
+			labels[key] = ""
+		}
+	}
+	return labels
+}
+
+// 校验节点标签，键不能为空且不能包含选择器的分隔符
+func ValidateNodeLabels(labels map[string]string) error {
+	for key := range labels {
+		if key == "" || strings.ContainsAny(key, ",=! ") {
+			return errors.New("invalid label key: " + key)
+		}
+		if strings.Contains(labels[key], ",") {
+			return errors.New("invalid label value: " + labels[key])
+		}
+	}
+	return nil
+}
+
+// 按标签选择器过滤节点
+func FilterNodesByLabelSelector(nodes []model.Node, str string) ([]model.Node, error) {
+	selector, err := ParseLabelSelector(str)
+	if err != nil {
+		return nil, err
+	}
+	var list []model.Node
+	for _, node := range nodes {
+		if selector.Matches(node.Labels) {
+			list = append(list, node)
+		}
+	}
+	return list, nil
+}
+
+// 获取所有满足标签选择器的节点，选择器为空时返回所有节点（运行方式为所有节点时使用）
+func GetNodeListByLabelSelector(str string) ([]model.Node, error) {
+	nodes, err := model.GetNodeList(nil)
+	if err != nil {
+		return nodes, err
+	}
+	return FilterNodesByLabelSelector(nodes, str)
+}
+
+// 从满足标签选择器的在线节点中选择待执行任务最少的节点
+func SelectNodeByLabelSelector(str string) (model.Node, error) {
+	nodes, err := model.GetNodeList(bson.M{"status": constants.StatusOnline})
+	if err != nil {
+		return model.Node{}, err
+	}
+	nodes, err = FilterNodesByLabelSelector(nodes, str)
+	if err != nil {
+		return model.Node{}, err
+	}
+	if len(nodes) == 0 {
+		return model.Node{}, errors.New(fmt.Sprintf("no online node matches label selector \"%s\"", str))
+	}
+
+	// 打乱顺序，待执行任务数相同时随机选择
+	rand.Shuffle(len(nodes), func(i, j int) { nodes[i], nodes[j] = nodes[j], nodes[i] })
+	selected := nodes[0]
+	minCount := -1
+	for _, node := range nodes {
+		count, err := database.RedisClient.ZCard(GetTaskQueueName(node.Id))
+		if err != nil {
+			continue
+		}
+		if minCount < 0 || count < minCount {
+			selected = node
+			minCount = count
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"crawlab/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestNodeLabel(t *testing.T) {
+	Convey("Test ParseLabelSelector", t, func() {
+		selector, err := ParseLabelSelector("region=eu, proxy!=datacenter, gpu, !spot")
+		So(err, ShouldBeNil)
+		So(len(selector), ShouldEqual, 4)
+		So(selector[0], ShouldResemble, LabelRequirement{Key: "region", Op: "=", Value: "eu"})
+		So(selector[1], ShouldResemble, LabelRequirement{Key: "proxy", Op: "!=", Value: "datacenter"})
+		So(selector[2], ShouldResemble, LabelRequirement{Key: "gpu", Op: "exists"})
+		So(selector[3], ShouldResemble, LabelRequirement{Key: "spot", Op: "!exists"})
+
+		selector, err = ParseLabelSelector("")
+		So(err, ShouldBeNil)
+		So(len(selector), ShouldEqual, 0)
+
+		_, err = ParseLabelSelector("=eu")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test LabelSelector.Matches", t, func() {
+		labels := map[string]string{"region": "eu", "proxy": "residential"}
+
+		selector, _ := ParseLabelSelector("region=eu, proxy=residential")
+		So(selector.Matches(labels), ShouldBeTrue)
+
+		selector, _ = ParseLabelSelector("region=us")
+		So(selector.Matches(labels), ShouldBeFalse)
+
+		selector, _ = ParseLabelSelector("region, !gpu, proxy!=datacenter")
+		So(selector.Matches(labels), ShouldBeTrue)
+
+		selector, _ = ParseLabelSelector("")
+		So(selector.Matches(nil), ShouldBeTrue)
+	})
+
+	Convey("Test FilterNodesByLabelSelector", t, func() {
+		nodes := []model.Node{
+			{Name: "eu-1", Labels: map[string]string{"region": "eu"}},
+			{Name: "us-1", Labels: map[string]string{"region": "us"}},
+			{Name: "none"},
+		}
+		list, err := FilterNodesByLabelSelector(nodes, "region=eu")
+		So(err, ShouldBeNil)
+		So(len(list), ShouldEqual, 1)
+		So(list[0].Name, ShouldEqual, "eu-1")
+	})
+
+	Convey("Test ParseNodeLabels and ValidateNodeLabels", t, func() {
+		labels := ParseNodeLabels("region=eu, proxy = residential, gpu,")
+		So(labels, ShouldResemble, map[string]string{"region": "eu", "proxy": "residential", "gpu": ""})
+		So(ValidateNodeLabels(labels), ShouldBeNil)
+		So(ValidateNodeLabels(map[string]string{"a=b": "c"}), ShouldNotBeNil)
+	})
+}
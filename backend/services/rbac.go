@@ -0,0 +1,203 @@
+package services
+
+import (
+	"crawlab/constants"
+	"crawlab/model"
+	"crawlab/utils"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+)
+
+// 项目角色对应的权限
+var projectRolePermissions = map[string][]string{
+	constants.ProjectRoleViewer: {
+		constants.PermissionSpiderView,
+	},
+	constants.ProjectRoleDeveloper: {
+		constants.PermissionSpiderView,
+		constants.PermissionSpiderEdit,
+		constants.PermissionSpiderRun,
+	},
+	constants.ProjectRoleOperator: {
+		constants.PermissionSpiderView,
+		constants.PermissionSpiderRun,
+		constants.PermissionScheduleManage,
+	},
+	constants.ProjectRoleAdmin: {
+		constants.PermissionSpiderView,
+		constants.PermissionSpiderEdit,
+		constants.PermissionSpiderRun,
+		constants.PermissionSpiderDelete,
+		constants.PermissionScheduleManage,
+		constants.PermissionProjectManage,
+	},
+}
+
+func ValidateProjectRole(role string) error {
+	if _, ok := projectRolePermissions[role]; !ok {
+		return errors.New("invalid project role: " + role)
+	}
+	return nil
+}
+
+func GetProjectRolePermissions(role string) []string {
+	return projectRolePermissions[role]
+}
+
+func ProjectRoleHasPermission(role string, permission string) bool {
+	for _, p := range projectRolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// 获取用户在项目中的权限，管理员和项目创建者拥有所有权限
+func GetProjectPermissions(user *model.User, projectId bson.ObjectId) []string {
+	if user.Role == constants.RoleAdmin {
+		return GetProjectRolePermissions(constants.ProjectRoleAdmin)
+	}
+	if !projectId.Valid() || utils.IsObjectIdNull(projectId) {
+		return []string{}
+	}
+	if p, err := model.GetProject(projectId); err == nil && p.UserId == user.Id {
+		return GetProjectRolePermissions(constants.ProjectRoleAdmin)
+	}
+	m, err := model.GetProjectMember(projectId, user.Id)
+	if err != nil {
+		return []string{}
+	}
+	return GetProjectRolePermissions(m.Role)
+}
+
+func HasProjectPermission(user *model.User, projectId bson.ObjectId, permission string) bool {
+	for _, p := range GetProjectPermissions(user, projectId) {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// 爬虫创建者拥有该爬虫的所有权限，其他用户以所在项目的角色为准
+func HasSpiderPermission(user *model.User, spider model.Spider, permission string) bool {
+	if user.Role == constants.RoleAdmin || spider.UserId == user.Id {
+		return true
+	}
+	return HasProjectPermission(user, spider.ProjectId, permission)
+}
+
+// 可以授予用户的全局权限（不属于具体项目的操作）
+var globalPermissions = []string{
+	constants.PermissionScheduleManage,
+	constants.PermissionSpiderRun,
+	constants.PermissionNodeManage,
+	constants.PermissionNodeDepInstall,
+	constants.PermissionVariableManage,
+}
+
+func ValidateGlobalPermissions(permissions []string) error {
+	for _, permission := range permissions {
+		if !utils.StringArrayContains(globalPermissions, permission) {
+			return errors.New("invalid global permission: " + permission)
+		}
+	}
+	return nil
+}
+
+// 不属于具体项目的操作（如节点依赖安装、全局变量），需要管理员显式授予用户全局权限，
+// 项目中的角色（包括项目创建者）不会带来全局权限
+func HasGlobalPermission(user *model.User, permission string) bool {
+	if user.Role == constants.RoleAdmin {
+		return true
+	}
+	return utils.StringArrayContains(user.Permissions, permission)
+}
+
+// 校验用户对爬虫的权限，使用 API Token 时同时校验 Token 限定的范围
+func CheckSpiderPermission(user *model.User, token *model.Token, spiderId bson.ObjectId, permission string) (bool, error) {
+	spider, err := model.GetSpider(spiderId)
+	if err != nil {
+		return false, err
+	}
+	return HasSpiderPermission(user, spider, permission) && TokenAllowsSpider(token, spider), nil
+}
+
+// 校验用户对工作流各步骤爬虫的权限
+func CheckWorkflowStepsPermission(user *model.User, token *model.Token, steps []model.WorkflowStep, permission string) (bool, error) {
+	for _, step := range steps {
+		ok, err := CheckSpiderPermission(user, token, step.SpiderId, permission)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// 定时任务创建者拥有该定时任务的权限，其他用户以爬虫权限为准
+func CheckSchedulePermission(user *model.User, token *model.Token, id bson.ObjectId, permission string) (bool, error) {
+	sch, err := model.GetSchedule(id)
+	if err != nil {
+		return false, err
+	}
+	return checkSpiderOwnedPermission(user, token, sch.SpiderId, sch.UserId, permission)
+}
+
+// 任务创建者拥有该任务的权限，其他用户以爬虫权限为准
+func CheckTaskPermission(user *model.User, token *model.Token, id string, permission string) (bool, error) {
+	t, err := model.GetTask(id)
+	if err != nil {
+		return false, err
+	}
+	return checkSpiderOwnedPermission(user, token, t.SpiderId, t.UserId, permission)
+}
+
+func checkSpiderOwnedPermission(user *model.User, token *model.Token, spiderId bson.ObjectId, ownerId bson.ObjectId, permission string) (bool, error) {
+	spider, err := model.GetSpider(spiderId)
+	if err != nil {
+		return false, err
+	}
+	if !TokenAllowsSpider(token, spider) {
+		return false, nil
+	}
+	return ownerId == user.Id || HasSpiderPermission(user, spider, permission), nil
+}
+
+// 获取用户有角色的项目ID（包括自己创建的项目）
+func GetUserProjectIds(user *model.User) []bson.ObjectId {
+	ids := []bson.ObjectId{}
+	members, _ := model.GetUserProjectMemberList(user.Id)
+	for _, m := range members {
+		ids = append(ids, m.ProjectId)
+	}
+	projects, _ := model.GetProjectList(bson.M{"user_id": user.Id}, "+_id")
+	for _, p := range projects {
+		ids = append(ids, p.Id)
+	}
+	return ids
+}
+
+// 获取用户有角色的项目中的爬虫ID
+func GetUserProjectSpiderIds(user *model.User) []bson.ObjectId {
+	ids := []bson.ObjectId{}
+	spiders, _ := model.GetSpiderAllList(bson.M{"project_id": bson.M{"$in": GetUserProjectIds(user)}})
+	for _, s := range spiders {
+		ids = append(ids, s.Id)
+	}
+	return ids
+}
+
+// 项目列表的权限筛选，普通用户可以看到自己创建和有角色的项目
+func GetProjectAuthQuery(query bson.M, c *gin.Context) bson.M {
+	user := GetCurrentUser(c)
+	if user.Role == constants.RoleAdmin {
+		return query
+	}
+	query["$or"] = []bson.M{
+		{"user_id": user.Id},
+		{"_id": bson.M{"$in": GetUserProjectIds(user)}},
+	}
+	return query
+}
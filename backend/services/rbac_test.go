@@ -0,0 +1,57 @@
+package services
+
+import (
+	"crawlab/constants"
+	"crawlab/model"
+	"github.com/globalsign/mgo/bson"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestProjectRoleHasPermission(t *testing.T) {
+	Convey("Test ProjectRoleHasPermission", t, func() {
+		So(ProjectRoleHasPermission(constants.ProjectRoleViewer, constants.PermissionSpiderView), ShouldBeTrue)
+		So(ProjectRoleHasPermission(constants.ProjectRoleViewer, constants.PermissionSpiderRun), ShouldBeFalse)
+		So(ProjectRoleHasPermission(constants.ProjectRoleDeveloper, constants.PermissionSpiderEdit), ShouldBeTrue)
+		So(ProjectRoleHasPermission(constants.ProjectRoleDeveloper, constants.PermissionScheduleManage), ShouldBeFalse)
+		So(ProjectRoleHasPermission(constants.ProjectRoleOperator, constants.PermissionScheduleManage), ShouldBeTrue)
+		So(ProjectRoleHasPermission(constants.ProjectRoleOperator, constants.PermissionNodeDepInstall), ShouldBeFalse)
+		So(ProjectRoleHasPermission(constants.ProjectRoleOperator, constants.PermissionSpiderEdit), ShouldBeFalse)
+		So(ProjectRoleHasPermission(constants.ProjectRoleAdmin, constants.PermissionProjectManage), ShouldBeTrue)
+		So(ProjectRoleHasPermission("unknown", constants.PermissionSpiderView), ShouldBeFalse)
+
+		So(ValidateProjectRole(constants.ProjectRoleOperator), ShouldBeNil)
+		So(ValidateProjectRole(constants.RoleAdmin), ShouldNotBeNil)
+	})
+}
+
+func TestHasSpiderPermission(t *testing.T) {
+	Convey("Test HasSpiderPermission", t, func() {
+		uid := bson.NewObjectId()
+		spider := model.Spider{UserId: uid, ProjectId: bson.ObjectIdHex(constants.ObjectIdNull)}
+
+		// 管理员和爬虫创建者拥有所有权限
+		So(HasSpiderPermission(&model.User{Id: bson.NewObjectId(), Role: constants.RoleAdmin}, spider, constants.PermissionSpiderDelete), ShouldBeTrue)
+		So(HasSpiderPermission(&model.User{Id: uid, Role: constants.RoleNormal}, spider, constants.PermissionSpiderDelete), ShouldBeTrue)
+
+		// 未分配项目的爬虫，其他普通用户没有权限
+		So(HasSpiderPermission(&model.User{Id: bson.NewObjectId(), Role: constants.RoleNormal}, spider, constants.PermissionSpiderRun), ShouldBeFalse)
+	})
+}
+
+func TestHasGlobalPermission(t *testing.T) {
+	Convey("Test HasGlobalPermission", t, func() {
+		So(HasGlobalPermission(&model.User{Role: constants.RoleAdmin}, constants.PermissionVariableManage), ShouldBeTrue)
+
+		// 普通用户需要被显式授予全局权限
+		user := &model.User{Role: constants.RoleNormal}
+		So(HasGlobalPermission(user, constants.PermissionVariableManage), ShouldBeFalse)
+		user.Permissions = []string{constants.PermissionVariableManage}
+		So(HasGlobalPermission(user, constants.PermissionVariableManage), ShouldBeTrue)
+		So(HasGlobalPermission(user, constants.PermissionNodeManage), ShouldBeFalse)
+
+		So(ValidateGlobalPermissions([]string{constants.PermissionNodeDepInstall}), ShouldBeNil)
+		So(ValidateGlobalPermissions([]string{constants.PermissionSpiderDelete}), ShouldNotBeNil)
+		So(ValidateGlobalPermissions([]string{constants.PermissionProjectManage}), ShouldNotBeNil)
+	})
+}
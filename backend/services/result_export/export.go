@@ -0,0 +1,112 @@
+package result_export
+
+import (
+	"bufio"
+	"crawlab/database"
+	"github.com/globalsign/mgo/bson"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// 每写入多少行刷新一次输出
+const exportFlushRows = 1000
+
+// 获取结果中出现过的全部字段，由 MongoDB 聚合计算，不读取全部数据
+func GetResultColumns(col string, query bson.M) ([]string, error) {
+	s, c := database.GetCol(col)
+	defer s.Close()
+
+	pipeline := []bson.M{
+		{"$match": query},
+		{"$project": bson.M{"kv": bson.M{"$objectToArray": "$$ROOT"}}},
+		{"$unwind": "$kv"},
+		{"$group": bson.M{"_id": "$kv.k"}},
+	}
+	var items []struct {
+		Key string `bson:"_id"`
+	}
+	if err := c.Pipe(pipeline).AllowDiskUse().All(&items); err != nil {
+		return nil, err
+	}
+
+	columns := []string{}
+	for _, item := range items {
+		columns = append(columns, item.Key)
+	}
+	sortColumns(columns)
+	return columns, nil
+}
+
+// _id 和 task_id 在前，其余按名称排序
+func sortColumns(columns []string) {
+	rank := func(col string) int {
+		switch col {
+		case "_id":
+			return 0
+		case "task_id":
+			return 1
+		}
+		return 2
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		ri, rj := rank(columns[i]), rank(columns[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return columns[i] < columns[j]
+	})
+}
+
+// 按游标逐行导出结果，w 实现 http.Flusher 时分块输出
+func ExportResults(w io.Writer, format string, col string, query bson.M) error {
+	columns, err := GetResultColumns(col, query)
+	if err != nil {
+		return err
+	}
+
+	buf := bufio.NewWriter(w)
+	flush := func() error {
+		if err := buf.Flush(); err != nil {
+			return err
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return nil
+	}
+
+	writer, err := NewResultWriter(format, buf, columns)
+	if err != nil {
+		return err
+	}
+
+	s, c := database.GetCol(col)
+	defer s.Close()
+
+	iter := c.Find(query).Batch(exportFlushRows).Iter()
+	var row bson.M
+	n := 0
+	for iter.Next(&row) {
+		if err := writer.WriteRow(row); err != nil {
+			_ = iter.Close()
+			return err
+		}
+		row = nil
+		n++
+		if n%exportFlushRows == 0 {
+			if err := flush(); err != nil {
+				_ = iter.Close()
+				return err
+			}
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return flush()
+}
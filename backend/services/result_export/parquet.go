@@ -0,0 +1,310 @@
+package result_export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/globalsign/mgo/bson"
+	"io"
+)
+
+// ===================== Parquet =====================
+// 所有字段导出为可空的 UTF8 字符串列，不压缩。
+// 按行组缓存数据，每个行组写满后输出，元数据在 Close 时写入文件末尾。
+
+// 每个行组的行数
+const parquetRowGroupSize = 10000
+
+const parquetMagic = "PAR1"
+
+// Parquet 枚举值
+const (
+	parquetTypeByteArray      = 6
+	parquetRepetitionOptional = 1
+	parquetConvertedUtf8      = 0
+	parquetEncodingPlain      = 0
+	parquetEncodingRle        = 3
+	parquetCodecUncompressed  = 0
+	parquetPageTypeData       = 0
+)
+
+type parquetColumnChunk struct {
+	offset           int64
+	numValues        int64
+	uncompressedSize int64
+}
+
+type parquetRowGroup struct {
+	columns  []parquetColumnChunk
+	numRows  int64
+	byteSize int64
+}
+
+type ParquetWriter struct {
+	w         io.Writer
+	offset    int64
+	columns   []string
+	values    [][]*string // 当前行组按列缓存的值
+	rows      int
+	numRows   int64
+	rowGroups []parquetRowGroup
+}
+
+func NewParquetWriter(w io.Writer, columns []string) (ResultWriter, error) {
+	p := &ParquetWriter{w: w, columns: columns}
+	p.resetValues()
+	if err := p.write([]byte(parquetMagic)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *ParquetWriter) resetValues() {
+	p.values = make([][]*string, len(p.columns))
+	p.rows = 0
+}
+
+func (p *ParquetWriter) write(data []byte) error {
+	n, err := p.w.Write(data)
+	p.offset += int64(n)
+	return err
+}
+
+func (p *ParquetWriter) WriteRow(row bson.M) error {
+	for i, col := range p.columns {
+		if str, ok := formatValue(row[col]); ok {
+			p.values[i] = append(p.values[i], &str)
+		} else {
+			p.values[i] = append(p.values[i], nil)
+		}
+	}
+	p.rows++
+	if p.rows >= parquetRowGroupSize {
+		return p.flushRowGroup()
+	}
+	return nil
+}
+
+// 写入当前行组，每列一个数据页
+func (p *ParquetWriter) flushRowGroup() error {
+	if p.rows == 0 {
+		return nil
+	}
+	rg := parquetRowGroup{numRows: int64(p.rows)}
+	for _, values := range p.values {
+		page := encodeParquetPage(values)
+
+		header := newThriftWriter()
+		header.i32Field(1, parquetPageTypeData)
+		header.i32Field(2, int32(len(page)))
+		header.i32Field(3, int32(len(page)))
+		header.structField(5)
+		header.i32Field(1, int32(len(values)))
+		header.i32Field(2, parquetEncodingPlain)
+		header.i32Field(3, parquetEncodingRle)
+		header.i32Field(4, parquetEncodingRle)
+		header.structEnd()
+		header.structEnd()
+
+		chunk := parquetColumnChunk{
+			offset:           p.offset,
+			numValues:        int64(len(values)),
+			uncompressedSize: int64(header.buf.Len() + len(page)),
+		}
+		if err := p.write(header.buf.Bytes()); err != nil {
+			return err
+		}
+		if err := p.write(page); err != nil {
+			return err
+		}
+		rg.columns = append(rg.columns, chunk)
+		rg.byteSize += chunk.uncompressedSize
+	}
+	p.rowGroups = append(p.rowGroups, rg)
+	p.numRows += rg.numRows
+	p.resetValues()
+	return nil
+}
+
+// 数据页：长度前缀的定义级别（RLE）+ PLAIN 编码的非空值
+func encodeParquetPage(values []*string) []byte {
+	levels := &bytes.Buffer{}
+	for i := 0; i < len(values); {
+		defined := values[i] != nil
+		j := i
+		for j < len(values) && (values[j] != nil) == defined {
+			j++
+		}
+		writeUvarint(levels, uint64(j-i)<<1)
+		if defined {
+			levels.WriteByte(1)
+		} else {
+			levels.WriteByte(0)
+		}
+		i = j
+	}
+
+	page := &bytes.Buffer{}
+	_ = binary.Write(page, binary.LittleEndian, uint32(levels.Len()))
+	page.Write(levels.Bytes())
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		_ = binary.Write(page, binary.LittleEndian, uint32(len(*v)))
+		page.WriteString(*v)
+	}
+	return page.Bytes()
+}
+
+func (p *ParquetWriter) Close() error {
+	if err := p.flushRowGroup(); err != nil {
+		return err
+	}
+
+	// FileMetaData
+	meta := newThriftWriter()
+	meta.i32Field(1, 1)
+
+	// schema
+	meta.listField(2, thriftTypeStruct, len(p.columns)+1)
+	meta.structBegin()
+	meta.stringField(4, "schema")
+	meta.i32Field(5, int32(len(p.columns)))
+	meta.structEnd()
+	for _, col := range p.columns {
+		meta.structBegin()
+		meta.i32Field(1, parquetTypeByteArray)
+		meta.i32Field(3, parquetRepetitionOptional)
+		meta.stringField(4, col)
+		meta.i32Field(6, parquetConvertedUtf8)
+		meta.structEnd()
+	}
+
+	meta.i64Field(3, p.numRows)
+
+	// row groups
+	meta.listField(4, thriftTypeStruct, len(p.rowGroups))
+	for _, rg := range p.rowGroups {
+		meta.structBegin()
+		meta.listField(1, thriftTypeStruct, len(rg.columns))
+		for i, chunk := range rg.columns {
+			meta.structBegin()
+			meta.i64Field(2, chunk.offset)
+			meta.structField(3)
+			meta.i32Field(1, parquetTypeByteArray)
+			meta.listField(2, thriftTypeI32, 2)
+			meta.writeVarint(parquetEncodingPlain)
+			meta.writeVarint(parquetEncodingRle)
+			meta.listField(3, thriftTypeBinary, 1)
+			meta.writeString(p.columns[i])
+			meta.i32Field(4, parquetCodecUncompressed)
+			meta.i64Field(5, chunk.numValues)
+			meta.i64Field(6, chunk.uncompressedSize)
+			meta.i64Field(7, chunk.uncompressedSize)
+			meta.i64Field(9, chunk.offset)
+			meta.structEnd()
+			meta.structEnd()
+		}
+		meta.i64Field(2, rg.byteSize)
+		meta.i64Field(3, rg.numRows)
+		meta.structEnd()
+	}
+	meta.stringField(6, "crawlab")
+	meta.structEnd()
+
+	if err := p.write(meta.buf.Bytes()); err != nil {
+		return err
+	}
+	footer := make([]byte, 4)
+	binary.LittleEndian.PutUint32(footer, uint32(meta.buf.Len()))
+	if err := p.write(footer); err != nil {
+		return err
+	}
+	return p.write([]byte(parquetMagic))
+}
+
+// ===================== Thrift Compact Protocol =====================
+const (
+	thriftTypeI32    = 5
+	thriftTypeI64    = 6
+	thriftTypeBinary = 8
+	thriftTypeList   = 9
+	thriftTypeStruct = 12
+)
+
+type thriftWriter struct {
+	buf     *bytes.Buffer
+	lastIds []int16 // 嵌套结构体中上一个字段ID
+}
+
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{buf: &bytes.Buffer{}, lastIds: []int16{0}}
+}
+
+func (t *thriftWriter) fieldBegin(id int16, typ byte) {
+	last := t.lastIds[len(t.lastIds)-1]
+	if delta := id - last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.writeVarint(int64(id))
+	}
+	t.lastIds[len(t.lastIds)-1] = id
+}
+
+// 写入 zigzag 编码的整数
+func (t *thriftWriter) writeVarint(v int64) {
+	writeUvarint(t.buf, uint64((v<<1)^(v>>63)))
+}
+
+func (t *thriftWriter) writeString(s string) {
+	writeUvarint(t.buf, uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+func (t *thriftWriter) i32Field(id int16, v int32) {
+	t.fieldBegin(id, thriftTypeI32)
+	t.writeVarint(int64(v))
+}
+
+func (t *thriftWriter) i64Field(id int16, v int64) {
+	t.fieldBegin(id, thriftTypeI64)
+	t.writeVarint(v)
+}
+
+func (t *thriftWriter) stringField(id int16, s string) {
+	t.fieldBegin(id, thriftTypeBinary)
+	t.writeString(s)
+}
+
+func (t *thriftWriter) listField(id int16, elemType byte, size int) {
+	t.fieldBegin(id, thriftTypeList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		t.buf.WriteByte(0xF0 | elemType)
+		writeUvarint(t.buf, uint64(size))
+	}
+}
+
+// 结构体字段
+func (t *thriftWriter) structField(id int16) {
+	t.fieldBegin(id, thriftTypeStruct)
+	t.structBegin()
+}
+
+// 列表中的结构体
+func (t *thriftWriter) structBegin() {
+	t.lastIds = append(t.lastIds, 0)
+}
+
+func (t *thriftWriter) structEnd() {
+	t.buf.WriteByte(0)
+	t.lastIds = t.lastIds[:len(t.lastIds)-1]
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(tmp, v)
+	buf.Write(tmp[:n])
+}
@@ -0,0 +1,212 @@
+package result_export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/globalsign/mgo/bson"
+	. "github.com/smartystreets/goconvey/convey"
+	"math"
+	"testing"
+)
+
+// 按 Parquet 格式规范读取文件，字段ID取自 parquet.thrift，不依赖写入端的常量
+
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) byte() byte {
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		panic("invalid varint")
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	u := r.uvarint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, 5, 6:
+		return r.varint()
+	case 7:
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.data[r.pos:]))
+		r.pos += 8
+		return v
+	case 8:
+		n := int(r.uvarint())
+		s := string(r.data[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case 9, 10:
+		header := r.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = r.value(header & 0x0F)
+		}
+		return list
+	case 12:
+		return r.structValue()
+	}
+	panic(fmt.Sprintf("unsupported thrift type: %d", typ))
+}
+
+func (r *thriftReader) structValue() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var lastId int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		id := lastId + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.varint())
+		}
+		fields[id] = r.value(header & 0x0F)
+		lastId = id
+	}
+}
+
+// 读取 Parquet 文件，返回列名和各列的值（nil 为空值）
+func readParquet(data []byte) (numRows int64, columns []string, values [][]*string) {
+	So(string(data[:4]), ShouldEqual, parquetMagic)
+	So(string(data[len(data)-4:]), ShouldEqual, parquetMagic)
+
+	// FileMetaData
+	metaLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	meta := (&thriftReader{data: data[len(data)-8-metaLen : len(data)-8]}).structValue()
+	numRows = meta[3].(int64)
+
+	// schema 第一个元素为根节点
+	schema := meta[2].([]interface{})
+	root := schema[0].(map[int16]interface{})
+	So(root[5], ShouldEqual, int64(len(schema)-1))
+	for _, item := range schema[1:] {
+		el := item.(map[int16]interface{})
+		So(el[1], ShouldEqual, int64(6)) // BYTE_ARRAY
+		So(el[3], ShouldEqual, int64(1)) // OPTIONAL
+		So(el[6], ShouldEqual, int64(0)) // UTF8
+		columns = append(columns, el[4].(string))
+	}
+	values = make([][]*string, len(columns))
+
+	var rowGroupRows int64
+	for _, item := range meta[4].([]interface{}) {
+		rg := item.(map[int16]interface{})
+		rowGroupRows += rg[3].(int64)
+		chunks := rg[1].([]interface{})
+		So(len(chunks), ShouldEqual, len(columns))
+		for i, c := range chunks {
+			cm := c.(map[int16]interface{})[3].(map[int16]interface{})
+			So(cm[3], ShouldResemble, []interface{}{columns[i]})
+			So(cm[4], ShouldEqual, int64(0)) // UNCOMPRESSED
+
+			// 数据页
+			r := &thriftReader{data: data, pos: int(cm[9].(int64))}
+			header := r.structValue()
+			So(header[1], ShouldEqual, int64(0)) // DATA_PAGE
+			dph := header[5].(map[int16]interface{})
+			So(dph[1], ShouldEqual, cm[5])
+			page := data[r.pos : r.pos+int(header[3].(int64))]
+			So(int64(r.pos-int(cm[9].(int64))+len(page)), ShouldEqual, cm[7])
+			values[i] = append(values[i], decodeParquetPage(page, int(dph[1].(int64)))...)
+		}
+	}
+	So(rowGroupRows, ShouldEqual, numRows)
+	return numRows, columns, values
+}
+
+// 解码数据页：RLE 定义级别（位宽 1）+ PLAIN 编码的值
+func decodeParquetPage(page []byte, numValues int) []*string {
+	levelsLen := int(binary.LittleEndian.Uint32(page))
+	r := &thriftReader{data: page[4 : 4+levelsLen]}
+	var defined []bool
+	for r.pos < len(r.data) {
+		header := r.uvarint()
+		So(header&1, ShouldEqual, uint64(0)) // RLE 行程
+		level := r.byte()
+		for j := uint64(0); j < header>>1; j++ {
+			defined = append(defined, level == 1)
+		}
+	}
+	So(len(defined), ShouldEqual, numValues)
+
+	pos := 4 + levelsLen
+	var values []*string
+	for _, d := range defined {
+		if !d {
+			values = append(values, nil)
+			continue
+		}
+		n := int(binary.LittleEndian.Uint32(page[pos:]))
+		str := string(page[pos+4 : pos+4+n])
+		values = append(values, &str)
+		pos += 4 + n
+	}
+	So(pos, ShouldEqual, len(page))
+	return values
+}
+
+func TestParquetWriter(t *testing.T) {
+	Convey("Test ParquetWriter can be read back", t, func() {
+		columns := []string{"_id", "name", "price"}
+		var rows []bson.M
+		for i := 0; i < parquetRowGroupSize+5; i++ {
+			row := bson.M{"_id": fmt.Sprintf("id-%d", i), "name": "名称"}
+			if i%3 == 0 {
+				row["price"] = float64(i) + 0.5
+			}
+			rows = append(rows, row)
+		}
+
+		buf := &bytes.Buffer{}
+		w, err := NewParquetWriter(buf, columns)
+		So(err, ShouldBeNil)
+		var writeErr error
+		for _, row := range rows {
+			if err := w.WriteRow(row); err != nil {
+				writeErr = err
+			}
+		}
+		So(writeErr, ShouldBeNil)
+		So(w.Close(), ShouldBeNil)
+
+		numRows, readColumns, values := readParquet(buf.Bytes())
+		So(numRows, ShouldEqual, int64(len(rows)))
+		So(readColumns, ShouldResemble, columns)
+		mismatches := 0
+		for i, col := range columns {
+			So(len(values[i]), ShouldEqual, len(rows))
+			for j, row := range rows {
+				expected, ok := formatValue(row[col])
+				if ok != (values[i][j] != nil) || (ok && *values[i][j] != expected) {
+					mismatches++
+				}
+			}
+		}
+		So(mismatches, ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,165 @@
+package result_export
+
+import (
+	"crawlab/utils"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"github.com/globalsign/mgo/bson"
+	"io"
+	"time"
+)
+
+// 导出格式
+const (
+	FormatCsv     = "csv"
+	FormatJsonl   = "jsonl"
+	FormatXlsx    = "xlsx"
+	FormatParquet = "parquet"
+)
+
+// 结果导出，按行写入，Close 时写入剩余的数据
+type ResultWriter interface {
+	// 写入一行，columns 之外的字段不导出（JSON Lines 除外）
+	WriteRow(row bson.M) error
+	Close() error
+}
+
+type formatInfo struct {
+	ContentType string
+	Extension   string
+	New         func(w io.Writer, columns []string) (ResultWriter, error)
+}
+
+var formats = map[string]formatInfo{
+	FormatCsv: {
+		ContentType: "text/csv",
+		Extension:   "csv",
+		New:         NewCsvWriter,
+	},
+	FormatJsonl: {
+		ContentType: "application/x-ndjson",
+		Extension:   "jsonl",
+		New:         NewJsonlWriter,
+	},
+	FormatXlsx: {
+		ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		Extension:   "xlsx",
+		New:         NewXlsxWriter,
+	},
+	FormatParquet: {
+		ContentType: "application/vnd.apache.parquet",
+		Extension:   "parquet",
+		New:         NewParquetWriter,
+	},
+}
+
+func ValidateFormat(format string) error {
+	if _, ok := formats[format]; !ok {
+		return errors.New("invalid export format: " + format)
+	}
+	return nil
+}
+
+func GetContentType(format string) string {
+	return formats[format].ContentType
+}
+
+func GetFileExtension(format string) string {
+	return formats[format].Extension
+}
+
+func NewResultWriter(format string, w io.Writer, columns []string) (ResultWriter, error) {
+	info, ok := formats[format]
+	if !ok {
+		return nil, errors.New("invalid export format: " + format)
+	}
+	return info.New(w, columns)
+}
+
+// 单元格的值，嵌套对象和数组转为 JSON
+func formatValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case bson.ObjectId:
+		return v.Hex(), true
+	case time.Time:
+		return v.Format(time.RFC3339), true
+	}
+	return utils.InterfaceToString(NormalizeValue(value)), true
+}
+
+// 将 bson 类型转换为便于 JSON 序列化的类型
+func NormalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.ObjectId:
+		return v.Hex()
+	case bson.M:
+		m := map[string]interface{}{}
+		for key, item := range v {
+			m[key] = NormalizeValue(item)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = NormalizeValue(item)
+		}
+		return list
+	}
+	return value
+}
+
+// ===================== CSV =====================
+type CsvWriter struct {
+	columns []string
+	writer  *csv.Writer
+}
+
+func NewCsvWriter(w io.Writer, columns []string) (ResultWriter, error) {
+	// 写入UTF-8 BOM，避免使用Microsoft Excel打开乱码
+	if _, err := io.WriteString(w, "\xEF\xBB\xBF"); err != nil {
+		return nil, err
+	}
+	writer := csv.NewWriter(w)
+	if err := writer.Write(columns); err != nil {
+		return nil, err
+	}
+	return &CsvWriter{columns: columns, writer: writer}, nil
+}
+
+func (c *CsvWriter) WriteRow(row bson.M) error {
+	values := make([]string, len(c.columns))
+	for i, col := range c.columns {
+		values[i], _ = formatValue(row[col])
+	}
+	if err := c.writer.Write(values); err != nil {
+		return err
+	}
+	return c.writer.Error()
+}
+
+func (c *CsvWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// ===================== JSON Lines =====================
+type JsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func NewJsonlWriter(w io.Writer, columns []string) (ResultWriter, error) {
+	return &JsonlWriter{encoder: json.NewEncoder(w)}, nil
+}
+
+func (j *JsonlWriter) WriteRow(row bson.M) error {
+	return j.encoder.Encode(NormalizeValue(row))
+}
+
+func (j *JsonlWriter) Close() error {
+	return nil
+}
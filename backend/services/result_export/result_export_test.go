@@ -0,0 +1,52 @@
+package result_export
+
+import (
+	"bytes"
+	"github.com/globalsign/mgo/bson"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestResultWriter(t *testing.T) {
+	columns := []string{"_id", "task_id", "name", "price"}
+	rows := []bson.M{
+		{"_id": bson.ObjectIdHex("5e8f1e9b7d4c2a0001a1b2c3"), "task_id": "t1", "name": "a"},
+		{"_id": bson.ObjectIdHex("5e8f1e9b7d4c2a0001a1b2c4"), "task_id": "t1", "price": 1.5},
+	}
+	write := func(format string) string {
+		buf := &bytes.Buffer{}
+		w, err := NewResultWriter(format, buf, columns)
+		So(err, ShouldBeNil)
+		for _, row := range rows {
+			So(w.WriteRow(row), ShouldBeNil)
+		}
+		So(w.Close(), ShouldBeNil)
+		return buf.String()
+	}
+
+	Convey("Test CsvWriter", t, func() {
+		lines := strings.Split(strings.TrimSpace(strings.TrimPrefix(write(FormatCsv), "\xEF\xBB\xBF")), "\n")
+		So(len(lines), ShouldEqual, 3)
+		So(lines[0], ShouldEqual, "_id,task_id,name,price")
+		So(lines[1], ShouldEqual, "5e8f1e9b7d4c2a0001a1b2c3,t1,a,")
+		So(lines[2], ShouldEqual, "5e8f1e9b7d4c2a0001a1b2c4,t1,,1.5")
+	})
+
+	Convey("Test JsonlWriter", t, func() {
+		lines := strings.Split(strings.TrimSpace(write(FormatJsonl)), "\n")
+		So(len(lines), ShouldEqual, 2)
+		So(lines[0], ShouldContainSubstring, `"_id":"5e8f1e9b7d4c2a0001a1b2c3"`)
+	})
+
+	Convey("Test truncateRunes", t, func() {
+		So(truncateRunes("abc", 5), ShouldEqual, "abc")
+		So(truncateRunes("名称abc", 2), ShouldEqual, "名称")
+	})
+
+	Convey("Test sortColumns", t, func() {
+		cols := []string{"url", "task_id", "_id", "title"}
+		sortColumns(cols)
+		So(cols, ShouldResemble, []string{"_id", "task_id", "title", "url"})
+	})
+}
@@ -0,0 +1,141 @@
+package result_export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"github.com/globalsign/mgo/bson"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+// ===================== Excel =====================
+// 直接生成 OOXML，工作表按行流式写入 zip，不在内存中保留数据
+
+// Excel 的行数和单元格长度上限
+const (
+	xlsxMaxRows       = 1048576
+	xlsxMaxCellLength = 32767
+)
+
+var xlsxStaticFiles = []struct {
+	Name    string
+	Content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Results" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+type XlsxWriter struct {
+	columns []string
+	zip     *zip.Writer
+	sheet   io.Writer
+	rows    int
+}
+
+func NewXlsxWriter(w io.Writer, columns []string) (ResultWriter, error) {
+	z := zip.NewWriter(w)
+	for _, f := range xlsxStaticFiles {
+		fw, err := z.Create(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(fw, f.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	// 工作表放在最后，逐行写入
+	sheet, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return nil, err
+	}
+
+	x := &XlsxWriter{columns: columns, zip: z, sheet: sheet}
+
+	// 表头
+	header := bson.M{}
+	for _, col := range columns {
+		header[col] = col
+	}
+	if err := x.WriteRow(header); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func (x *XlsxWriter) WriteRow(row bson.M) error {
+	if x.rows >= xlsxMaxRows {
+		return errors.New("too many rows for xlsx")
+	}
+	x.rows++
+
+	if _, err := io.WriteString(x.sheet, "<row>"); err != nil {
+		return err
+	}
+	for _, col := range x.columns {
+		if err := x.writeCell(row[col]); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(x.sheet, "</row>")
+	return err
+}
+
+func (x *XlsxWriter) writeCell(value interface{}) error {
+	// 数字直接写入，便于在 Excel 中计算
+	var num string
+	switch v := value.(type) {
+	case int:
+		num = strconv.Itoa(v)
+	case int64:
+		num = strconv.FormatInt(v, 10)
+	case float64:
+		num = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	if num != "" {
+		_, err := io.WriteString(x.sheet, "<c><v>"+num+"</v></c>")
+		return err
+	}
+
+	str, ok := formatValue(value)
+	if !ok {
+		_, err := io.WriteString(x.sheet, "<c/>")
+		return err
+	}
+	str = truncateRunes(str, xlsxMaxCellLength)
+	if _, err := io.WriteString(x.sheet, `<c t="inlineStr"><is><t xml:space="preserve">`); err != nil {
+		return err
+	}
+	if err := xml.EscapeText(x.sheet, []byte(str)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(x.sheet, "</t></is></c>")
+	return err
+}
+
+func (x *XlsxWriter) Close() error {
+	if _, err := io.WriteString(x.sheet, "</sheetData></worksheet>"); err != nil {
+		return err
+	}
+	return x.zip.Close()
+}
+
+// 按字符截断字符串，避免截断多字节字符
+func truncateRunes(str string, max int) string {
+	if utf8.RuneCountInString(str) <= max {
+		return str
+	}
+	return string([]rune(str)[:max])
+}
@@ -0,0 +1,192 @@
+package result_sink
+
+import (
+	"crawlab/constants"
+	"crawlab/database"
+	"crawlab/lib/cron"
+	"crawlab/model"
+	"crawlab/utils"
+	"errors"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"runtime/debug"
+	"time"
+)
+
+const staleTimeout = constants.DeliveryStaleTimeoutSeconds * time.Second
+
+// 为任务的每个已启用的投递目标创建投递记录并开始投递
+func DeliverTaskResults(spider model.Spider, t model.Task) {
+	for _, sink := range spider.ResultSinks {
+		if !sink.Enabled || !sink.Id.Valid() {
+			continue
+		}
+
+		// 同一任务同一目标只投递一次（唯一索引保证，已有记录时插入失败）
+		d := model.ResultDelivery{
+			TaskId:   t.Id,
+			SpiderId: spider.Id,
+			SinkId:   sink.Id,
+			SinkType: sink.Type,
+			Status:   constants.DeliveryStatusPending,
+		}
+		if err := d.Add(); err != nil {
+			continue
+		}
+		go RunResultDelivery(d.Id)
+	}
+}
+
+// 执行投递，从上次确认的位置继续，每批确认后记录位置，保证至少投递一次
+func RunResultDelivery(id bson.ObjectId) {
+	d, err := model.ClaimResultDelivery(id, staleTimeout)
+	if err != nil {
+		// 已被其他节点领取或已完成
+		if err != mgo.ErrNotFound {
+			log.Errorf("claim result delivery error: %s", err.Error())
+			debug.PrintStack()
+		}
+		return
+	}
+
+	if err := deliver(&d); err != nil {
+		log.Errorf("deliver task results error: %s, task_id: %s, sink: %s", err.Error(), d.TaskId, d.SinkType)
+		d.Status = constants.DeliveryStatusError
+		d.Error = err.Error()
+		d.NextRetryTs = time.Now().Add(getBackoff(d.Attempts))
+	} else {
+		d.Status = constants.DeliveryStatusSuccess
+		d.Error = ""
+	}
+	_ = d.Save()
+}
+
+func deliver(d *model.ResultDelivery) error {
+	t, err := model.GetTask(d.TaskId)
+	if err != nil {
+		return err
+	}
+	spider, err := model.GetSpider(d.SpiderId)
+	if err != nil {
+		return err
+	}
+	var sinkConfig *model.ResultSink
+	for i := range spider.ResultSinks {
+		if spider.ResultSinks[i].Id == d.SinkId {
+			sinkConfig = &spider.ResultSinks[i]
+		}
+	}
+	if sinkConfig == nil {
+		return errors.New("result sink has been removed from spider")
+	}
+
+	sink, err := NewResultSink(*sinkConfig, spider, t.Id)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+
+	s, c := database.GetCol(utils.GetSpiderCol(spider.Col, spider.Name))
+	defer s.Close()
+
+	batchSize := sinkConfig.GetBatchSize()
+	for {
+		query := bson.M{"task_id": t.Id}
+		if d.LastId != nil {
+			query["_id"] = bson.M{"$gt": d.LastId}
+		}
+		var rows []bson.M
+		if err := c.Find(query).Sort("_id").Limit(batchSize).All(&rows); err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		if err := sink.Deliver(d.Batches, rows); err != nil {
+			return fmt.Errorf("deliver batch %d error: %s", d.Batches, err.Error())
+		}
+
+		// 记录已确认的位置
+		d.LastId = rows[len(rows)-1]["_id"]
+		d.Delivered += len(rows)
+		d.Batches++
+		if err := d.Save(); err != nil {
+			return err
+		}
+
+		if len(rows) < batchSize {
+			return nil
+		}
+	}
+}
+
+// 指数退避的重试间隔
+func getBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 10 {
+		attempts = 10
+	}
+	return time.Duration(constants.DeliveryBackoffSecondsBase<<uint(attempts-1)) * time.Second
+}
+
+// 手动重新投递，重置重试次数，已确认的结果不会重复投递
+func RetryResultDelivery(id bson.ObjectId) error {
+	d, err := model.GetResultDelivery(id)
+	if err != nil {
+		return err
+	}
+	if d.Status == constants.DeliveryStatusRunning {
+		return errors.New("result delivery is running")
+	}
+	d.Status = constants.DeliveryStatusPending
+	d.Attempts = 0
+	if err := d.Save(); err != nil {
+		return err
+	}
+	go RunResultDelivery(d.Id)
+	return nil
+}
+
+// 重试到期的投递
+func RetryDueResultDeliveries() {
+	list, err := model.GetDueResultDeliveryList(constants.DeliveryMaxAttemptsDefault, staleTimeout)
+	if err != nil {
+		log.Errorf("get due result deliveries error: %s", err.Error())
+		debug.PrintStack()
+		return
+	}
+	for _, d := range list {
+		go RunResultDelivery(d.Id)
+	}
+}
+
+// 初始化结果投递服务（主节点），定时重试失败的投递
+func InitResultDeliveryService() error {
+	s, c := database.GetCol("result_deliveries")
+	defer s.Close()
+
+	if err := c.EnsureIndex(mgo.Index{
+		Key:    []string{"task_id", "sink_id"},
+		Unique: true,
+	}); err != nil {
+		log.Errorf("ensure result delivery index error: %s", err.Error())
+	}
+	_ = c.EnsureIndex(mgo.Index{
+		Key: []string{"status", "next_retry_ts"},
+	})
+
+	cronExec := cron.New(cron.WithSeconds())
+	spec := fmt.Sprintf("@every %ds", constants.DeliveryRetryIntervalSeconds)
+	if _, err := cronExec.AddFunc(spec, RetryDueResultDeliveries); err != nil {
+		log.Errorf("add result delivery cron error: %s", err.Error())
+		debug.PrintStack()
+		return err
+	}
+	cronExec.Start()
+	return nil
+}
@@ -0,0 +1,51 @@
+package result_sink
+
+import (
+	"context"
+	"crawlab/model"
+	"crawlab/services/result_export"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/globalsign/mgo/bson"
+	"github.com/segmentio/kafka-go"
+	"time"
+)
+
+// 写入 Kafka，每条结果一条消息，以结果ID为 key
+type KafkaSink struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaSink(sink model.ResultSink, spider model.Spider, taskId string) (ResultSink, error) {
+	if len(sink.Brokers) == 0 || sink.Topic == "" {
+		return nil, errors.New("brokers and topic are required")
+	}
+	writer := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      sink.Brokers,
+		Topic:        sink.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: -1, // 等待所有副本确认
+		BatchSize:    sink.GetBatchSize(),
+		WriteTimeout: 30 * time.Second,
+	})
+	return &KafkaSink{writer: writer}, nil
+}
+
+func (k *KafkaSink) Deliver(part int, rows []bson.M) error {
+	messages := make([]kafka.Message, len(rows))
+	for i, row := range rows {
+		value, err := json.Marshal(result_export.NormalizeValue(row))
+		if err != nil {
+			return err
+		}
+		messages[i] = kafka.Message{Key: []byte(fmt.Sprint(result_export.NormalizeValue(row["_id"]))), Value: value}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	return k.writer.WriteMessages(ctx, messages...)
+}
+
+func (k *KafkaSink) Close() error {
+	return k.writer.Close()
+}
@@ -0,0 +1,44 @@
+package result_sink
+
+import (
+	"crawlab/constants"
+	"crawlab/model"
+	"errors"
+	"github.com/globalsign/mgo/bson"
+)
+
+// 结果投递目标
+type ResultSink interface {
+	// 投递一批结果，part 为批次序号，同一批次重试时序号不变
+	Deliver(part int, rows []bson.M) error
+	// 释放连接
+	Close() error
+}
+
+var sinkFactories = map[string]func(sink model.ResultSink, spider model.Spider, taskId string) (ResultSink, error){
+	constants.ResultSinkPostgres: NewSqlSink,
+	constants.ResultSinkMysql:    NewSqlSink,
+	constants.ResultSinkKafka:    NewKafkaSink,
+	constants.ResultSinkS3:       NewS3Sink,
+}
+
+// 校验投递目标类型
+func ValidateSinkType(sinkType string) error {
+	if _, ok := sinkFactories[sinkType]; !ok {
+		return errors.New("invalid result sink type: " + sinkType)
+	}
+	return nil
+}
+
+// 根据配置创建投递目标
+func NewResultSink(sink model.ResultSink, spider model.Spider, taskId string) (ResultSink, error) {
+	factory, ok := sinkFactories[sink.Type]
+	if !ok {
+		return nil, errors.New("invalid result sink type: " + sink.Type)
+	}
+	sink, err := sink.Decrypted()
+	if err != nil {
+		return nil, err
+	}
+	return factory(sink, spider, taskId)
+}
@@ -0,0 +1,66 @@
+package result_sink
+
+import (
+	"crawlab/constants"
+	"crawlab/model"
+	"github.com/globalsign/mgo/bson"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSqlSink(t *testing.T) {
+	Convey("Test buildInsert", t, func() {
+		row := bson.M{"_id": bson.ObjectIdHex("5e8f1e9b7d4c2a0001a1b2c3"), "name": "a", "tags": []interface{}{"x"}, "unknown": 1}
+		columns := map[string]bool{"_id": true, "name": true, "tags": true}
+
+		s := &SqlSink{Type: constants.ResultSinkPostgres, Table: "crawl.results", columns: columns}
+		query, args := s.buildInsert(row)
+		So(query, ShouldEqual, `INSERT INTO "crawl"."results" ("_id", "name", "tags") VALUES ($1, $2, $3)`)
+		So(args, ShouldResemble, []interface{}{"5e8f1e9b7d4c2a0001a1b2c3", "a", `["x"]`})
+
+		s = &SqlSink{Type: constants.ResultSinkMysql, Table: "results", columns: columns}
+		query, _ = s.buildInsert(row)
+		So(query, ShouldEqual, "INSERT INTO `results` (`_id`, `name`, `tags`) VALUES (?, ?, ?)")
+	})
+}
+
+func TestS3Sink(t *testing.T) {
+	Convey("Test S3Sink Deliver", t, func() {
+		var path, auth, body string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			auth = r.Header.Get("Authorization")
+			data, _ := ioutil.ReadAll(r.Body)
+			body = string(data)
+		}))
+		defer server.Close()
+
+		sink, err := NewS3Sink(model.ResultSink{
+			Type:      constants.ResultSinkS3,
+			Endpoint:  server.URL,
+			Bucket:    "bucket",
+			Prefix:    "crawlab",
+			AccessKey: "key",
+			SecretKey: "secret",
+		}, model.Spider{Name: "spider"}, "task")
+		So(err, ShouldBeNil)
+
+		err = sink.Deliver(2, []bson.M{{"name": "a"}, {"name": "b"}})
+		So(err, ShouldBeNil)
+		So(path, ShouldEqual, "/bucket/crawlab/spider/task/part-00002.jsonl")
+		So(auth, ShouldStartWith, "AWS4-HMAC-SHA256 Credential=key/")
+		So(strings.Count(body, "\n"), ShouldEqual, 2)
+	})
+}
+
+func TestGetBackoff(t *testing.T) {
+	Convey("Test getBackoff", t, func() {
+		So(getBackoff(1), ShouldEqual, time.Minute)
+		So(getBackoff(3), ShouldEqual, 4*time.Minute)
+	})
+}
@@ -0,0 +1,149 @@
+package result_sink
+
+import (
+	"bytes"
+	"crawlab/model"
+	"crawlab/services/result_export"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/globalsign/mgo/bson"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// 写入 S3 兼容存储，每批结果一个 JSON Lines 文件
+// 文件名由任务ID和批次序号决定，重试时覆盖同名文件，不会产生重复文件
+type S3Sink struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	KeyPrefix string
+	client    *http.Client
+}
+
+func NewS3Sink(sink model.ResultSink, spider model.Spider, taskId string) (ResultSink, error) {
+	if sink.Endpoint == "" || sink.Bucket == "" {
+		return nil, errors.New("endpoint and bucket are required")
+	}
+	region := sink.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3Sink{
+		Endpoint:  strings.TrimRight(sink.Endpoint, "/"),
+		Region:    region,
+		Bucket:    sink.Bucket,
+		AccessKey: sink.AccessKey,
+		SecretKey: sink.SecretKey,
+		KeyPrefix: path.Join(sink.Prefix, spider.Name, taskId),
+		client:    &http.Client{Timeout: 2 * time.Minute},
+	}, nil
+}
+
+// 批次文件的对象名
+func (s *S3Sink) GetObjectKey(part int) string {
+	return strings.TrimLeft(path.Join(s.KeyPrefix, fmt.Sprintf("part-%05d.jsonl", part)), "/")
+}
+
+func (s *S3Sink) Deliver(part int, rows []bson.M) error {
+	var buf bytes.Buffer
+	writer, _ := result_export.NewJsonlWriter(&buf, nil)
+	for _, row := range rows {
+		if err := writer.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	return s.putObject(s.GetObjectKey(part), buf.Bytes(), "application/x-ndjson")
+}
+
+func (s *S3Sink) putObject(key string, body []byte, contentType string) error {
+	// 使用 path-style 地址，兼容 MinIO 等存储
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return err
+	}
+	u.Path = u.Path + "/" + s.Bucket + "/" + key
+	req, err := http.NewRequest(http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, body, time.Now().UTC())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("put object %s error: %d %s", key, res.StatusCode, string(msg))
+	}
+	return nil
+}
+
+func (s *S3Sink) Close() error {
+	return nil
+}
+
+// AWS Signature Version 4 签名
+func (s *S3Sink) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "content-type:" + req.Header.Get("Content-Type") + "\n" +
+		"host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSha256(key, s.Region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,163 @@
+package result_sink
+
+import (
+	"crawlab/constants"
+	"crawlab/model"
+	"crawlab/services/result_export"
+	"crawlab/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/globalsign/mgo/bson"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 写入 Postgres / MySQL 中已存在的表，只写入表中已有的字段，嵌套字段以 JSON 写入
+type SqlSink struct {
+	Type    string
+	Table   string
+	db      *sql.DB
+	columns map[string]bool
+}
+
+func NewSqlSink(sink model.ResultSink, spider model.Spider, taskId string) (ResultSink, error) {
+	if sink.Dsn == "" || sink.Table == "" {
+		return nil, errors.New("dsn and table are required")
+	}
+	driver := "postgres"
+	if sink.Type == constants.ResultSinkMysql {
+		driver = "mysql"
+	}
+	db, err := sql.Open(driver, sink.Dsn)
+	if err != nil {
+		return nil, err
+	}
+	s := &SqlSink{Type: sink.Type, Table: sink.Table, db: db}
+	if s.columns, err = s.getColumns(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if len(s.columns) == 0 {
+		_ = db.Close()
+		return nil, errors.New("table not found or has no columns: " + sink.Table)
+	}
+	return s, nil
+}
+
+// 表中已有的字段
+func (s *SqlSink) getColumns() (map[string]bool, error) {
+	var query string
+	var args []interface{}
+	if s.Type == constants.ResultSinkMysql {
+		query = "SELECT column_name FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ?"
+		args = []interface{}{s.Table}
+	} else {
+		schema, table := "public", s.Table
+		if arr := strings.SplitN(s.Table, ".", 2); len(arr) == 2 {
+			schema, table = arr[0], arr[1]
+		}
+		query = "SELECT column_name FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2"
+		args = []interface{}{schema, table}
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+func (s *SqlSink) quote(name string) string {
+	if s.Type == constants.ResultSinkMysql {
+		return "`" + strings.Replace(name, "`", "``", -1) + "`"
+	}
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func (s *SqlSink) quoteTable() string {
+	var parts []string
+	for _, part := range strings.SplitN(s.Table, ".", 2) {
+		parts = append(parts, s.quote(part))
+	}
+	return strings.Join(parts, ".")
+}
+
+func (s *SqlSink) placeholder(i int) string {
+	if s.Type == constants.ResultSinkMysql {
+		return "?"
+	}
+	return fmt.Sprintf("$%d", i)
+}
+
+// 生成插入语句，只包含表中已有的字段
+func (s *SqlSink) buildInsert(row bson.M) (string, []interface{}) {
+	var keys []string
+	for key := range row {
+		if s.columns[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return "", nil
+	}
+
+	cols := make([]string, len(keys))
+	placeholders := make([]string, len(keys))
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		cols[i] = s.quote(key)
+		placeholders[i] = s.placeholder(i + 1)
+		args[i] = sqlValue(row[key])
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", s.quoteTable(), strings.Join(cols, ", "), strings.Join(placeholders, ", "))
+	return query, args
+}
+
+// 转换为数据库驱动支持的类型
+func sqlValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, int, int32, int64, float32, float64, time.Time, []byte:
+		return v
+	case bson.ObjectId:
+		return v.Hex()
+	}
+	return utils.InterfaceToString(result_export.NormalizeValue(value))
+}
+
+// 一个批次在同一个事务中写入
+func (s *SqlSink) Deliver(part int, rows []bson.M) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		query, args := s.buildInsert(row)
+		if query == "" {
+			continue
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SqlSink) Close() error {
+	return s.db.Close()
+}
@@ -74,6 +74,10 @@ func GetService(msg entity.RpcMessage) Service {
 		return &GetInstalledDepsService{msg: msg}
 	case constants.RpcGetNodeStats:
 		return &GetNodeStatsService{msg: msg}
+	case constants.RpcGetDepCacheFiles:
+		return &GetDepCacheFilesService{msg: msg}
+	case constants.RpcGetDepCacheFile:
+		return &GetDepCacheFileService{msg: msg}
 	}
 	return nil
 }
@@ -0,0 +1,403 @@
+package rpc
+
+import (
+	"crawlab/constants"
+	"crawlab/entity"
+	"crawlab/model"
+	"crawlab/utils"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/apex/log"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 每次 RPC 传输的文件块大小
+const depCacheChunkSize = 1024 * 1024
+
+// 同一语言的缓存同时只同步一次
+var depCacheSyncLock sync.Map
+
+// ===================== RPC =====================
+
+// 获取主节点的离线依赖缓存文件列表
+type GetDepCacheFilesService struct {
+	msg entity.RpcMessage
+}
+
+func (s *GetDepCacheFilesService) ServerHandle() (entity.RpcMessage, error) {
+	lang := utils.GetRpcParam("lang", s.msg.Params)
+	files, err := GetDepCacheFilesLocal(lang)
+	if err != nil {
+		s.msg.Error = err.Error()
+		return s.msg, err
+	}
+	resultStr, _ := json.Marshal(files)
+	s.msg.Result = string(resultStr)
+	return s.msg, nil
+}
+
+func (s *GetDepCacheFilesService) ClientHandle() (o interface{}, err error) {
+	// 发起 RPC 请求，获取服务端数据
+	s.msg, err = ClientFunc(s.msg)()
+	if err != nil {
+		return o, err
+	}
+
+	// 反序列化
+	var output []entity.DepCacheFile
+	if err := json.Unmarshal([]byte(s.msg.Result), &output); err != nil {
+		return o, err
+	}
+	o = output
+	return
+}
+
+// 读取主节点的离线依赖缓存文件块
+type GetDepCacheFileService struct {
+	msg entity.RpcMessage
+}
+
+func (s *GetDepCacheFileService) ServerHandle() (entity.RpcMessage, error) {
+	lang := utils.GetRpcParam("lang", s.msg.Params)
+	path := utils.GetRpcParam("path", s.msg.Params)
+	offset, _ := strconv.ParseInt(utils.GetRpcParam("offset", s.msg.Params), 10, 64)
+	data, err := ReadDepCacheFileLocal(lang, path, offset)
+	if err != nil {
+		s.msg.Error = err.Error()
+		return s.msg, err
+	}
+	s.msg.Result = base64.StdEncoding.EncodeToString(data)
+	return s.msg, nil
+}
+
+func (s *GetDepCacheFileService) ClientHandle() (o interface{}, err error) {
+	// 发起 RPC 请求，获取服务端数据
+	s.msg, err = ClientFunc(s.msg)()
+	if err != nil {
+		return o, err
+	}
+	return base64.StdEncoding.DecodeString(s.msg.Result)
+}
+
+func GetDepCacheFilesRemote(nodeId string, lang string) (files []entity.DepCacheFile, err error) {
+	params := make(map[string]string)
+	params["lang"] = lang
+	s := GetService(entity.RpcMessage{
+		NodeId:  nodeId,
+		Method:  constants.RpcGetDepCacheFiles,
+		Params:  params,
+		Timeout: 60,
+	})
+	output, err := s.ClientHandle()
+	if err != nil {
+		return
+	}
+	files = output.([]entity.DepCacheFile)
+	return
+}
+
+func ReadDepCacheFileRemote(nodeId string, lang string, path string, offset int64) (data []byte, err error) {
+	params := make(map[string]string)
+	params["lang"] = lang
+	params["path"] = path
+	params["offset"] = strconv.FormatInt(offset, 10)
+	s := GetService(entity.RpcMessage{
+		NodeId:  nodeId,
+		Method:  constants.RpcGetDepCacheFile,
+		Params:  params,
+		Timeout: 60,
+	})
+	output, err := s.ClientHandle()
+	if err != nil {
+		return
+	}
+	data = output.([]byte)
+	return
+}
+
+// ===================== 本地缓存 =====================
+
+func validateDepCacheLang(lang string) error {
+	if lang != constants.Python && lang != constants.Nodejs {
+		return errors.New(fmt.Sprintf("%s is not implemented", lang))
+	}
+	return nil
+}
+
+// 缓存目录中的文件路径，不允许访问缓存目录以外的文件
+func getDepCacheFilePath(lang string, path string) (string, error) {
+	if err := validateDepCacheLang(lang); err != nil {
+		return "", err
+	}
+	root := utils.GetDepCachePath(lang)
+	fullPath := filepath.Join(root, filepath.FromSlash(path))
+	if path == "" || !strings.HasPrefix(fullPath, root+string(filepath.Separator)) {
+		return "", errors.New("invalid dep cache file path: " + path)
+	}
+	return fullPath, nil
+}
+
+// 获取本地离线依赖缓存文件列表
+func GetDepCacheFilesLocal(lang string) (files []entity.DepCacheFile, err error) {
+	files = []entity.DepCacheFile{}
+	if err := validateDepCacheLang(lang); err != nil {
+		return files, err
+	}
+	root := utils.GetDepCachePath(lang)
+	if !utils.Exists(root) {
+		return files, nil
+	}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			// npm 日志不需要同步
+			if info.Name() == "_logs" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".download") {
+			return nil
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		md5Str, err := getFileMd5(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, entity.DepCacheFile{
+			Path: filepath.ToSlash(relPath),
+			Size: info.Size(),
+			Md5:  md5Str,
+		})
+		return nil
+	})
+	return files, err
+}
+
+func getFileMd5(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 读取本地离线依赖缓存文件块
+func ReadDepCacheFileLocal(lang string, path string, offset int64) ([]byte, error) {
+	fullPath, err := getDepCacheFilePath(lang, path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data := make([]byte, depCacheChunkSize)
+	n, err := f.ReadAt(data, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+// 从主节点同步离线依赖缓存到本地，删除主节点已不存在的文件
+func SyncDepCache(lang string) error {
+	if model.IsMaster() {
+		return nil
+	}
+
+	lock, _ := depCacheSyncLock.LoadOrStore(lang, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	master, err := model.GetMasterNode()
+	if err != nil {
+		return err
+	}
+	files, err := GetDepCacheFilesRemote(master.Id.Hex(), lang)
+	if err != nil {
+		return err
+	}
+
+	localFiles, err := GetDepCacheFilesLocal(lang)
+	if err != nil {
+		return err
+	}
+	localMd5Map := map[string]string{}
+	for _, f := range localFiles {
+		localMd5Map[f.Path] = f.Md5
+	}
+
+	remotePaths := map[string]bool{}
+	for _, f := range files {
+		remotePaths[f.Path] = true
+		if localMd5Map[f.Path] == f.Md5 {
+			continue
+		}
+		if err := downloadDepCacheFile(master.Id.Hex(), lang, f); err != nil {
+			return err
+		}
+	}
+
+	for path := range localMd5Map {
+		if remotePaths[path] {
+			continue
+		}
+		if fullPath, err := getDepCacheFilePath(lang, path); err == nil {
+			_ = os.Remove(fullPath)
+		}
+	}
+	return nil
+}
+
+// 分块下载主节点的缓存文件，下载完成并校验后再替换本地文件
+func downloadDepCacheFile(nodeId string, lang string, file entity.DepCacheFile) error {
+	fullPath, err := getDepCacheFilePath(lang, file.Path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmpPath := fullPath + ".download"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	h := md5.New()
+	var offset int64
+	for offset < file.Size {
+		data, err := ReadDepCacheFileRemote(nodeId, lang, file.Path, offset)
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+		if len(data) == 0 {
+			break
+		}
+		if _, err := f.Write(data); err != nil {
+			_ = f.Close()
+			return err
+		}
+		h.Write(data)
+		offset += int64(len(data))
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if md5Str := hex.EncodeToString(h.Sum(nil)); md5Str != file.Md5 {
+		return errors.New(fmt.Sprintf("dep cache file md5 mismatch: %s", file.Path))
+	}
+	return os.Rename(tmpPath, fullPath)
+}
+
+// 下载依赖及其子依赖到主节点的离线缓存
+func AddDepCacheLocal(lang string, depName string) (string, error) {
+	root := utils.GetDepCachePath(lang)
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	var cmd *exec.Cmd
+	if lang == constants.Python {
+		cmd = exec.Command("pip", "download", depName, "-d", root, "-i", utils.GetPythonIndexUrl())
+	} else if lang == constants.Nodejs {
+		// 安装到临时目录以将依赖及其子依赖写入 npm 缓存
+		tmpDir, err := ioutil.TempDir("", "crawlab-dep-cache")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(tmpDir)
+		cmd = exec.Command("npm", "install", depName, "--prefix", tmpDir, "--cache", root, "--registry", utils.GetNodejsRegistry())
+	} else {
+		return "", errors.New(fmt.Sprintf("%s is not implemented", lang))
+	}
+
+	outputBytes, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Errorf(string(outputBytes))
+		log.Errorf(err.Error())
+		debug.PrintStack()
+		return string(outputBytes), err
+	}
+	return string(outputBytes), nil
+}
+
+// 上传 Python 依赖包到主节点的离线缓存
+func SaveDepCacheFileLocal(lang string, fileName string, reader io.Reader) error {
+	if lang != constants.Python {
+		return errors.New(fmt.Sprintf("uploading is not supported for %s", lang))
+	}
+	if !strings.HasSuffix(fileName, ".whl") && !strings.HasSuffix(fileName, ".tar.gz") && !strings.HasSuffix(fileName, ".zip") {
+		return errors.New("only .whl, .tar.gz and .zip files are supported")
+	}
+	fullPath, err := getDepCacheFilePath(lang, filepath.Base(fileName))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.Create(fullPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, reader)
+	return err
+}
+
+// 删除主节点离线缓存中的文件
+func RemoveDepCacheFileLocal(lang string, path string) error {
+	fullPath, err := getDepCacheFilePath(lang, path)
+	if err != nil {
+		return err
+	}
+	return os.Remove(fullPath)
+}
+
+// 安装依赖时的依赖源参数，启用离线缓存时先从主节点同步缓存，并只从缓存安装
+func GetDepInstallArgs(lang string) ([]string, error) {
+	if utils.IsDepCacheEnabled() {
+		if err := SyncDepCache(lang); err != nil {
+			return nil, err
+		}
+		root := utils.GetDepCachePath(lang)
+		if lang == constants.Nodejs {
+			return []string{"--offline", "--cache", root}, nil
+		}
+		return []string{"--no-index", "--find-links", root}, nil
+	}
+	if lang == constants.Nodejs {
+		return []string{"--registry", utils.GetNodejsRegistry()}, nil
+	}
+	return []string{"-i", utils.GetPythonIndexUrl()}, nil
+}
@@ -0,0 +1,47 @@
+package rpc
+
+import (
+	"crawlab/constants"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDepCache(t *testing.T) {
+	root, _ := ioutil.TempDir("", "crawlab-deps-cache")
+	defer os.RemoveAll(root)
+	viper.Set("deps.cache.path", root)
+
+	Convey("Test GetDepCacheFilesLocal", t, func() {
+		_ = os.MkdirAll(filepath.Join(root, constants.Python), os.ModePerm)
+		_ = ioutil.WriteFile(filepath.Join(root, constants.Python, "requests-2.23.0-py2.py3-none-any.whl"), []byte("wheel"), 0644)
+
+		files, err := GetDepCacheFilesLocal(constants.Python)
+		So(err, ShouldBeNil)
+		So(len(files), ShouldEqual, 1)
+		So(files[0].Path, ShouldEqual, "requests-2.23.0-py2.py3-none-any.whl")
+		So(files[0].Md5, ShouldEqual, "5eda0ea98768e91b815fa6667e4f0178")
+
+		data, err := ReadDepCacheFileLocal(constants.Python, files[0].Path, 2)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "eel")
+	})
+
+	Convey("Test invalid paths", t, func() {
+		_, err := ReadDepCacheFileLocal(constants.Python, "../secret", 0)
+		So(err, ShouldNotBeNil)
+		_, err = GetDepCacheFilesLocal("../")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test GetDepInstallArgs", t, func() {
+		viper.Set("deps.cache.enabled", "N")
+		viper.Set("deps.python.indexUrl", "http://pypi.local/simple")
+		args, err := GetDepInstallArgs(constants.Python)
+		So(err, ShouldBeNil)
+		So(args, ShouldResemble, []string{"-i", "http://pypi.local/simple"})
+	})
+}
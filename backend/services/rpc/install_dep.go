@@ -1,9 +1,11 @@
 package rpc
 
 import (
+	"bytes"
 	"crawlab/constants"
 	"crawlab/entity"
 	"crawlab/utils"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/apex/log"
@@ -18,71 +20,81 @@ type InstallDepService struct {
 func (s *InstallDepService) ServerHandle() (entity.RpcMessage, error) {
 	lang := utils.GetRpcParam("lang", s.msg.Params)
 	depName := utils.GetRpcParam("dep_name", s.msg.Params)
-	if err := InstallDepLocal(lang, depName); err != nil {
+	output, err := InstallDepLocal(lang, depName)
+	s.msg.Result = utils.ObjectToString(output)
+	if err != nil {
 		s.msg.Error = err.Error()
 		return s.msg, err
 	}
-	s.msg.Result = "success"
 	return s.msg, nil
 }
 
 func (s *InstallDepService) ClientHandle() (o interface{}, err error) {
-	// 发起 RPC 请求，获取服务端数据
-	_, err = ClientFunc(s.msg)()
-	if err != nil {
-		return
-	}
+	// 发起 RPC 请求，获取服务端数据，失败时同样返回命令输出
+	s.msg, err = ClientFunc(s.msg)()
+	return parseCmdOutput(s.msg.Result), err
+}
+
+// 执行命令，分别获取标准输出和标准错误
+func runCmdWithOutput(cmd *exec.Cmd) (entity.CmdOutput, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	return entity.CmdOutput{Stdout: stdout.String(), Stderr: stderr.String()}, err
+}
 
-	return
+// 解析 RPC 返回的命令输出
+func parseCmdOutput(result string) (output entity.CmdOutput) {
+	_ = json.Unmarshal([]byte(result), &output)
+	return output
 }
 
-func InstallDepLocal(lang string, depName string) error {
+func InstallDepLocal(lang string, depName string) (entity.CmdOutput, error) {
 	if lang == constants.Python {
-		_, err := InstallPythonDepLocal(depName)
-		if err != nil {
-			return err
-		}
+		return InstallPythonDepLocal(depName)
 	} else if lang == constants.Nodejs {
-		_, err := InstallNodejsDepLocal(depName)
-		if err != nil {
-			return err
-		}
-	} else {
-		return errors.New(fmt.Sprintf("%s is not implemented", lang))
+		return InstallNodejsDepLocal(depName)
 	}
-	return nil
+	return entity.CmdOutput{}, errors.New(fmt.Sprintf("%s is not implemented", lang))
 }
 
 // 安装Python本地依赖
-func InstallPythonDepLocal(depName string) (string, error) {
-	// 依赖镜像URL
-	url := "https://pypi.tuna.tsinghua.edu.cn/simple"
+func InstallPythonDepLocal(depName string) (entity.CmdOutput, error) {
+	// 依赖源参数
+	args, err := GetDepInstallArgs(constants.Python)
+	if err != nil {
+		return entity.CmdOutput{Stderr: err.Error()}, err
+	}
 
-	cmd := exec.Command("pip", "install", depName, "-i", url)
-	outputBytes, err := cmd.Output()
+	cmd := exec.Command("pip", append([]string{"install", depName}, args...)...)
+	output, err := runCmdWithOutput(cmd)
 	if err != nil {
 		log.Errorf(err.Error())
 		debug.PrintStack()
-		return fmt.Sprintf("error: %s", err.Error()), err
+		return output, err
 	}
-	return string(outputBytes), nil
+	return output, nil
 }
 
-func InstallNodejsDepLocal(depName string) (string, error) {
-	// 依赖镜像URL
-	url := "https://registry.npm.taobao.org"
+func InstallNodejsDepLocal(depName string) (entity.CmdOutput, error) {
+	// 依赖源参数
+	args, err := GetDepInstallArgs(constants.Nodejs)
+	if err != nil {
+		return entity.CmdOutput{Stderr: err.Error()}, err
+	}
 
-	cmd := exec.Command("npm", "install", depName, "-g", "--registry", url)
-	outputBytes, err := cmd.Output()
+	cmd := exec.Command("npm", append([]string{"install", depName, "-g"}, args...)...)
+	output, err := runCmdWithOutput(cmd)
 	if err != nil {
 		log.Errorf(err.Error())
 		debug.PrintStack()
-		return fmt.Sprintf("error: %s", err.Error()), err
+		return output, err
 	}
-	return string(outputBytes), nil
+	return output, nil
 }
 
-func InstallDepRemote(nodeId string, lang string, depName string) (err error) {
+func InstallDepRemote(nodeId string, lang string, depName string, timeout int) (output entity.CmdOutput, err error) {
 	params := make(map[string]string)
 	params["lang"] = lang
 	params["dep_name"] = depName
@@ -90,11 +102,8 @@ func InstallDepRemote(nodeId string, lang string, depName string) (err error) {
 		NodeId:  nodeId,
 		Method:  constants.RpcInstallDep,
 		Params:  params,
-		Timeout: 300,
+		Timeout: timeout,
 	})
-	_, err = s.ClientHandle()
-	if err != nil {
-		return
-	}
-	return
+	o, err := s.ClientHandle()
+	return o.(entity.CmdOutput), err
 }
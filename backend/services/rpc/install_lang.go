@@ -19,7 +19,7 @@ type InstallLangService struct {
 func (s *InstallLangService) ServerHandle() (entity.RpcMessage, error) {
 	lang := utils.GetRpcParam("lang", s.msg.Params)
 	output, err := InstallLangLocal(lang)
-	s.msg.Result = output
+	s.msg.Result = utils.ObjectToString(output)
 	if err != nil {
 		s.msg.Error = err.Error()
 		return s.msg, err
@@ -28,46 +28,37 @@ func (s *InstallLangService) ServerHandle() (entity.RpcMessage, error) {
 }
 
 func (s *InstallLangService) ClientHandle() (o interface{}, err error) {
-	// 发起 RPC 请求，获取服务端数据
-	go func() {
-		_, err := ClientFunc(s.msg)()
-		if err != nil {
-			return
-		}
-	}()
-
-	return
+	// 发起 RPC 请求，获取服务端数据，失败时同样返回命令输出
+	s.msg, err = ClientFunc(s.msg)()
+	return parseCmdOutput(s.msg.Result), err
 }
 
 // 本地安装语言
-func InstallLangLocal(lang string) (o string, err error) {
+func InstallLangLocal(lang string) (entity.CmdOutput, error) {
 	l := utils.GetLangFromLangNamePlain(lang)
 	if l.Name == "" || l.InstallScript == "" {
-		return "", errors.New(fmt.Sprintf("%s is not implemented", lang))
+		return entity.CmdOutput{}, errors.New(fmt.Sprintf("%s is not implemented", lang))
 	}
 	cmd := exec.Command("/bin/sh", path.Join("scripts", l.InstallScript))
-	output, err := cmd.Output()
+	output, err := runCmdWithOutput(cmd)
 	if err != nil {
 		log.Error(err.Error())
 		debug.PrintStack()
-		return string(output), err
+		return output, err
 	}
-	return
+	return output, nil
 }
 
 // 远端安装语言
-func InstallLangRemote(nodeId string, lang string) (o string, err error) {
+func InstallLangRemote(nodeId string, lang string, timeout int) (output entity.CmdOutput, err error) {
 	params := make(map[string]string)
 	params["lang"] = lang
 	s := GetService(entity.RpcMessage{
 		NodeId:  nodeId,
 		Method:  constants.RpcInstallLang,
 		Params:  params,
-		Timeout: 60,
+		Timeout: timeout,
 	})
-	_, err = s.ClientHandle()
-	if err != nil {
-		return
-	}
-	return
+	o, err := s.ClientHandle()
+	return o.(entity.CmdOutput), err
 }
@@ -18,67 +18,54 @@ type UninstallDepService struct {
 func (s *UninstallDepService) ServerHandle() (entity.RpcMessage, error) {
 	lang := utils.GetRpcParam("lang", s.msg.Params)
 	depName := utils.GetRpcParam("dep_name", s.msg.Params)
-	if err := UninstallDepLocal(lang, depName); err != nil {
+	output, err := UninstallDepLocal(lang, depName)
+	s.msg.Result = utils.ObjectToString(output)
+	if err != nil {
 		s.msg.Error = err.Error()
 		return s.msg, err
 	}
-	s.msg.Result = "success"
 	return s.msg, nil
 }
 
 func (s *UninstallDepService) ClientHandle() (o interface{}, err error) {
-	// 发起 RPC 请求，获取服务端数据
-	_, err = ClientFunc(s.msg)()
-	if err != nil {
-		return
-	}
-
-	return
+	// 发起 RPC 请求，获取服务端数据，失败时同样返回命令输出
+	s.msg, err = ClientFunc(s.msg)()
+	return parseCmdOutput(s.msg.Result), err
 }
 
-func UninstallDepLocal(lang string, depName string) error {
+func UninstallDepLocal(lang string, depName string) (entity.CmdOutput, error) {
 	if lang == constants.Python {
-		output, err := UninstallPythonDepLocal(depName)
-		if err != nil {
-			log.Debugf(output)
-			return err
-		}
+		return UninstallPythonDepLocal(depName)
 	} else if lang == constants.Nodejs {
-		output, err := UninstallNodejsDepLocal(depName)
-		if err != nil {
-			log.Debugf(output)
-			return err
-		}
-	} else {
-		return errors.New(fmt.Sprintf("%s is not implemented", lang))
+		return UninstallNodejsDepLocal(depName)
 	}
-	return nil
+	return entity.CmdOutput{}, errors.New(fmt.Sprintf("%s is not implemented", lang))
 }
 
-func UninstallPythonDepLocal(depName string) (string, error) {
+func UninstallPythonDepLocal(depName string) (entity.CmdOutput, error) {
 	cmd := exec.Command("pip", "uninstall", "-y", depName)
-	outputBytes, err := cmd.Output()
+	output, err := runCmdWithOutput(cmd)
 	if err != nil {
-		log.Errorf(string(outputBytes))
+		log.Errorf(output.Stderr)
 		log.Errorf(err.Error())
 		debug.PrintStack()
-		return fmt.Sprintf("error: %s", err.Error()), err
+		return output, err
 	}
-	return string(outputBytes), nil
+	return output, nil
 }
 
-func UninstallNodejsDepLocal(depName string) (string, error) {
+func UninstallNodejsDepLocal(depName string) (entity.CmdOutput, error) {
 	cmd := exec.Command("npm", "uninstall", depName, "-g")
-	outputBytes, err := cmd.Output()
+	output, err := runCmdWithOutput(cmd)
 	if err != nil {
 		log.Errorf(err.Error())
 		debug.PrintStack()
-		return fmt.Sprintf("error: %s", err.Error()), err
+		return output, err
 	}
-	return string(outputBytes), nil
+	return output, nil
 }
 
-func UninstallDepRemote(nodeId string, lang string, depName string) (err error) {
+func UninstallDepRemote(nodeId string, lang string, depName string, timeout int) (output entity.CmdOutput, err error) {
 	params := make(map[string]string)
 	params["lang"] = lang
 	params["dep_name"] = depName
@@ -86,11 +73,8 @@ func UninstallDepRemote(nodeId string, lang string, depName string) (err error)
 		NodeId:  nodeId,
 		Method:  constants.RpcUninstallDep,
 		Params:  params,
-		Timeout: 300,
+		Timeout: timeout,
 	})
-	_, err = s.ClientHandle()
-	if err != nil {
-		return
-	}
-	return
+	o, err := s.ClientHandle()
+	return o.(entity.CmdOutput), err
 }
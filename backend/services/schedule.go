@@ -9,16 +9,137 @@ import (
 	"github.com/globalsign/mgo/bson"
 	uuid "github.com/satori/go.uuid"
 	"runtime/debug"
+	"strings"
+	"time"
 )
 
 var Sched *Scheduler
 
+var cronParser = cron.NewParser(
+	cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
 type Scheduler struct {
 	cron *cron.Cron
 }
 
+// 获取定时任务未结束的任务
+func GetScheduleUnfinishedTasks(id bson.ObjectId) ([]model.Task, error) {
+	query := bson.M{
+		"schedule_id": id,
+		"status": bson.M{
+			"$in": []string{constants.StatusPending, constants.StatusRunning},
+		},
+	}
+	return model.GetTaskList(query, 0, constants.Infinite, "-create_ts")
+}
+
+// 根据重叠策略判断本次触发是否执行
+func HandleScheduleOverlap(s model.Schedule) bool {
+	if s.OverlapPolicy == "" || s.OverlapPolicy == constants.ScheduleOverlapAllow {
+		return true
+	}
+
+	tasks, err := GetScheduleUnfinishedTasks(s.Id)
+	if err != nil {
+		log.Errorf("get schedule unfinished tasks error: %s", err.Error())
+		debug.PrintStack()
+		return false
+	}
+	if len(tasks) == 0 {
+		return true
+	}
+
+	var taskIds []string
+	for _, t := range tasks {
+		taskIds = append(taskIds, t.Id)
+	}
+
+	switch s.OverlapPolicy {
+	case constants.ScheduleOverlapSkip:
+		// 跳过
+		addScheduleSkippedTick(s, constants.ScheduleSkippedReasonRunning, taskIds)
+		return false
+	case constants.ScheduleOverlapQueue:
+		// 排队，已有排队时跳过
+		ok, err := model.SetScheduleQueued(s.Id)
+		if err != nil {
+			log.Errorf("set schedule queued error: %s", err.Error())
+			debug.PrintStack()
+			return false
+		}
+		if !ok {
+			addScheduleSkippedTick(s, constants.ScheduleSkippedReasonQueued, taskIds)
+		}
+		return false
+	case constants.ScheduleOverlapReplace:
+		// 取消未结束的任务
+		for _, t := range tasks {
+			if err := CancelTask(t.Id); err != nil {
+				log.Errorf("cancel schedule task error: %s, task_id: %s", err.Error(), t.Id)
+				debug.PrintStack()
+			}
+		}
+		return true
+	}
+
+	return true
+}
+
+func addScheduleSkippedTick(s model.Schedule, reason string, taskIds []string) {
+	log.Infof("schedule '%s' skipped: %s", s.Name, reason)
+	tick := model.ScheduleSkippedTick{
+		Ts:      time.Now(),
+		Reason:  reason,
+		TaskIds: taskIds,
+	}
+	_ = model.AddScheduleSkippedTick(s.Id, tick)
+}
+
+// 定时任务的任务结束后，运行排队中的触发
+func RunQueuedSchedule(id bson.ObjectId) {
+	tasks, err := GetScheduleUnfinishedTasks(id)
+	if err != nil {
+		log.Errorf("get schedule unfinished tasks error: %s", err.Error())
+		debug.PrintStack()
+		return
+	}
+	if len(tasks) > 0 {
+		return
+	}
+
+	ok, err := model.PopScheduleQueued(id)
+	if err != nil {
+		log.Errorf("pop schedule queued error: %s", err.Error())
+		debug.PrintStack()
+		return
+	}
+	if !ok {
+		return
+	}
+
+	s, err := model.GetSchedule(id)
+	if err != nil {
+		log.Errorf("get schedule error: %s", err.Error())
+		debug.PrintStack()
+		return
+	}
+	if s.Status == constants.ScheduleStatusStop {
+		return
+	}
+	AddScheduleTask(s)()
+}
+
 func AddScheduleTask(s model.Schedule) func() {
 	return func() {
+		// 记录触发时间
+		_ = model.UpdateScheduleLastFireTs(s.Id, time.Now())
+
+		// 重叠策略
+		if !HandleScheduleOverlap(s) {
+			return
+		}
+
 		// 生成任务ID
 		id := uuid.NewV4()
 
@@ -44,20 +165,26 @@ func AddScheduleTask(s model.Schedule) func() {
 		}
 
 		if s.RunType == constants.RunTypeAllNodes {
-			// 所有节点
-			nodes, err := model.GetNodeList(nil)
+			// 所有节点（满足标签选择器）
+			nodes, err := GetNodeListByLabelSelector(s.LabelSelector)
 			if err != nil {
+				log.Errorf(err.Error())
+				debug.PrintStack()
 				return
 			}
 			for _, node := range nodes {
 				t := model.Task{
-					Id:         id.String(),
-					SpiderId:   s.SpiderId,
-					NodeId:     node.Id,
-					Param:      param,
-					UserId:     s.UserId,
-					RunType:    constants.RunTypeAllNodes,
-					ScheduleId: s.Id,
+					Id:            id.String(),
+					SpiderId:      s.SpiderId,
+					NodeId:        node.Id,
+					Param:         param,
+					UserId:        s.UserId,
+					RunType:       constants.RunTypeAllNodes,
+					ScheduleId:    s.Id,
+					Timeout:       s.Timeout,
+					Priority:      s.Priority,
+					SpiderVersion: s.SpiderVersion,
+					LabelSelector: s.LabelSelector,
 				}
 
 				if _, err := AddTask(t); err != nil {
@@ -67,12 +194,16 @@ func AddScheduleTask(s model.Schedule) func() {
 		} else if s.RunType == constants.RunTypeRandom {
 			// 随机
 			t := model.Task{
-				Id:         id.String(),
-				SpiderId:   s.SpiderId,
-				Param:      param,
-				UserId:     s.UserId,
-				RunType:    constants.RunTypeRandom,
-				ScheduleId: s.Id,
+				Id:            id.String(),
+				SpiderId:      s.SpiderId,
+				Param:         param,
+				UserId:        s.UserId,
+				RunType:       constants.RunTypeRandom,
+				ScheduleId:    s.Id,
+				Timeout:       s.Timeout,
+				Priority:      s.Priority,
+				SpiderVersion: s.SpiderVersion,
+				LabelSelector: s.LabelSelector,
 			}
 			if _, err := AddTask(t); err != nil {
 				log.Errorf(err.Error())
@@ -83,13 +214,16 @@ func AddScheduleTask(s model.Schedule) func() {
 			// 指定节点
 			for _, nodeId := range s.NodeIds {
 				t := model.Task{
-					Id:         id.String(),
-					SpiderId:   s.SpiderId,
-					NodeId:     nodeId,
-					Param:      param,
-					UserId:     s.UserId,
-					RunType:    constants.RunTypeSelectedNodes,
-					ScheduleId: s.Id,
+					Id:            id.String(),
+					SpiderId:      s.SpiderId,
+					NodeId:        nodeId,
+					Param:         param,
+					UserId:        s.UserId,
+					RunType:       constants.RunTypeSelectedNodes,
+					ScheduleId:    s.Id,
+					Timeout:       s.Timeout,
+					Priority:      s.Priority,
+					SpiderVersion: s.SpiderVersion,
 				}
 
 				if _, err := AddTask(t); err != nil {
@@ -115,6 +249,12 @@ func (s *Scheduler) Start() error {
 	// 启动cron服务
 	s.cron.Start()
 
+	// 补跑停机期间错过的定时任务
+	if err := CatchUpSchedules(); err != nil {
+		log.Errorf("catch up schedules error: %s", err.Error())
+		debug.PrintStack()
+	}
+
 	// 更新任务列表
 	if err := s.Update(); err != nil {
 		log.Errorf("update scheduler error: %s", err.Error())
@@ -134,7 +274,7 @@ func (s *Scheduler) Start() error {
 }
 
 func (s *Scheduler) AddJob(job model.Schedule) error {
-	spec := job.Cron
+	spec := GetScheduleSpec(job)
 
 	// 添加定时任务
 	eid, err := s.cron.AddFunc(spec, AddScheduleTask(job))
@@ -144,15 +284,12 @@ func (s *Scheduler) AddJob(job model.Schedule) error {
 		return err
 	}
 
-	// 更新EntryID
-	job.EntryId = eid
-
-	// 更新状态
-	job.Status = constants.ScheduleStatusRunning
-	job.Enabled = true
-
-	// 保存定时任务
-	if err := job.Save(); err != nil {
+	// 更新EntryID和状态
+	if err := model.UpdateScheduleFields(job.Id, bson.M{
+		"entry_id": eid,
+		"status":   constants.ScheduleStatusRunning,
+		"enabled":  true,
+	}); err != nil {
 		log.Errorf("job save error: %s", err.Error())
 		debug.PrintStack()
 		return err
@@ -170,16 +307,146 @@ func (s *Scheduler) RemoveAll() {
 
 // 验证cron表达式是否正确
 func ParserCron(spec string) error {
-	parser := cron.NewParser(
-		cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
-	)
+	if _, err := cronParser.Parse(spec); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 验证时区是否正确，为空时使用服务器时区
+func ValidateTimezone(tz string) error {
+	if tz == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return errors.New("invalid timezone: " + tz)
+	}
+	return nil
+}
+
+// 获取带时区的cron表达式
+func GetScheduleSpec(s model.Schedule) string {
+	if s.Timezone == "" || strings.HasPrefix(s.Cron, "TZ=") || strings.HasPrefix(s.Cron, "CRON_TZ=") {
+		return s.Cron
+	}
+	return "CRON_TZ=" + s.Timezone + " " + s.Cron
+}
+
+// 获取定时任务下次运行时间（定时任务所在时区）
+func GetScheduleNextRunTs(s model.Schedule) (time.Time, error) {
+	list, err := GetScheduleNextRunTsList(s, 1)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return list[0], nil
+}
+
+// 获取定时任务接下来 n 次运行时间（定时任务所在时区）
+func GetScheduleNextRunTsList(s model.Schedule, n int) ([]time.Time, error) {
+	var list []time.Time
+
+	sched, err := cronParser.Parse(GetScheduleSpec(s))
+	if err != nil {
+		return list, err
+	}
+
+	loc := time.Local
+	if s.Timezone != "" {
+		if loc, err = time.LoadLocation(s.Timezone); err != nil {
+			return list, err
+		}
+	}
+
+	next := time.Now()
+	for i := 0; i < n; i++ {
+		next = sched.Next(next)
+		if next.IsZero() {
+			break
+		}
+		list = append(list, next.In(loc))
+	}
+	if len(list) == 0 {
+		return list, errors.New("no next run time")
+	}
+	return list, nil
+}
+
+// 获取 from 到 to 之间错过的触发时间，最多返回最近的 max 个
+func GetScheduleMissedFireTs(s model.Schedule, from time.Time, to time.Time, max int) ([]time.Time, error) {
+	var list []time.Time
+
+	sched, err := cronParser.Parse(GetScheduleSpec(s))
+	if err != nil {
+		return list, err
+	}
+	if max <= 0 {
+		return list, nil
+	}
+
+	// 从 to 往前成倍扩大查找范围，找到 max 个或到达 from 为止，
+	// 避免停机时间较长时从 from 开始逐个遍历触发时间
+	for d := time.Second; ; d *= 2 {
+		start := to.Add(-d)
+		if d >= to.Sub(from) {
+			start = from
+		}
+
+		list = nil
+		for next := sched.Next(start); !next.IsZero() && next.Before(to); next = sched.Next(next) {
+			list = append(list, next)
+			if len(list) > max {
+				list = list[1:]
+			}
+		}
+		if len(list) >= max || start.Equal(from) {
+			return list, nil
+		}
+	}
+}
 
-	if _, err := parser.Parse(spec); err != nil {
+// 补跑主节点停机期间错过的定时任务
+func CatchUpSchedules() error {
+	sList, err := model.GetScheduleList(nil)
+	if err != nil {
+		log.Errorf("get scheduler list error: %s", err.Error())
+		debug.PrintStack()
 		return err
 	}
+
+	now := time.Now()
+	for _, sch := range sList {
+		if sch.Status == constants.ScheduleStatusStop || sch.CatchUp <= 0 || sch.LastFireTs.IsZero() {
+			continue
+		}
+
+		max := sch.CatchUp
+		if max > constants.ScheduleCatchUpMax {
+			max = constants.ScheduleCatchUpMax
+		}
+		missed, err := GetScheduleMissedFireTs(sch, sch.LastFireTs, now, max)
+		if err != nil {
+			log.Errorf("get schedule missed fire ts error: %s, schedule: %s", err.Error(), sch.Name)
+			continue
+		}
+
+		for _, ts := range missed {
+			log.Infof("catch up schedule '%s', missed fire time: %s", sch.Name, ts.String())
+			AddScheduleTask(sch)()
+		}
+	}
+
 	return nil
 }
 
+// 验证重叠策略是否正确
+func ValidateOverlapPolicy(policy string) error {
+	switch policy {
+	case "", constants.ScheduleOverlapAllow, constants.ScheduleOverlapSkip, constants.ScheduleOverlapQueue, constants.ScheduleOverlapReplace:
+		return nil
+	}
+	return errors.New("invalid overlap policy: " + policy)
+}
+
 // 禁用定时任务
 func (s *Scheduler) Disable(id bson.ObjectId) error {
 	schedule, err := model.GetSchedule(id)
@@ -194,10 +461,10 @@ func (s *Scheduler) Disable(id bson.ObjectId) error {
 	s.cron.Remove(schedule.EntryId)
 
 	// 更新状态
-	schedule.Status = constants.ScheduleStatusStop
-	schedule.Enabled = false
-
-	if err = schedule.Save(); err != nil {
+	if err = model.UpdateScheduleFields(schedule.Id, bson.M{
+		"status":  constants.ScheduleStatusStop,
+		"enabled": false,
+	}); err != nil {
 		return err
 	}
 	return nil
@@ -209,6 +476,12 @@ func (s *Scheduler) Enable(id bson.ObjectId) error {
 	if err != nil {
 		return err
 	}
+
+	// 禁用期间错过的触发不补跑
+	if err := model.UpdateScheduleLastFireTs(schedule.Id, time.Now()); err != nil {
+		return err
+	}
+
 	if err := s.AddJob(schedule); err != nil {
 		return err
 	}
@@ -245,6 +518,9 @@ func (s *Scheduler) Update() error {
 		// 兼容以前版本
 		if job.UserId.Hex() == "" {
 			job.UserId = user.Id
+			if err := model.UpdateScheduleFields(job.Id, bson.M{"user_id": user.Id}); err != nil {
+				return err
+			}
 		}
 
 		// 添加到定时任务
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"crawlab/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestGetScheduleNextRunTs(t *testing.T) {
+	Convey("Test GetScheduleNextRunTs", t, func() {
+		So(ValidateTimezone(""), ShouldBeNil)
+		So(ValidateTimezone("America/New_York"), ShouldBeNil)
+		So(ValidateTimezone("Mars/Olympus"), ShouldNotBeNil)
+
+		s := model.Schedule{Cron: "0 30 9 * * *", Timezone: "America/New_York"}
+		So(GetScheduleSpec(s), ShouldEqual, "CRON_TZ=America/New_York 0 30 9 * * *")
+
+		// 下次运行时间以定时任务的时区展示
+		next, err := GetScheduleNextRunTs(s)
+		So(err, ShouldBeNil)
+		So(next.Location().String(), ShouldEqual, "America/New_York")
+		So(next.Hour(), ShouldEqual, 9)
+		So(next.Minute(), ShouldEqual, 30)
+	})
+}
+
+func TestGetScheduleMissedFireTs(t *testing.T) {
+	Convey("Test GetScheduleMissedFireTs", t, func() {
+		s := model.Schedule{Cron: "0 0 * * * *"}
+
+		// 接下来的运行时间
+		list, err := GetScheduleNextRunTsList(s, 3)
+		So(err, ShouldBeNil)
+		So(len(list), ShouldEqual, 3)
+		So(list[1].Sub(list[0]), ShouldEqual, time.Hour)
+
+		// 停机5小时，最多补跑3次（最近的3次）
+		from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+		to := from.Add(5*time.Hour + time.Minute)
+		missed, err := GetScheduleMissedFireTs(s, from, to, 3)
+		So(err, ShouldBeNil)
+		So(len(missed), ShouldEqual, 3)
+		So(missed[0], ShouldEqual, from.Add(3*time.Hour))
+		So(missed[2], ShouldEqual, from.Add(5*time.Hour))
+
+		// 错过的次数少于 max 时全部返回
+		missed, err = GetScheduleMissedFireTs(s, from, to, 10)
+		So(err, ShouldBeNil)
+		So(len(missed), ShouldEqual, 5)
+		So(missed[0], ShouldEqual, from.Add(time.Hour))
+
+		// 秒级定时任务停机一年，只查找最近的触发时间
+		s = model.Schedule{Cron: "* * * * * *"}
+		to = from.AddDate(1, 0, 0)
+		missed, err = GetScheduleMissedFireTs(s, from, to, 3)
+		So(err, ShouldBeNil)
+		So(len(missed), ShouldEqual, 3)
+		So(missed[2], ShouldEqual, to.Add(-time.Second))
+	})
+}
@@ -37,9 +37,26 @@ type SpiderUploadMessage struct {
 
 // 从主节点上传爬虫到GridFS
 func UploadSpiderToGridFsFromMaster(spider model.Spider) error {
+	return UploadSpiderVersionFromMaster(spider, spider.UserId, "")
+}
+
+// 从主节点上传爬虫到GridFS，并记录为新版本
+func UploadSpiderVersionFromMaster(spider model.Spider, uid bson.ObjectId, message string) error {
 	// 爬虫所在目录
 	spiderDir := spider.Src
 
+	// 目录内容与最新版本相同时（如 Git 同步没有更新）不重复上传
+	dirMd5, err := utils.GetDirMd5(spiderDir, []string{spider_handler.Md5File, ".git"})
+	if err != nil {
+		return err
+	}
+	if latest, err := model.GetSpiderLatestVersion(spider.Id); err == nil &&
+		latest.DirMd5 == dirMd5 && latest.FileId == spider.FileId {
+		spiderSync := spider_handler.SpiderSync{Spider: spider}
+		spiderSync.CheckIsScrapy()
+		return nil
+	}
+
 	// 打包为 zip 文件
 	files, err := utils.GetFilesFromDir(spiderDir)
 	if err != nil {
@@ -52,31 +69,27 @@ func UploadSpiderToGridFsFromMaster(spider model.Spider) error {
 		return err
 	}
 
-	// 获取 GridFS 实例
-	s, gf := database.GetGridFs("files")
-	defer s.Close()
-
-	// 判断文件是否已经存在
-	var gfFile model.GridFs
-	if err := gf.Find(bson.M{"filename": spiderZipFileName}).One(&gfFile); err == nil {
-		// 已经存在文件，则删除
-		log.Errorf(gfFile.Id.Hex() + " already exists. removing...")
-		if err := gf.RemoveId(gfFile.Id); err != nil {
-			log.Errorf(err.Error())
-			debug.PrintStack()
-			return err
-		}
-	}
-
-	// 上传到GridFs
+	// 上传到GridFs（保留历史版本的文件）
 	fid, err := UploadToGridFs(spiderZipFileName, tmpFilePath)
 	if err != nil {
 		log.Errorf("upload to grid fs error: %s", err.Error())
 		return err
 	}
 
+	// 记录版本
+	v, err := addSpiderVersion(spider, model.SpiderVersion{
+		FileId:  fid,
+		DirMd5:  dirMd5,
+		Message: message,
+		UserId:  uid,
+	})
+	if err != nil {
+		return err
+	}
+
 	// 保存爬虫 FileId
 	spider.FileId = fid
+	spider.Version = v.Version
 	if err := spider.Save(); err != nil {
 		return err
 	}
@@ -191,6 +204,9 @@ func PublishAllSpiders() {
 
 // 发布爬虫
 func PublishSpider(spider model.Spider) {
+	// 同步定时任务指定的爬虫版本
+	defer PublishSpiderPinnedVersions(spider)
+
 	var gfFile *model.GridFs
 	if spider.FileId.Hex() != constants.ObjectIdNull {
 		// 查询gf file，不存在则标记为爬虫文件不存在
@@ -259,6 +275,9 @@ func RemoveSpider(id string) error {
 	path := filepath.Join(viper.GetString("spider.path"), spider.Name)
 	utils.RemoveFiles(path)
 
+	// 删除爬虫独立依赖环境
+	spider_handler.RemoveSpiderEnvs(id)
+
 	// 删除其他节点的爬虫目录
 	msg := entity.NodeMessage{
 		Type:     constants.MsgTypeRemoveSpider,
@@ -568,6 +587,21 @@ func InitDemoSpiders() {
 }
 
 // 启动爬虫服务
+// 清理本节点上已删除爬虫的独立依赖环境（删除爬虫时节点不在线的情况）
+func GcSpiderEnvs() {
+	spiders, err := model.GetSpiderAllList(nil)
+	if err != nil {
+		log.Errorf("get spider list error: %s", err.Error())
+		debug.PrintStack()
+		return
+	}
+	var spiderIds []string
+	for _, spider := range spiders {
+		spiderIds = append(spiderIds, spider.Id.Hex())
+	}
+	spider_handler.GcSpiderEnvs(spiderIds)
+}
+
 func InitSpiderService() error {
 	// 构造定时任务执行器
 	cPub := cron.New(cron.WithSeconds())
@@ -578,6 +612,9 @@ func InitSpiderService() error {
 	// 启动定时任务
 	cPub.Start()
 
+	// 清理已删除爬虫的独立依赖环境
+	go GcSpiderEnvs()
+
 	if model.IsMaster() && viper.GetString("setting.demoSpiders") == "Y" {
 		// 初始化Demo爬虫
 		InitDemoSpiders()
@@ -596,6 +633,16 @@ func InitSpiderService() error {
 
 		// 清理UserId
 		InitSpiderCleanUserIds()
+
+		// 加密旧版本明文存储的 Git 密码
+		if err := model.MigrateSpiderGitPasswords(); err != nil {
+			log.Errorf("migrate spider git passwords error: %s", err.Error())
+		}
+
+		// 爬虫版本号唯一索引（已有重复版本号时仅记录错误）
+		if err := model.InitSpiderVersionIndexes(); err != nil {
+			log.Errorf("init spider version indexes error: %s", err.Error())
+		}
 	}
 
 	return nil
@@ -0,0 +1,286 @@
+package spider_handler
+
+import (
+	"crawlab/constants"
+	"crawlab/model"
+	"crawlab/services/rpc"
+	"crawlab/utils"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+const (
+	// 环境安装完成的标记文件
+	envReadyFile = ".ready"
+)
+
+// 爬虫的独立依赖环境，按依赖文件内容的哈希缓存
+// 目录结构: <envPath>/<spider_id>/<lang>-<hash>
+type SpiderEnv struct {
+	Lang        string // python / node
+	DepFileName string // 依赖文件名
+	Hash        string // 依赖文件内容的哈希
+	Dir         string // 环境目录
+}
+
+// 支持独立环境的语言及其依赖文件
+var envDepFiles = []struct {
+	Lang        string
+	DepFileName string
+}{
+	{constants.Python, "requirements.txt"},
+	{constants.Nodejs, "package.json"},
+}
+
+// 同一个环境同时只构建一次
+var envLockMap sync.Map
+
+// 是否启用独立依赖环境
+func IsIsolatedEnvEnabled() bool {
+	return viper.GetString("spider.isolatedEnv") != "N"
+}
+
+// 独立依赖环境的根目录
+func GetEnvRootPath() string {
+	if p := viper.GetString("spider.envPath"); p != "" {
+		return p
+	}
+	return filepath.Join(filepath.Dir(viper.GetString("spider.path")), "envs")
+}
+
+// 爬虫的独立依赖环境目录
+func GetSpiderEnvPath(spiderId string) string {
+	return filepath.Join(GetEnvRootPath(), spiderId)
+}
+
+// 根据爬虫目录中的依赖文件获取所需的环境，没有依赖文件的语言不需要环境
+func GetSpiderEnvs(spider model.Spider, dir string) (envs []SpiderEnv) {
+	for _, d := range envDepFiles {
+		data, err := ioutil.ReadFile(filepath.Join(dir, d.DepFileName))
+		if err != nil {
+			continue
+		}
+		hash := getDepFileHash(data)
+		envs = append(envs, SpiderEnv{
+			Lang:        d.Lang,
+			DepFileName: d.DepFileName,
+			Hash:        hash,
+			Dir:         filepath.Join(GetSpiderEnvPath(spider.Id.Hex()), d.Lang+"-"+hash),
+		})
+	}
+	return envs
+}
+
+func getDepFileHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// 环境是否已安装完成
+func (e SpiderEnv) IsReady() bool {
+	return utils.Exists(filepath.Join(e.Dir, envReadyFile))
+}
+
+// 激活环境所需的环境变量，不包括 PATH
+func (e SpiderEnv) GetEnvVars() []string {
+	switch e.Lang {
+	case constants.Python:
+		return []string{"VIRTUAL_ENV=" + e.Dir}
+	case constants.Nodejs:
+		return []string{"NODE_PATH=" + filepath.Join(e.Dir, "node_modules")}
+	}
+	return nil
+}
+
+// 需要加入 PATH 的可执行文件目录
+func (e SpiderEnv) GetBinDir() string {
+	switch e.Lang {
+	case constants.Python:
+		return getVenvBinDir(e.Dir)
+	case constants.Nodejs:
+		return filepath.Join(e.Dir, "node_modules", ".bin")
+	}
+	return ""
+}
+
+func getVenvBinDir(dir string) string {
+	if runtime.GOOS == constants.Windows {
+		return filepath.Join(dir, "Scripts")
+	}
+	return filepath.Join(dir, "bin")
+}
+
+// 安装环境，已安装时直接返回，安装中时等待安装完成
+func (e SpiderEnv) Ensure(srcDir string) error {
+	lock, _ := envLockMap.LoadOrStore(e.Dir, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	if e.IsReady() {
+		return nil
+	}
+
+	// 清除上次未安装完成的环境，安装完成后才写入标记文件，避免使用安装了一半的环境
+	// virtualenv 中的脚本使用绝对路径，不能先安装到临时目录再移动
+	_ = os.RemoveAll(e.Dir)
+	if err := os.MkdirAll(e.Dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	var err error
+	switch e.Lang {
+	case constants.Python:
+		err = installPythonEnv(e.Dir, filepath.Join(srcDir, e.DepFileName))
+	case constants.Nodejs:
+		err = installNodejsEnv(e.Dir, srcDir, e.DepFileName)
+	default:
+		err = errors.New(fmt.Sprintf("%s is not supported", e.Lang))
+	}
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(e.Dir, envReadyFile), []byte(e.Hash), 0644)
+	}
+	if err != nil {
+		_ = os.RemoveAll(e.Dir)
+		return err
+	}
+
+	// 删除该语言旧的环境
+	removeOutdatedEnvs(e)
+	return nil
+}
+
+// 创建 virtualenv 并安装 requirements.txt
+func installPythonEnv(dir string, depFilePath string) error {
+	python, err := lookPath("python3", "python")
+	if err != nil {
+		return err
+	}
+	if err := runCmd("", python, "-m", "venv", dir); err != nil {
+		return err
+	}
+	args, err := rpc.GetDepInstallArgs(constants.Python)
+	if err != nil {
+		return err
+	}
+	pip := filepath.Join(getVenvBinDir(dir), "pip")
+	return runCmd("", pip, append([]string{"install", "-r", depFilePath}, args...)...)
+}
+
+// 在环境目录中安装 package.json 中的依赖
+func installNodejsEnv(dir string, srcDir string, depFileName string) error {
+	npm, err := lookPath("npm")
+	if err != nil {
+		return err
+	}
+	for _, fileName := range []string{depFileName, "package-lock.json"} {
+		src := filepath.Join(srcDir, fileName)
+		if !utils.Exists(src) {
+			continue
+		}
+		if err := utils.CopyFile(src, filepath.Join(dir, fileName)); err != nil {
+			return err
+		}
+	}
+	args, err := rpc.GetDepInstallArgs(constants.Nodejs)
+	if err != nil {
+		return err
+	}
+	return runCmd(dir, npm, append([]string{"install", "--production"}, args...)...)
+}
+
+func lookPath(names ...string) (string, error) {
+	for _, name := range names {
+		if p, err := exec.LookPath(name); err == nil {
+			return p, nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("executable not found: %s", strings.Join(names, ", ")))
+}
+
+func runCmd(dir string, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Errorf("run command error: %s, cmd: %s %s", err.Error(), name, strings.Join(args, " "))
+		log.Errorf(string(output))
+		return errors.New(fmt.Sprintf("%s: %s", err.Error(), string(output)))
+	}
+	return nil
+}
+
+// 删除同一语言其他哈希的环境
+func removeOutdatedEnvs(e SpiderEnv) {
+	parent := filepath.Dir(e.Dir)
+	for _, f := range utils.ListDir(parent) {
+		name := f.Name()
+		if !f.IsDir() || name == filepath.Base(e.Dir) || !strings.HasPrefix(name, e.Lang+"-") {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(parent, name)); err != nil {
+			log.Errorf("remove outdated env error: %s", err.Error())
+			debug.PrintStack()
+		}
+	}
+}
+
+// 安装爬虫所需的环境，返回激活环境的环境变量
+func EnsureSpiderEnvs(spider model.Spider, dir string) (envVars []string) {
+	if !IsIsolatedEnvEnabled() {
+		return nil
+	}
+	var binDirs []string
+	for _, e := range GetSpiderEnvs(spider, dir) {
+		if err := e.Ensure(dir); err != nil {
+			// 安装失败时使用节点的全局环境
+			log.Errorf("install spider env error: %s, spider: %s, lang: %s", err.Error(), spider.Name, e.Lang)
+			debug.PrintStack()
+			continue
+		}
+		envVars = append(envVars, e.GetEnvVars()...)
+		binDirs = append(binDirs, e.GetBinDir())
+	}
+	if len(binDirs) > 0 {
+		envVars = append(envVars, "PATH="+strings.Join(append(binDirs, os.Getenv("PATH")), string(os.PathListSeparator)))
+	}
+	return envVars
+}
+
+// 删除爬虫的所有独立环境
+func RemoveSpiderEnvs(spiderId string) {
+	path := GetSpiderEnvPath(spiderId)
+	if !utils.Exists(path) {
+		return
+	}
+	if err := os.RemoveAll(path); err != nil {
+		log.Errorf("remove spider envs error: %s, path: %s", err.Error(), path)
+		debug.PrintStack()
+	}
+}
+
+// 清理已删除爬虫的独立环境
+func GcSpiderEnvs(spiderIds []string) {
+	root := GetEnvRootPath()
+	if !utils.Exists(root) {
+		return
+	}
+	for _, f := range utils.ListDir(root) {
+		if !f.IsDir() || utils.StringArrayContains(spiderIds, f.Name()) {
+			continue
+		}
+		log.Infof("remove env of deleted spider: %s", f.Name())
+		RemoveSpiderEnvs(f.Name())
+	}
+}
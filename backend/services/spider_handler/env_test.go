@@ -0,0 +1,45 @@
+package spider_handler
+
+import (
+	"crawlab/constants"
+	"crawlab/model"
+	"crawlab/utils"
+	"github.com/globalsign/mgo/bson"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSpiderEnv(t *testing.T) {
+	root, _ := ioutil.TempDir("", "crawlab-envs")
+	src, _ := ioutil.TempDir("", "crawlab-spider")
+	defer os.RemoveAll(root)
+	defer os.RemoveAll(src)
+	viper.Set("spider.envPath", root)
+
+	spider := model.Spider{Id: bson.NewObjectId(), Name: "test"}
+
+	Convey("Test GetSpiderEnvs", t, func() {
+		_ = ioutil.WriteFile(filepath.Join(src, "requirements.txt"), []byte("requests==2.22.0\n"), 0644)
+		envs := GetSpiderEnvs(spider, src)
+		So(len(envs), ShouldEqual, 1)
+		So(envs[0].Lang, ShouldEqual, constants.Python)
+		So(envs[0].Dir, ShouldEqual, filepath.Join(root, spider.Id.Hex(), "python-"+envs[0].Hash))
+		So(envs[0].IsReady(), ShouldBeFalse)
+
+		// 依赖文件变化时使用新的环境
+		_ = ioutil.WriteFile(filepath.Join(src, "requirements.txt"), []byte("requests==2.23.0\n"), 0644)
+		So(GetSpiderEnvs(spider, src)[0].Hash, ShouldNotEqual, envs[0].Hash)
+	})
+
+	Convey("Test GcSpiderEnvs", t, func() {
+		_ = os.MkdirAll(GetSpiderEnvPath(spider.Id.Hex()), os.ModePerm)
+		GcSpiderEnvs([]string{spider.Id.Hex()})
+		So(utils.Exists(GetSpiderEnvPath(spider.Id.Hex())), ShouldBeTrue)
+		GcSpiderEnvs(nil)
+		So(utils.Exists(GetSpiderEnvPath(spider.Id.Hex())), ShouldBeFalse)
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"crawlab/constants"
 	"crawlab/database"
 	"crawlab/model"
+	"crawlab/services/rpc"
 	"crawlab/utils"
 	"fmt"
 	"github.com/apex/log"
@@ -26,10 +27,19 @@ const (
 
 type SpiderSync struct {
 	Spider model.Spider
+	Dir    string // 同步目录，为空时为爬虫目录
+}
+
+// 获取同步目录
+func (s *SpiderSync) GetDir() string {
+	if s.Dir != "" {
+		return s.Dir
+	}
+	return filepath.Join(viper.GetString("spider.path"), s.Spider.Name)
 }
 
 func (s *SpiderSync) CreateMd5File(md5 string) {
-	path := filepath.Join(viper.GetString("spider.path"), s.Spider.Name)
+	path := s.GetDir()
 	utils.CreateDirPath(path)
 
 	fileName := filepath.Join(path, Md5File)
@@ -77,15 +87,15 @@ func (s *SpiderSync) RemoveDownCreate(md5 string) {
 // 获得下载锁的key
 func (s *SpiderSync) GetLockDownloadKey(spiderId string) string {
 	node, _ := model.GetCurrentNode()
+	if s.Dir != "" {
+		return node.Id.Hex() + "#" + spiderId + "#" + s.Dir
+	}
 	return node.Id.Hex() + "#" + spiderId
 }
 
 // 删除本地文件
 func (s *SpiderSync) RemoveSpiderFile() {
-	path := filepath.Join(
-		viper.GetString("spider.path"),
-		s.Spider.Name,
-	)
+	path := s.GetDir()
 	//爬虫文件有变化，先删除本地文件
 	if err := os.RemoveAll(path); err != nil {
 		log.Errorf("remove spider files error: %s, path: %s", err.Error(), path)
@@ -150,10 +160,7 @@ func (s *SpiderSync) Download() {
 	}
 
 	// 解压缩临时文件到目标文件夹
-	dstPath := filepath.Join(
-		viper.GetString("spider.path"),
-		s.Spider.Name,
-	)
+	dstPath := s.GetDir()
 	if err := utils.DeCompress(tmpFile, dstPath); err != nil {
 		log.Errorf(err.Error())
 		debug.PrintStack()
@@ -191,6 +198,12 @@ var installLockMap sync.Map
 
 // install dependencies
 func (s *SpiderSync) InstallDeps() {
+	// install into per-spider isolated environments
+	if IsIsolatedEnvEnabled() {
+		EnsureSpiderEnvs(s.Spider, s.GetDir())
+		return
+	}
+
 	langs := utils.GetLangList()
 	for _, l := range langs {
 		// no dep file name is found, skip
@@ -218,8 +231,16 @@ func (s *SpiderSync) InstallDeps() {
 		// lock
 		installLockMap.Store(key, true)
 
+		// package index or offline cache arguments
+		args, err := rpc.GetDepInstallArgs(l.ExecutableName)
+		if err != nil {
+			log.Errorf("get dep install args error: " + err.Error())
+			installLockMap.Delete(key)
+			continue
+		}
+
 		// command to install dependencies
-		cmd := exec.Command(l.DepExecutablePath, strings.Split(l.InstallDepArgs, " ")...)
+		cmd := exec.Command(l.DepExecutablePath, append(strings.Split(l.InstallDepArgs, " "), args...)...)
 
 		// working directory
 		cmd.Dir = s.Spider.Src
@@ -230,7 +251,7 @@ func (s *SpiderSync) InstallDeps() {
 			if err != nil {
 				continue
 			}
-			cmd = exec.Command(l.DepExecutablePath, strings.Split(l.InstallDepArgs+" "+strings.Join(deps, " "), " ")...)
+			cmd = exec.Command(l.DepExecutablePath, append(strings.Split(l.InstallDepArgs+" "+strings.Join(deps, " "), " "), args...)...)
 		}
 
 		// start executing command
@@ -0,0 +1,384 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crawlab/constants"
+	"crawlab/database"
+	"crawlab/entity"
+	"crawlab/model"
+	"crawlab/services/spider_handler"
+	"crawlab/utils"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/spf13/viper"
+	"io"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 添加版本时版本号冲突的最大重试次数
+const spiderVersionAddRetries = 5
+
+// 添加爬虫版本，尚无版本记录时先将当前文件记为初始版本
+func AddSpiderVersion(spider model.Spider, fid bson.ObjectId, uid bson.ObjectId, message string) (model.SpiderVersion, error) {
+	return addSpiderVersion(spider, model.SpiderVersion{
+		FileId:  fid,
+		Message: message,
+		UserId:  uid,
+	})
+}
+
+// 添加爬虫版本，版本号为最新版本加一，并发添加导致版本号冲突时重新获取最新版本后重试
+func addSpiderVersion(spider model.Spider, v model.SpiderVersion) (model.SpiderVersion, error) {
+	v.SpiderId = spider.Id
+	if gfFile := model.GetGridFs(v.FileId); gfFile != nil {
+		v.Md5 = gfFile.Md5
+	}
+
+	var err error
+	for i := 0; i < spiderVersionAddRetries; i++ {
+		var version int
+		version, err = getSpiderNextVersion(spider, v.FileId)
+		if err != nil {
+			return v, err
+		}
+		v.Version = version
+		if err = v.Add(); err == nil {
+			break
+		}
+		if !mgo.IsDup(err) {
+			return v, err
+		}
+	}
+	if err != nil {
+		log.Errorf("add spider version error: %s, spider_id: %s", err.Error(), spider.Id.Hex())
+		return v, err
+	}
+
+	// 清理超出保留数量的历史版本
+	if err := PruneSpiderVersions(spider, v.FileId); err != nil {
+		log.Errorf("prune spider versions error: %s, spider_id: %s", err.Error(), spider.Id.Hex())
+	}
+
+	return v, nil
+}
+
+// 获取爬虫的下一个版本号
+func getSpiderNextVersion(spider model.Spider, fid bson.ObjectId) (int, error) {
+	latest, err := model.GetSpiderLatestVersion(spider.Id)
+	if err == nil {
+		return latest.Version + 1, nil
+	}
+	if err != mgo.ErrNotFound {
+		return 0, err
+	}
+
+	// 尚无版本记录，当前文件记为初始版本
+	if !spider.FileId.Valid() || utils.IsObjectIdNull(spider.FileId) || spider.FileId == fid {
+		return 1, nil
+	}
+	gfFile := model.GetGridFs(spider.FileId)
+	if gfFile == nil {
+		return 1, nil
+	}
+	initial := model.SpiderVersion{
+		SpiderId: spider.Id,
+		Version:  1,
+		FileId:   spider.FileId,
+		Md5:      gfFile.Md5,
+		Message:  "initial version",
+		UserId:   spider.UserId,
+	}
+	if err := initial.Add(); err != nil && !mgo.IsDup(err) {
+		return 0, err
+	}
+	return initial.Version + 1, nil
+}
+
+// 清理超出保留数量（spider.maxVersions，0 为不限制）的历史版本及其GridFS文件，
+// 定时任务或未完成任务指定的版本、当前使用的文件不会被删除
+func PruneSpiderVersions(spider model.Spider, currentFid bson.ObjectId) error {
+	maxVersions := viper.GetInt("spider.maxVersions")
+	if maxVersions <= 0 {
+		return nil
+	}
+
+	versions, err := model.GetSpiderVersionList(spider.Id, 0, 0)
+	if err != nil {
+		return err
+	}
+	if len(versions) <= maxVersions {
+		return nil
+	}
+
+	pinned, err := getSpiderPinnedVersions(spider.Id)
+	if err != nil {
+		return err
+	}
+
+	// 版本列表按版本号倒序，保留最新的版本
+	keptFileIds := map[bson.ObjectId]bool{spider.FileId: true, currentFid: true}
+	var removed []model.SpiderVersion
+	for i, v := range versions {
+		if i < maxVersions || pinned[v.Version] {
+			keptFileIds[v.FileId] = true
+			continue
+		}
+		removed = append(removed, v)
+	}
+
+	for _, v := range removed {
+		if err := model.RemoveSpiderVersion(v.Id); err != nil {
+			return err
+		}
+		// 回滚生成的版本与目标版本共用文件
+		if keptFileIds[v.FileId] {
+			continue
+		}
+		keptFileIds[v.FileId] = true
+		if gfFile := model.GetGridFs(v.FileId); gfFile != nil {
+			gfFile.Remove()
+		}
+	}
+	return nil
+}
+
+// 获取定时任务和未完成任务指定的爬虫版本
+func getSpiderPinnedVersions(spiderId bson.ObjectId) (map[int]bool, error) {
+	pinned := map[int]bool{}
+
+	schedules, err := model.GetScheduleList(bson.M{
+		"spider_id":      spiderId,
+		"spider_version": bson.M{"$gt": 0},
+	})
+	if err != nil {
+		return pinned, err
+	}
+	for _, sch := range schedules {
+		pinned[sch.SpiderVersion] = true
+	}
+
+	tasks, err := model.GetTaskList(bson.M{
+		"spider_id":      spiderId,
+		"spider_version": bson.M{"$gt": 0},
+		"status":         bson.M{"$in": []string{constants.StatusPending, constants.StatusRunning}},
+	}, 0, 0, "-create_ts")
+	if err != nil {
+		return pinned, err
+	}
+	for _, t := range tasks {
+		pinned[t.SpiderVersion] = true
+	}
+
+	return pinned, nil
+}
+
+// 回滚爬虫到指定版本（生成一个新版本）
+func RollbackSpiderVersion(spider model.Spider, version int, uid bson.ObjectId) (model.SpiderVersion, error) {
+	target, err := model.GetSpiderVersion(spider.Id, version)
+	if err != nil {
+		return target, err
+	}
+	if model.GetGridFs(target.FileId) == nil {
+		return target, errors.New("spider files of this version not found")
+	}
+
+	v, err := addSpiderVersion(spider, model.SpiderVersion{
+		FileId:  target.FileId,
+		DirMd5:  target.DirMd5,
+		Message: fmt.Sprintf("rollback to version %d", version),
+		UserId:  uid,
+	})
+	if err != nil {
+		return v, err
+	}
+
+	// 更新爬虫文件
+	spider.FileId = target.FileId
+	spider.Version = v.Version
+	if err := spider.Save(); err != nil {
+		return v, err
+	}
+
+	// 发起同步
+	PublishSpider(spider)
+
+	return v, nil
+}
+
+// 比较两个版本的文件差异
+func DiffSpiderVersions(spider model.Spider, from int, to int) (entity.SpiderVersionDiff, error) {
+	diff := entity.SpiderVersionDiff{
+		From:     from,
+		To:       to,
+		Added:    []string{},
+		Removed:  []string{},
+		Modified: []string{},
+	}
+
+	fromVersion, err := model.GetSpiderVersion(spider.Id, from)
+	if err != nil {
+		return diff, err
+	}
+	toVersion, err := model.GetSpiderVersion(spider.Id, to)
+	if err != nil {
+		return diff, err
+	}
+
+	fromFiles, err := GetGridFsZipFileMd5Map(fromVersion.FileId)
+	if err != nil {
+		return diff, err
+	}
+	toFiles, err := GetGridFsZipFileMd5Map(toVersion.FileId)
+	if err != nil {
+		return diff, err
+	}
+
+	for name, md5Str := range toFiles {
+		fromMd5, ok := fromFiles[name]
+		if !ok {
+			diff.Added = append(diff.Added, name)
+		} else if fromMd5 != md5Str {
+			diff.Modified = append(diff.Modified, name)
+		}
+	}
+	for name := range fromFiles {
+		if _, ok := toFiles[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Modified)
+
+	return diff, nil
+}
+
+// 读取GridFS中的zip文件，返回各文件的MD5
+func GetGridFsZipFileMd5Map(fid bson.ObjectId) (map[string]string, error) {
+	files := map[string]string{}
+
+	s, gf := database.GetGridFs("files")
+	defer s.Close()
+
+	f, err := gf.OpenId(fid)
+	if err != nil {
+		log.Errorf("open grid fs file error: %s, file_id: %s", err.Error(), fid.Hex())
+		debug.PrintStack()
+		return files, err
+	}
+	defer utils.Close(f)
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, f); err != nil {
+		return files, err
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		return files, err
+	}
+	for _, zf := range r.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return files, err
+		}
+		h := md5.New()
+		_, err = io.Copy(h, rc)
+		_ = rc.Close()
+		if err != nil {
+			return files, err
+		}
+		files[strings.TrimPrefix(zf.Name, "/")] = fmt.Sprintf("%x", h.Sum(nil))
+	}
+	return files, nil
+}
+
+// 获取指定版本爬虫文件的本地目录
+func GetSpiderVersionDir(spider model.Spider, version int) string {
+	return filepath.Join(viper.GetString("spider.path"), ".versions", spider.Name, strconv.Itoa(version))
+}
+
+// 获取任务的爬虫目录，指定版本的任务使用版本目录
+func GetTaskSpiderDir(t model.Task, spider model.Spider) string {
+	if t.SpiderVersion > 0 {
+		return GetSpiderVersionDir(spider, t.SpiderVersion)
+	}
+	return filepath.Join(viper.GetString("spider.path"), spider.Name)
+}
+
+// 同步指定版本的爬虫文件到本地版本目录
+func SyncSpiderVersion(spider model.Spider, version int) error {
+	v, err := model.GetSpiderVersion(spider.Id, version)
+	if err != nil {
+		return err
+	}
+	gfFile := model.GetGridFs(v.FileId)
+	if gfFile == nil {
+		return errors.New("spider files of this version not found")
+	}
+
+	dir := GetSpiderVersionDir(spider, version)
+	md5 := utils.GetSpiderMd5Str(filepath.Join(dir, spider_handler.Md5File))
+	if gfFile.Md5 == md5 {
+		return nil
+	}
+
+	spider.FileId = v.FileId
+	spiderSync := spider_handler.SpiderSync{
+		Spider: spider,
+		Dir:    dir,
+	}
+	spiderSync.RemoveSpiderFile()
+	spiderSync.Download()
+	spiderSync.CreateMd5File(gfFile.Md5)
+	return nil
+}
+
+// 同步定时任务指定的爬虫版本
+func PublishSpiderPinnedVersions(spider model.Spider) {
+	schedules, err := model.GetScheduleList(bson.M{
+		"spider_id":      spider.Id,
+		"spider_version": bson.M{"$gt": 0},
+		"status":         bson.M{"$ne": constants.ScheduleStatusStop},
+	})
+	if err != nil {
+		return
+	}
+
+	synced := map[int]bool{}
+	for _, sch := range schedules {
+		if synced[sch.SpiderVersion] {
+			continue
+		}
+		synced[sch.SpiderVersion] = true
+		if err := SyncSpiderVersion(spider, sch.SpiderVersion); err != nil {
+			log.Errorf("sync spider version error: %s, spider: %s, version: %d", err.Error(), spider.Name, sch.SpiderVersion)
+		}
+	}
+}
+
+// 校验指定的爬虫版本是否存在，0 表示使用最新版本
+func ValidateSpiderVersion(spiderId bson.ObjectId, version int) error {
+	if version < 0 {
+		return errors.New("invalid spider version")
+	}
+	if version == 0 {
+		return nil
+	}
+	if _, err := model.GetSpiderVersion(spiderId, version); err != nil {
+		return fmt.Errorf("spider version %d not found", version)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package services
+
+import (
+	"crawlab/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetTaskSpiderDir(t *testing.T) {
+	viper.Set("spider.path", "/app/spiders")
+	spider := model.Spider{Name: "test"}
+
+	Convey("Test GetTaskSpiderDir", t, func() {
+		// 未指定版本使用爬虫目录
+		So(GetTaskSpiderDir(model.Task{}, spider), ShouldEqual, filepath.Join("/app/spiders", "test"))
+
+		// 指定版本使用版本目录
+		So(GetTaskSpiderDir(model.Task{SpiderVersion: 3}, spider), ShouldEqual, filepath.Join("/app/spiders", ".versions", "test", "3"))
+	})
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/apex/log"
 	"github.com/imroc/req"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"runtime/debug"
 	"sort"
@@ -59,6 +60,9 @@ func GetSystemInfo(nodeId string) (sysInfo entity.SystemInfo, err error) {
 	} else {
 		sysInfo, err = GetRemoteSystemInfo(nodeId)
 	}
+
+	// 工作协程统计
+	sysInfo.Workers, _ = GetNodeWorkerStats(nodeId)
 	return
 }
 
@@ -276,11 +280,16 @@ func GetPythonDepListFromRedis() ([]string, error) {
 // 从Python依赖源获取依赖列表并返回
 func FetchPythonDepList() ([]string, error) {
 	// 依赖URL
-	url := "https://pypi.tuna.tsinghua.edu.cn/simple"
+	url := utils.GetPythonIndexUrl()
 
 	// 输出列表
 	var list []string
 
+	// 启用离线缓存时从缓存中的依赖包获取
+	if utils.IsDepCacheEnabled() {
+		return GetPythonDepListFromCache()
+	}
+
 	// 请求URL
 	res, err := req.Get(url)
 	if err != nil {
@@ -311,6 +320,23 @@ func FetchPythonDepList() ([]string, error) {
 	return list, nil
 }
 
+// 从离线缓存中的依赖包文件名获取依赖列表
+func GetPythonDepListFromCache() ([]string, error) {
+	var list []string
+	files, err := rpc.GetDepCacheFilesLocal(constants.Python)
+	if err != nil {
+		return list, err
+	}
+	for _, f := range files {
+		// wheel 和源码包的文件名均为 <名称>-<版本>...
+		name := strings.SplitN(filepath.Base(f.Path), "-", 2)[0]
+		if name != "" && !utils.StringArrayContains(list, name) {
+			list = append(list, name)
+		}
+	}
+	return list, nil
+}
+
 // 更新Python依赖列表到Redis
 func UpdatePythonDepList() {
 	// 从依赖源获取列表
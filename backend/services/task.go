@@ -2,12 +2,15 @@ package services
 
 import (
 	"bufio"
+	"context"
 	"crawlab/constants"
 	"crawlab/database"
 	"crawlab/entity"
 	"crawlab/lib/cron"
 	"crawlab/model"
+	"crawlab/services/log_sink"
 	"crawlab/services/notification"
+	"crawlab/services/result_sink"
 	"crawlab/services/spider_handler"
 	"crawlab/utils"
 	"encoding/json"
@@ -15,6 +18,7 @@ import (
 	"fmt"
 	"github.com/apex/log"
 	"github.com/globalsign/mgo/bson"
+	"github.com/gomodule/redigo/redis"
 	"github.com/imroc/req"
 	"github.com/satori/go.uuid"
 	"github.com/spf13/viper"
@@ -28,6 +32,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -56,6 +61,11 @@ func (m *TaskMessage) ToString() (string, error) {
 // 任务执行器
 type Executor struct {
 	Cron *cron.Cron
+
+	lock     sync.Mutex
+	workers  []context.CancelFunc // 各工作协程的停止函数
+	workerId int                  // 下一个工作协程ID
+	busy     int32                // 正在执行任务的工作协程数
 }
 
 // 启动任务执行器
@@ -63,27 +73,331 @@ func (ex *Executor) Start() error {
 	// 启动cron服务
 	ex.Cron.Start()
 
-	// 加入执行器到定时任务
-	spec := "0/1 * * * * *" // 每秒执行一次
-	for i := 0; i < viper.GetInt("task.workers"); i++ {
-		// WorkerID
-		id := i
+	// 启动工作协程
+	ex.Resize(GetTaskWorkerCount())
+
+	// 每秒将到期的延迟任务放回队列
+	if _, err := ex.Cron.AddFunc("* * * * * *", PromoteDelayedTaskMessages); err != nil {
+		return err
+	}
+
+	// 每5秒检查一次工作协程数是否需要调整
+	spec := "*/5 * * * * *"
+	if _, err := ex.Cron.AddFunc(spec, func() {
+		ex.Resize(GetTaskWorkerCount())
+		ex.SaveStats()
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// 调整工作协程数
+func (ex *Executor) Resize(n int) {
+	ex.lock.Lock()
+	defer ex.lock.Unlock()
+
+	if n == len(ex.workers) {
+		return
+	}
+	log.Infof("resize task workers: %d -> %d", len(ex.workers), n)
+
+	// 增加工作协程
+	for len(ex.workers) < n {
+		id := ex.workerId
+		ex.workerId++
 
 		// 初始化任务锁
 		LockList.Store(id, false)
 
-		// 加入定时任务
-		_, err := ex.Cron.AddFunc(spec, GetExecuteTaskFunc(id))
+		ctx, cancel := context.WithCancel(context.Background())
+		ex.workers = append(ex.workers, cancel)
+		go ex.runWorker(ctx, id)
+	}
+
+	// 减少工作协程（中断等待中的信号，正在执行的任务完成后退出）
+	for len(ex.workers) > n {
+		ex.workers[len(ex.workers)-1]()
+		ex.workers = ex.workers[:len(ex.workers)-1]
+	}
+
+	go ex.SaveStats()
+}
+
+// 工作协程：阻塞等待任务信号，收到信号后取出并执行任务，直到队列中没有任务
+func (ex *Executor) runWorker(ctx context.Context, id int) {
+	for {
+		if ctx.Err() != nil {
+			log.Infof(GetWorkerPrefix(id) + "stopped")
+			return
+		}
+
+		// 获取当前节点
+		node, err := model.GetCurrentNode()
 		if err != nil {
-			return err
+			log.Errorf(GetWorkerPrefix(id) + "get current node error: " + err.Error())
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		// 等待任务信号，超时后也检查一次队列
+		WaitTaskSignal(ctx, node.Id)
+
+		for ctx.Err() == nil && ExecuteTask(id) {
 		}
 	}
+}
+
+// 工作协程统计
+func (ex *Executor) GetStats() entity.WorkerStats {
+	ex.lock.Lock()
+	total := len(ex.workers)
+	ex.lock.Unlock()
+
+	busy := int(atomic.LoadInt32(&ex.busy))
+	idle := total - busy
+	if idle < 0 {
+		idle = 0
+	}
+	return entity.WorkerStats{
+		Total: total,
+		Busy:  busy,
+		Idle:  idle,
+	}
+}
+
+// 保存工作协程统计到Redis，供主节点获取
+func (ex *Executor) SaveStats() {
+	node, err := model.GetCurrentNode()
+	if err != nil {
+		return
+	}
+	stats := ex.GetStats()
+	stats.UpdateTs = time.Now()
+	statsBytes, err := json.Marshal(&stats)
+	if err != nil {
+		return
+	}
+	if err := database.RedisClient.HSet("nodes:workers", node.Id.Hex(), utils.BytesToString(statsBytes)); err != nil {
+		log.Errorf("save worker stats error: %s", err.Error())
+	}
+}
+
+// 获取节点工作协程统计
+func GetNodeWorkerStats(nodeId string) (stats entity.WorkerStats, err error) {
+	value, err := database.RedisClient.HGet("nodes:workers", nodeId)
+	if err != nil || value == "" {
+		return stats, err
+	}
+	if err := json.Unmarshal([]byte(value), &stats); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// 获取本节点的工作协程数，节点设置优先于配置文件
+func GetTaskWorkerCount() int {
+	if node, err := model.GetCurrentNode(); err == nil && node.Workers > 0 {
+		return node.Workers
+	}
+	return viper.GetInt("task.workers")
+}
+
+// 获取任务队列的信号列表名称，任务入队时推入信号用于唤醒工作协程
+func GetTaskSignalName(queue string) string {
+	return queue + ":signal"
+}
+
+// 推入任务信号，信号数不超过能取该队列任务的工作协程数，多余的信号只会造成空唤醒
+func SendTaskSignal(queue string) {
+	size := GetTaskSignalSize(queue)
+	expire := time.Duration(constants.TaskSignalExpire) * time.Second
+	if err := database.RedisClient.RPushCapped(GetTaskSignalName(queue), 1, size, expire); err != nil {
+		log.Errorf("send task signal error: %s", err.Error())
+	}
+}
+
+// 获取能取该队列任务的工作协程数：公共队列为所有节点的工作协程数，节点队列为该节点的工作协程数
+func GetTaskSignalSize(queue string) int {
+	isPublic := queue == GetTaskQueueName(bson.ObjectIdHex(constants.ObjectIdNull))
+	size := 0
+	values, _ := database.RedisClient.HGetAll("nodes:workers")
+	for nodeId, value := range values {
+		if !isPublic && (!bson.IsObjectIdHex(nodeId) || queue != GetTaskQueueName(bson.ObjectIdHex(nodeId))) {
+			continue
+		}
+		var stats entity.WorkerStats
+		if err := json.Unmarshal([]byte(value), &stats); err != nil {
+			continue
+		}
+		size += stats.Total
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// 阻塞等待节点队列或公共队列的任务信号，ctx 结束时立即返回
+func WaitTaskSignal(ctx context.Context, nodeId bson.ObjectId) {
+	keys := []string{
+		GetTaskSignalName(GetTaskQueueName(nodeId)),
+		GetTaskSignalName(GetTaskQueueName(bson.ObjectIdHex(constants.ObjectIdNull))),
+	}
+	if _, err := database.RedisClient.BLPop(ctx, keys, constants.TaskSignalTimeout); err != nil && err != redis.ErrNil {
+		if ctx.Err() != nil {
+			return
+		}
+		log.Errorf("wait task signal error: %s", err.Error())
+		time.Sleep(time.Duration(constants.TaskSignalTimeout) * time.Second)
+	}
+}
+
+// 获取任务队列名称，未指定节点的任务进入公共队列
+func GetTaskQueueName(nodeId bson.ObjectId) string {
+	if utils.IsObjectIdNull(nodeId) {
+		return "tasks:public"
+	}
+	return "tasks:node:" + nodeId.Hex()
+}
+
+// 延迟任务集合名称（有序集合：延迟任务消息 -> 到期时间戳）
+func GetTaskDelayedName() string {
+	return "tasks:delayed"
+}
+
+// 延迟任务消息，到期后以 Score 放回 Key 队列
+type DelayedTaskMessage struct {
+	Key   string `json:"key"`
+	Score string `json:"score"` // 字符串保存，避免 Lua 转换数字时丢失精度
+	Value string `json:"value"`
+}
+
+// 任务消息延迟入队，延迟期间保存在 Redis 中，节点重启不会丢失
+func DelayTaskMessage(queue string, score float64, msg string, delay time.Duration) error {
+	data, err := json.Marshal(&DelayedTaskMessage{
+		Key:   queue,
+		Score: strconv.FormatFloat(score, 'f', -1, 64),
+		Value: msg,
+	})
+	if err != nil {
+		return err
+	}
+	dueTs := time.Now().Add(delay).UnixNano() / int64(time.Millisecond)
+	return database.RedisClient.ZAdd(GetTaskDelayedName(), float64(dueTs), utils.BytesToString(data))
+}
+
+// 将到期的延迟任务消息放回队列，并唤醒工作协程
+func PromoteDelayedTaskMessages() {
+	nowTs := time.Now().UnixNano() / int64(time.Millisecond)
+	queues, err := database.RedisClient.ZMoveDue(GetTaskDelayedName(), float64(nowTs), 100)
+	if err != nil {
+		return
+	}
+	for _, queue := range queues {
+		SendTaskSignal(queue)
+	}
+}
+
+// 获取节点的处理中任务列表名称（哈希表：任务消息 -> 队列分数）
+func GetTaskProcessingName(nodeId bson.ObjectId) string {
+	return "tasks:processing:" + nodeId.Hex()
+}
+
+// 取出任务消息，并放入节点的处理中列表，任务处理完成后需调用 AckTaskMessage
+func PopTaskMessage(nodeId bson.ObjectId) (string, error) {
+	processing := GetTaskProcessingName(nodeId)
+
+	// 节点队列任务（优先级最高）
+	msg, err := database.RedisClient.ZPopMinToHash(GetTaskQueueName(nodeId), processing)
+	if err == nil {
+		return msg, nil
+	}
+	if err != redis.ErrNil {
+		return "", err
+	}
+
+	// 节点队列没有任务，获取公共队列任务
+	return database.RedisClient.ZPopMinToHash(GetTaskQueueName(bson.ObjectIdHex(constants.ObjectIdNull)), processing)
+}
+
+// 确认任务消息已处理，从节点的处理中列表删除
+func AckTaskMessage(nodeId bson.ObjectId, msg string) {
+	if err := database.RedisClient.HDel(GetTaskProcessingName(nodeId), msg); err != nil {
+		log.Errorf("ack task message error: %s, msg: %s", err.Error(), msg)
+	}
+}
+
+// 将节点处理中列表的任务消息放回公共队列（节点离线或重启时）
+func RequeueTaskMessages(nodeId bson.ObjectId) error {
+	processing := GetTaskProcessingName(nodeId)
+
+	msgs, err := database.RedisClient.HGetAll(processing)
+	if err != nil {
+		return err
+	}
 
+	queuePub := GetTaskQueueName(bson.ObjectIdHex(constants.ObjectIdNull))
+	for msg, scoreStr := range msgs {
+		// 保留原有分数，不影响优先级和顺序
+		score, err := strconv.ParseFloat(scoreStr, 64)
+		if err != nil {
+			score = GetTaskQueueScore(constants.TaskPriorityDefault, time.Now())
+		}
+		if err := database.RedisClient.ZAdd(queuePub, score, msg); err != nil {
+			return err
+		}
+		if err := database.RedisClient.HDel(processing, msg); err != nil {
+			return err
+		}
+		SendTaskSignal(queuePub)
+		log.Infof("requeue task message: %s, node_id: %s", msg, nodeId.Hex())
+	}
 	return nil
 }
 
+// 获取任务在队列（有序集合）中的分数，分数越小越先执行
+// 优先级高的任务排在前面，相同优先级按入队时间先后执行
+func GetTaskQueueScore(priority int, ts time.Time) float64 {
+	if priority < constants.TaskPriorityLowest {
+		priority = constants.TaskPriorityLowest
+	} else if priority > constants.TaskPriorityHighest {
+		priority = constants.TaskPriorityHighest
+	}
+	return float64(constants.TaskPriorityHighest-priority)*1e13 + float64(ts.UnixNano()/int64(time.Millisecond))
+}
+
 // 派发任务
 func AssignTask(task model.Task) error {
+	return AssignTaskAfter(task, 0)
+}
+
+// 延迟派发任务，延迟期间任务消息保存在 Redis 延迟任务集合中，主节点重启不会丢失
+func AssignTaskAfter(task model.Task, delay time.Duration) error {
+	// 按标签选择器选择节点
+	if utils.IsObjectIdNull(task.NodeId) && task.LabelSelector != "" {
+		t, err := model.GetTask(task.Id)
+		if err != nil {
+			return err
+		}
+		node, err := SelectNodeByLabelSelector(task.LabelSelector)
+		if err != nil {
+			// 没有满足条件的节点，任务失败
+			t.Error = err.Error()
+			t.Status = constants.StatusError
+			t.FinishTs = time.Now()                                // 结束时间
+			t.TotalDuration = t.FinishTs.Sub(t.CreateTs).Seconds() // 总时长
+			_ = t.Save()
+			return err
+		}
+		t.NodeId = node.Id
+		if err := t.Save(); err != nil {
+			return err
+		}
+		task.NodeId = node.Id
+	}
+
 	// 生成任务信息
 	msg := TaskMessage{
 		Id: task.Id,
@@ -96,20 +410,87 @@ func AssignTask(task model.Task) error {
 	}
 
 	// 队列名称
-	var queue string
-	if utils.IsObjectIdNull(task.NodeId) {
-		queue = "tasks:public"
-	} else {
-		queue = "tasks:node:" + task.NodeId.Hex()
+	queue := GetTaskQueueName(task.NodeId)
+
+	// 任务入队（延迟派发的任务到期后按原有分数入队）
+	score := GetTaskQueueScore(task.Priority, time.Now())
+	if delay > 0 {
+		return DelayTaskMessage(queue, score, msgStr, delay)
 	}
+	if err := database.RedisClient.ZAdd(queue, score, msgStr); err != nil {
+		return err
+	}
+
+	// 唤醒工作协程
+	SendTaskSignal(queue)
+
+	return nil
+}
 
-	// 任务入队
-	if err := database.RedisClient.RPush(queue, msgStr); err != nil {
+// 将旧版本的任务队列（列表）迁移为有序集合
+func MigrateTaskQueues() error {
+	nodes, err := model.GetNodeList(nil)
+	if err != nil {
 		return err
 	}
+	queues := []string{GetTaskQueueName(bson.ObjectIdHex(constants.ObjectIdNull))}
+	for _, node := range nodes {
+		queues = append(queues, GetTaskQueueName(node.Id))
+	}
+
+	for _, queue := range queues {
+		keyType, err := database.RedisClient.Type(queue)
+		if err != nil {
+			return err
+		}
+		if keyType != "list" {
+			continue
+		}
+
+		// 取出所有任务消息
+		var msgs []string
+		for {
+			msg, err := database.RedisClient.LPop(queue)
+			if err != nil || msg == "" {
+				break
+			}
+			msgs = append(msgs, msg)
+		}
+
+		// 按原有顺序重新入队
+		for _, msg := range msgs {
+			var priority int
+			tMsg := TaskMessage{}
+			if err := json.Unmarshal([]byte(msg), &tMsg); err == nil {
+				if t, err := model.GetTask(tMsg.Id); err == nil {
+					priority = t.Priority
+				}
+			}
+			if err := database.RedisClient.ZAdd(queue, GetTaskQueueScore(priority, time.Now()), msg); err != nil {
+				return err
+			}
+			SendTaskSignal(queue)
+		}
+		log.Infof("migrated %d task messages in queue %s", len(msgs), queue)
+	}
 	return nil
 }
 
+// 获取爬虫进程的时区，定时任务设置了时区时优先使用
+func GetTaskTimezone(t model.Task) string {
+	if t.ScheduleId.Valid() && !utils.IsObjectIdNull(t.ScheduleId) {
+		if sch, err := model.GetSchedule(t.ScheduleId); err == nil && sch.Timezone != "" {
+			return sch.Timezone
+		}
+	}
+
+	tz := viper.GetString("task.timezone")
+	if tz == "" {
+		tz = "Asia/Shanghai"
+	}
+	return tz
+}
+
 // 设置环境变量
 func SetEnv(cmd *exec.Cmd, envs []model.Env, task model.Task, spider model.Spider) *exec.Cmd {
 	// 默认把Node.js的全局node_modules加入环境变量
@@ -144,7 +525,7 @@ func SetEnv(cmd *exec.Cmd, envs []model.Env, task model.Task, spider model.Spide
 	}
 	cmd.Env = append(cmd.Env, "PYTHONUNBUFFERED=0")
 	cmd.Env = append(cmd.Env, "PYTHONIOENCODING=utf-8")
-	cmd.Env = append(cmd.Env, "TZ=Asia/Shanghai")
+	cmd.Env = append(cmd.Env, "TZ="+GetTaskTimezone(task))
 	cmd.Env = append(cmd.Env, "CRAWLAB_DEDUP_FIELD="+spider.DedupField)
 	cmd.Env = append(cmd.Env, "CRAWLAB_DEDUP_METHOD="+spider.DedupMethod)
 	if spider.IsDedup {
@@ -153,24 +534,31 @@ func SetEnv(cmd *exec.Cmd, envs []model.Env, task model.Task, spider model.Spide
 		cmd.Env = append(cmd.Env, "CRAWLAB_IS_DEDUP=0")
 	}
 
+	// 爬虫独立依赖环境（virtualenv / node_modules）
+	cmd.Env = append(cmd.Env, spider_handler.EnsureSpiderEnvs(spider, cmd.Dir)...)
+
+	// 工作流环境变量
+	if task.WorkflowRunId.Valid() {
+		cmd.Env = append(cmd.Env, "CRAWLAB_WORKFLOW_RUN_ID="+task.WorkflowRunId.Hex())
+		cmd.Env = append(cmd.Env, "CRAWLAB_WORKFLOW_STEP="+task.WorkflowStep)
+		cmd.Env = append(cmd.Env, "CRAWLAB_UPSTREAM_TASK_IDS="+strings.Join(GetWorkflowUpstreamTaskIds(task), ","))
+	}
+
 	//任务环境变量
 	for _, env := range envs {
 		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
 	}
 
 	// 全局环境变量
-	variables := model.GetVariableList()
+	variables := GetSpiderVariables(spider)
 	for _, variable := range variables {
 		cmd.Env = append(cmd.Env, variable.Key+"="+variable.Value)
 	}
 	return cmd
 }
 
-func SetLogConfig(wg *sync.WaitGroup, cmd  *exec.Cmd, t model.Task, u model.User) error {
+func SetLogConfig(wg *sync.WaitGroup, cmd *exec.Cmd, t model.Task, s model.Spider, u model.User) error {
 
-	esChan := make(chan string, 1)
-	esClientStr := viper.GetString("setting.esClient")
-	spiderLogIndex := viper.GetString("setting.spiderLogIndex")
 	// get stdout reader
 	stdout, err := cmd.StdoutPipe()
 	readerStdout := bufio.NewReader(stdout)
@@ -189,19 +577,40 @@ func SetLogConfig(wg *sync.WaitGroup, cmd  *exec.Cmd, t model.Task, u model.User
 		return err
 	}
 
+	// 日志中的加密变量脱敏
+	masker := GetSpiderSecretMasker(s)
+
 	var seq int64
 	var logs []model.LogItem
+	var logsLock sync.Mutex
 	isStdoutFinished := false
 	isStderrFinished := false
 
+	// 警告和错误日志数，写入日志时统计
+	warningCount := 0
+	errorCount := 0
+
 	// periodically (1 sec) insert log items
 	wg.Add(3)
 	go func() {
 		defer wg.Done()
 		for {
-			_ = model.AddLogItems(logs)
+			finished := isStdoutFinished && isStderrFinished
+
+			logsLock.Lock()
+			items := logs
 			logs = []model.LogItem{}
-			if isStdoutFinished && isStderrFinished {
+			logsLock.Unlock()
+
+			_ = log_sink.WriteLogItems(items)
+			if errorItems, warnings := getLogLevelCounts(items); len(errorItems) > 0 || warnings > 0 {
+				_ = model.AddErrorLogItems(errorItems)
+				warningCount += warnings
+				errorCount += len(errorItems)
+				_ = model.SetTaskLogCounts(t.Id, warningCount, errorCount)
+			}
+
+			if finished {
 				break
 			}
 			time.Sleep(5 * time.Second)
@@ -215,68 +624,56 @@ func SetLogConfig(wg *sync.WaitGroup, cmd  *exec.Cmd, t model.Task, u model.User
 		expireDuration = constants.Infinite
 	}
 
-	// read stdout
-	go func() {
+	// 读取输出流，解析日志级别
+	readLogs := func(reader *bufio.Reader, stream string, isFinished *bool) {
 		defer wg.Done()
+		parser := NewLogLevelParser(u.Setting.ErrorRegexPattern)
 		for {
-			line, err := readerStdout.ReadString('\n')
+			line, err := reader.ReadString('\n')
 			if err != nil {
-				isStdoutFinished = true
+				*isFinished = true
 				break
 			}
-			line = strings.Replace(line, "\n", "", -1)
-			seq++
+			line = masker.Mask(strings.Replace(line, "\n", "", -1))
 			l := model.LogItem{
 				Id:       bson.NewObjectId(),
-				Seq:      seq,
+				Seq:      atomic.AddInt64(&seq, 1),
 				Message:  line,
 				TaskId:   t.Id,
+				Stream:   stream,
+				Level:    parser.Parse(line),
 				Ts:       time.Now(),
 				ExpireTs: time.Now().Add(time.Duration(expireDuration) * time.Second),
 			}
-			esChan <- l.Message
-			if esClientStr != "" {
-				go database.WriteMsgToES(time.Now(), esChan, spiderLogIndex)
-			}
+			PublishTaskLog(l)
 
+			logsLock.Lock()
 			logs = append(logs, l)
+			logsLock.Unlock()
 		}
-	}()
+	}
+
+	// read stdout
+	go readLogs(readerStdout, constants.LogStreamStdout, &isStdoutFinished)
 
 	// read stderr
-	go func() {
-		defer wg.Done()
-		for {
-			line, err := readerStderr.ReadString('\n')
-			if err != nil {
-				isStderrFinished = true
-				break
-			}
-			line = strings.Replace(line, "\n", "", -1)
-			seq++
-			l := model.LogItem{
-				Id:       bson.NewObjectId(),
-				Seq:      seq,
-				Message:  line,
-				TaskId:   t.Id,
-				Ts:       time.Now(),
-				ExpireTs: time.Now().Add(time.Duration(expireDuration) * time.Second),
-			}
-			esChan <- l.Message
-			if esClientStr != "" {
-				go database.WriteMsgToES(time.Now(), esChan, spiderLogIndex)
-			}
-			logs = append(logs, l)
-		}
-	}()
+	go readLogs(readerStderr, constants.LogStreamStderr, &isStderrFinished)
 
 	wg.Wait()
+
+	// 通知实时日志结束
+	PublishTaskLogEnd(t.Id)
 	return nil
 }
 
-func FinishOrCancelTask(ch chan string, cmd *exec.Cmd, s model.Spider, t model.Task) {
-	// 传入信号，此处阻塞
-	signal := <-ch
+func FinishOrCancelTask(ctx context.Context, ch chan string, cmd *exec.Cmd, s model.Spider, t model.Task) {
+	// 传入信号，此处阻塞；超时或出错时任务状态已由调用方保存，ctx 结束后直接退出
+	var signal string
+	select {
+	case signal = <-ch:
+	case <-ctx.Done():
+		return
+	}
 	log.Infof("process received signal: %s", signal)
 
 	if signal == constants.TaskCancel && cmd.Process != nil {
@@ -323,8 +720,86 @@ func StartTaskProcess(cmd *exec.Cmd, t model.Task) error {
 	return nil
 }
 
+// 获取任务最大运行时长，任务设置优先于爬虫设置
+func GetTaskTimeout(t model.Task, s model.Spider) time.Duration {
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = s.Timeout
+	}
+	if timeout <= 0 {
+		return 0
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// 终止任务进程：先发送SIGTERM，超过宽限时间后发送SIGKILL
+func TerminateTaskProcess(cmd *exec.Cmd, waitCh chan error) error {
+	// 兼容windows
+	if runtime.GOOS == constants.Windows {
+		_ = cmd.Process.Kill()
+		return <-waitCh
+	}
+
+	// 宽限时间
+	gracePeriod := viper.GetInt("task.killGracePeriod")
+	if gracePeriod <= 0 {
+		gracePeriod = 15
+	}
+
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM); err != nil {
+		log.Errorf("process terminate error: %s", err.Error())
+	}
+
+	select {
+	case err := <-waitCh:
+		return err
+	case <-time.After(time.Duration(gracePeriod) * time.Second):
+		log.Infof("process (pid: %d) not exited after %d sec, kill it", cmd.Process.Pid, gracePeriod)
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+			log.Errorf("process kill error: %s", err.Error())
+		}
+		return <-waitCh
+	}
+}
+
 func WaitTaskProcess(cmd *exec.Cmd, t model.Task, s model.Spider) error {
-	if err := cmd.Wait(); err != nil {
+	// 等待进程结束
+	waitCh := make(chan error, 1)
+	go func() {
+		waitCh <- cmd.Wait()
+	}()
+
+	// 最大运行时长
+	var timeoutCh <-chan time.Time
+	timeout := GetTaskTimeout(t, s)
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	var err error
+	select {
+	case err = <-waitCh:
+	case <-timeoutCh:
+		// 运行超时，终止进程
+		log.Infof("task (id: %s) timeout after %.0f sec, terminating", t.Id, timeout.Seconds())
+		_ = TerminateTaskProcess(cmd, waitCh)
+
+		t.Error = fmt.Sprintf("task timeout after %.0f sec", timeout.Seconds())
+		t.FinishTs = time.Now()
+		t.Status = constants.StatusTimeout
+		_ = t.Save()
+
+		// 按重试策略重新派发任务
+		RetryTask(t, s, constants.RetryOnTimeout, 0)
+
+		FinishUpTask(s, t)
+
+		return errors.New(t.Error)
+	}
+
+	if err != nil {
 		log.Errorf("wait process finish error: %s", err.Error())
 		debug.PrintStack()
 
@@ -340,6 +815,9 @@ func WaitTaskProcess(cmd *exec.Cmd, t model.Task, s model.Spider) error {
 				t.Status = constants.StatusError
 				_ = t.Save()
 
+				// 按重试策略重新派发任务
+				RetryTask(t, s, constants.RetryOnExitCode, exitCode)
+
 				FinishUpTask(s, t)
 			}
 		}
@@ -369,7 +847,7 @@ func ExecuteShellCmd(cmdStr string, cwd string, t model.Task, s model.Spider, u
 	cmd.Dir = cwd
 
 	// 日志配置
-	go SetLogConfig(wg, cmd, t, u)
+	go SetLogConfig(wg, cmd, t, s, u)
 
 	// 环境变量配置
 	envs := s.Envs
@@ -392,7 +870,9 @@ func ExecuteShellCmd(cmdStr string, cwd string, t model.Task, s model.Spider, u
 	// 起一个goroutine来监控进程
 	ch := utils.TaskExecChanMap.ChanBlocked(t.Id)
 
-	go FinishOrCancelTask(ch, cmd, s, t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go FinishOrCancelTask(ctx, ch, cmd, s, t)
 
 	// kill的时候，可以kill所有的子进程
 	if runtime.GOOS != constants.Windows {
@@ -401,6 +881,7 @@ func ExecuteShellCmd(cmdStr string, cwd string, t model.Task, s model.Spider, u
 
 	// 启动进程
 	if err := StartTaskProcess(cmd, t); err != nil {
+		go FinishUpTask(s, t)
 		return err
 	}
 
@@ -442,11 +923,6 @@ func GetLogFilePaths(fileDir string, t model.Task) (filePath string) {
 }
 
 // 生成执行任务方法
-func GetExecuteTaskFunc(id int) func() {
-	return func() {
-		ExecuteTask(id)
-	}
-}
 
 func GetWorkerPrefix(id int) string {
 	return "[Worker " + strconv.Itoa(id) + "] "
@@ -463,24 +939,64 @@ func SaveTaskResultCount(id string) func() {
 	}
 }
 
-// Scan Error Logs
-func ScanErrorLogs(t model.Task) func() {
-	return func() {
-		u, err := model.GetUser(t.UserId)
-		if err != nil {
-			return
+// 统计一批日志中的警告数，并生成错误日志
+func getLogLevelCounts(items []model.LogItem) (errorItems []model.ErrorLogItem, warningCount int) {
+	for _, l := range items {
+		if l.Level == constants.LogLevelWarning {
+			warningCount++
 		}
-		if err := model.UpdateTaskErrorLogs(t.Id, u.Setting.ErrorRegexPattern); err != nil {
-			return
+		if IsErrorLogLevel(l.Level) {
+			errorItems = append(errorItems, model.ErrorLogItem{
+				Id:       bson.NewObjectId(),
+				TaskId:   l.TaskId,
+				Message:  l.Message,
+				LogId:    l.Id,
+				Seq:      l.Seq,
+				Ts:       l.Ts,
+				ExpireTs: l.ExpireTs,
+			})
 		}
-		if err := model.UpdateErrorLogCount(t.Id); err != nil {
+	}
+	return errorItems, warningCount
+}
+
+// 爬虫并发槽位过期时间，运行中的任务会定期刷新
+const SpiderSlotTtl = 60 * time.Second
+
+// 爬虫运行中任务集合的key
+func GetSpiderSlotKey(spiderId bson.ObjectId) string {
+	return "spiders:running:" + spiderId.Hex()
+}
+
+// 获取爬虫并发槽位，未限制并发时直接返回true
+func AcquireSpiderSlot(t model.Task, spider model.Spider) (bool, error) {
+	if spider.MaxConcurrency <= 0 {
+		return true, nil
+	}
+	return database.RedisClient.AcquireSlot(GetSpiderSlotKey(spider.Id), t.Id, spider.MaxConcurrency, SpiderSlotTtl)
+}
+
+// 释放爬虫并发槽位
+func ReleaseSpiderSlot(t model.Task, spider model.Spider) {
+	if spider.MaxConcurrency <= 0 {
+		return
+	}
+	_ = database.RedisClient.ReleaseSlot(GetSpiderSlotKey(spider.Id), t.Id)
+}
+
+// 刷新爬虫并发槽位
+func RefreshSpiderSlot(t model.Task, spider model.Spider) func() {
+	return func() {
+		if spider.MaxConcurrency <= 0 {
 			return
 		}
+		_ = database.RedisClient.RefreshSlot(GetSpiderSlotKey(spider.Id), t.Id, SpiderSlotTtl)
 	}
 }
 
 // 执行任务
-func ExecuteTask(id int) {
+// 执行任务，返回是否取到了任务
+func ExecuteTask(id int) (popped bool) {
 	if flag, ok := LockList.Load(id); ok {
 		if flag.(bool) {
 			log.Debugf(GetWorkerPrefix(id) + "running tasks...")
@@ -508,16 +1024,11 @@ func ExecuteTask(id int) {
 		return
 	}
 
-	// 节点队列
-	queueCur := "tasks:node:" + node.Id.Hex()
-
-	// 节点队列任务
-	var msg string
-	if msg, err = database.RedisClient.LPop(queueCur); err != nil {
-		// 节点队列没有任务，获取公共队列任务
-		queuePub := "tasks:public"
-		if msg, err = database.RedisClient.LPop(queuePub); err != nil {
-		}
+	// 获取任务消息（放入处理中列表）
+	msg, err := PopTaskMessage(node.Id)
+	if err != nil && err != redis.ErrNil {
+		log.Errorf("pop task message error: %s", err.Error())
+		return
 	}
 
 	// 如果没有获取到任务，返回
@@ -525,6 +1036,21 @@ func ExecuteTask(id int) {
 		return
 	}
 
+	popped = true
+
+	// 任务处理完成后确认消息
+	defer AckTaskMessage(node.Id, msg)
+
+	// 统计忙碌的工作协程
+	if Exec != nil {
+		atomic.AddInt32(&Exec.busy, 1)
+		go Exec.SaveStats()
+		defer func() {
+			atomic.AddInt32(&Exec.busy, -1)
+			go Exec.SaveStats()
+		}()
+	}
+
 	// 反序列化
 	tMsg := TaskMessage{}
 	if err := json.Unmarshal([]byte(msg), &tMsg); err != nil {
@@ -539,6 +1065,12 @@ func ExecuteTask(id int) {
 		return
 	}
 
+	// 任务已被取消
+	if t.Status != constants.StatusPending {
+		log.Infof(GetWorkerPrefix(id) + "task (id:" + t.Id + ") is " + t.Status + ", skip")
+		return
+	}
+
 	// 获取爬虫
 	spider, err := t.GetSpider()
 	if err != nil {
@@ -546,6 +1078,21 @@ func ExecuteTask(id int) {
 		return
 	}
 
+	// 爬虫并发限制，达到上限时任务延迟重新入队
+	ok, err := AcquireSpiderSlot(t, spider)
+	if err != nil || !ok {
+		log.Debugf(GetWorkerPrefix(id) + "spider (id:" + spider.Id.Hex() + ") reached max concurrency, re-queue task (id:" + t.Id + ")")
+		// 延迟期间任务不在队列中，不会阻塞同一队列中的其他任务；到期后保留原有分数，不影响优先级和顺序
+		score := GetTaskQueueScore(t.Priority, t.CreateTs)
+		delay := time.Duration(constants.TaskConcurrencyWaitInterval) * time.Second
+		if err := DelayTaskMessage(GetTaskQueueName(t.NodeId), score, msg, delay); err != nil {
+			log.Errorf("re-queue task error: %s", err.Error())
+			debug.PrintStack()
+		}
+		return
+	}
+	defer ReleaseSpiderSlot(t, spider)
+
 	// 创建日志目录
 	var fileDir string
 	if fileDir, err = MakeLogDir(t); err != nil {
@@ -554,11 +1101,8 @@ func ExecuteTask(id int) {
 	// 获取日志文件路径
 	t.LogPath = GetLogFilePaths(fileDir, t)
 
-	// 工作目录
-	cwd := filepath.Join(
-		viper.GetString("spider.path"),
-		spider.Name,
-	)
+	// 工作目录（指定版本时为版本目录）
+	cwd := GetTaskSpiderDir(t, spider)
 
 	// 执行命令
 	var cmd string
@@ -597,6 +1141,12 @@ func ExecuteTask(id int) {
 		return
 	}
 
+	// 环境配置检查
+	if err := SpiderEnvProfileCheck(t, spider); err != nil {
+		log.Errorf("spider env profile check error: %s", err.Error())
+		return
+	}
+
 	// 开始执行任务
 	log.Infof(GetWorkerPrefix(id) + "start task (id:" + t.Id + ")")
 
@@ -611,19 +1161,14 @@ func ExecuteTask(id int) {
 		debug.PrintStack()
 		return
 	}
-	cronExec.Start()
-	defer cronExec.Stop()
-
-	// 起一个cron来更新错误日志
-	cronExecErrLog := cron.New(cron.WithSeconds())
-	_, err = cronExecErrLog.AddFunc("*/30 * * * * *", ScanErrorLogs(t))
+	_, err = cronExec.AddFunc("*/10 * * * * *", RefreshSpiderSlot(t, spider))
 	if err != nil {
 		log.Errorf(GetWorkerPrefix(id) + err.Error())
 		debug.PrintStack()
 		return
 	}
-	cronExecErrLog.Start()
-	defer cronExecErrLog.Stop()
+	cronExec.Start()
+	defer cronExec.Stop()
 
 	// 执行Shell命令
 	if err := ExecuteShellCmd(cmd, cwd, t, spider, user); err != nil {
@@ -671,6 +1216,9 @@ func ExecuteTask(id int) {
 	// 完成任务收尾工作
 	go FinishUpTask(spider, t)
 
+	// 投递任务结果到外部存储（只投递成功完成的任务，FinishUpTask 在任务结束时可能被调用多次）
+	go result_sink.DeliverTaskResults(spider, t)
+
 	// 结束计时
 	toc := time.Now()
 
@@ -678,23 +1226,64 @@ func ExecuteTask(id int) {
 	duration := toc.Sub(tic).Seconds()
 	durationStr := strconv.FormatFloat(duration, 'f', 6, 64)
 	log.Infof(GetWorkerPrefix(id) + "task (id:" + t.Id + ")" + " finished. elapsed:" + durationStr + " sec")
+
+	return
 }
 
 func FinishUpTask(s model.Spider, t model.Task) {
+	// 运行定时任务排队中的触发
+	if t.ScheduleId.Valid() && !utils.IsObjectIdNull(t.ScheduleId) {
+		go RunQueuedSchedule(t.ScheduleId)
+	}
+
+	// 更新工作流执行状态
+	if t.WorkflowRunId.Valid() {
+		go func() {
+			if err := UpdateWorkflowRun(t.WorkflowRunId); err != nil {
+				log.Errorf("update workflow run error: %s, id: %s", err.Error(), t.WorkflowRunId.Hex())
+			}
+		}()
+	}
+
 	// 更新任务结果数
 	go func() {
 		if err := model.UpdateTaskResultCount(t.Id); err != nil {
 			return
 		}
 	}()
+}
 
-	// 更新任务错误日志
-	go func() {
-		ScanErrorLogs(t)()
-	}()
+// 检查当前节点是否满足爬虫要求的环境配置，不满足且无法修复时任务失败
+func SpiderEnvProfileCheck(t model.Task, spider model.Spider) error {
+	if err := EnsureSpiderEnvProfile(spider); err != nil {
+		t.Error = err.Error()
+		t.Status = constants.StatusError
+		t.FinishTs = time.Now()                                 // 结束时间
+		t.RuntimeDuration = t.FinishTs.Sub(t.StartTs).Seconds() // 运行时长
+		t.TotalDuration = t.FinishTs.Sub(t.CreateTs).Seconds()  // 总时长
+		_ = t.Save()
+		go FinishUpTask(spider, t)
+		return errors.New(t.Error)
+	}
+	return nil
 }
 
 func SpiderFileCheck(t model.Task, spider model.Spider) error {
+	// 指定了爬虫版本，同步该版本的文件
+	if t.SpiderVersion > 0 {
+		if err := SyncSpiderVersion(spider, t.SpiderVersion); err != nil {
+			t.Error = fmt.Sprintf("cannot sync spider version %d: %s", t.SpiderVersion, err.Error())
+			t.Status = constants.StatusError
+			t.FinishTs = time.Now()                                 // 结束时间
+			t.RuntimeDuration = t.FinishTs.Sub(t.StartTs).Seconds() // 运行时长
+			t.TotalDuration = t.FinishTs.Sub(t.CreateTs).Seconds()  // 总时长
+			_ = t.Save()
+			go FinishUpTask(spider, t)
+			return errors.New(t.Error)
+		}
+		return nil
+	}
+
 	// 判断爬虫文件是否存在
 	gfFile := model.GetGridFs(spider.FileId)
 	if gfFile == nil {
@@ -704,6 +1293,7 @@ func SpiderFileCheck(t model.Task, spider model.Spider) error {
 		t.RuntimeDuration = t.FinishTs.Sub(t.StartTs).Seconds() // 运行时长
 		t.TotalDuration = t.FinishTs.Sub(t.CreateTs).Seconds()  // 总时长
 		_ = t.Save()
+		go FinishUpTask(spider, t)
 		return errors.New(t.Error)
 	}
 
@@ -718,13 +1308,19 @@ func SpiderFileCheck(t model.Task, spider model.Spider) error {
 	return nil
 }
 
-func GetTaskLog(id string, keyword string, page int, pageSize int) (logItems []model.LogItem, logTotal int, err error) {
-	task, err := model.GetTask(id)
-	if err != nil {
+func GetTaskLog(id string, keyword string, levels []string, streams []string, page int, pageSize int) (logItems []model.LogItem, logTotal int, err error) {
+	if _, err = model.GetTask(id); err != nil {
 		return
 	}
 
-	logItems, logTotal, err = task.GetLogItems(keyword, page, pageSize)
+	logItems, logTotal, err = log_sink.GetLogSource().GetLogItems(log_sink.LogQuery{
+		TaskId:   id,
+		Keyword:  keyword,
+		Levels:   levels,
+		Streams:  streams,
+		PageNum:  page,
+		PageSize: pageSize,
+	})
 	if err != nil {
 		return logItems, logTotal, err
 	}
@@ -762,6 +1358,20 @@ func CancelTask(id string) (err error) {
 		return errors.New("task is not cancellable")
 	}
 
+	// 等待中的任务（包括退避等待中的重试任务）直接置为已取消，执行器取出任务后会跳过
+	if task.Status == constants.StatusPending {
+		task.Error = "user cancelled the task ..."
+		task.Status = constants.StatusCancelled
+		task.FinishTs = time.Now()
+		if err := task.Save(); err != nil {
+			return err
+		}
+		if spider, err := task.GetSpider(); err == nil {
+			go FinishUpTask(spider, task)
+		}
+		return nil
+	}
+
 	// 获取当前节点（默认当前节点为主节点）
 	node, err := model.GetCurrentNode()
 	if err != nil {
@@ -820,12 +1430,16 @@ func RestartTask(id string, uid bson.ObjectId) (err error) {
 	}
 
 	newTask := model.Task{
-		SpiderId:   oldTask.SpiderId,
-		NodeId:     oldTask.NodeId,
-		Param:      oldTask.Param,
-		UserId:     uid,
-		RunType:    oldTask.RunType,
-		ScheduleId: bson.ObjectIdHex(constants.ObjectIdNull),
+		SpiderId:      oldTask.SpiderId,
+		NodeId:        oldTask.NodeId,
+		Param:         oldTask.Param,
+		UserId:        uid,
+		RunType:       oldTask.RunType,
+		ScheduleId:    bson.ObjectIdHex(constants.ObjectIdNull),
+		Timeout:       oldTask.Timeout,
+		Priority:      oldTask.Priority,
+		SpiderVersion: oldTask.SpiderVersion,
+		LabelSelector: oldTask.LabelSelector,
 	}
 
 	// 加入任务队列
@@ -839,7 +1453,110 @@ func RestartTask(id string, uid bson.ObjectId) (err error) {
 	return nil
 }
 
-func AddTask(t model.Task) (string, error) {
+// 获取任务的重试策略，定时任务的重试策略优先于爬虫的重试策略
+func GetTaskRetryPolicy(t model.Task, s model.Spider) model.RetryPolicy {
+	if !utils.IsObjectIdNull(t.ScheduleId) {
+		if sch, err := model.GetSchedule(t.ScheduleId); err == nil && sch.RetryPolicy.IsEnabled() {
+			return sch.RetryPolicy
+		}
+	}
+	return s.RetryPolicy
+}
+
+// 根据重试策略重新派发失败的任务，返回是否会重试
+// 重试任务立即存入数据库，任务消息放入延迟任务集合，退避时间结束后再加入任务队列
+func RetryTask(t model.Task, s model.Spider, reason string, exitCode int) bool {
+	policy := GetTaskRetryPolicy(t, s)
+
+	// 第几次执行（兼容没有执行次数的旧任务）
+	attempt := t.Attempt
+	if attempt == 0 {
+		attempt = 1
+	}
+
+	// 超过最大执行次数或不可重试，不再重试
+	if attempt >= policy.MaxAttempts || !policy.IsRetryable(reason, exitCode) {
+		return false
+	}
+
+	// 首次执行的任务ID
+	parentId := t.ParentId
+	if parentId == "" {
+		parentId = t.Id
+	}
+
+	// 随机派发的任务和节点异常终止的任务重新进入公共队列，避免派发到已离线的节点
+	// （按标签选择器派发的任务在派发时重新选择在线节点）
+	nodeId := t.NodeId
+	if t.RunType == constants.RunTypeRandom || reason == constants.RetryOnAbnormal {
+		nodeId = bson.ObjectIdHex(constants.ObjectIdNull)
+	}
+
+	newTask := model.Task{
+		SpiderId:      t.SpiderId,
+		NodeId:        nodeId,
+		Param:         t.Param,
+		UserId:        t.UserId,
+		RunType:       t.RunType,
+		ScheduleId:    t.ScheduleId,
+		ParentId:      parentId,
+		Attempt:       attempt + 1,
+		Timeout:       t.Timeout,
+		Priority:      t.Priority,
+		WorkflowRunId: t.WorkflowRunId,
+		WorkflowStep:  t.WorkflowStep,
+		SpiderVersion: t.SpiderVersion,
+		LabelSelector: t.LabelSelector,
+	}
+
+	// 将任务存入数据库
+	newTask, err := CreateTask(newTask)
+	if err != nil {
+		log.Errorf("retry task error: %s, task id: %s", err.Error(), t.Id)
+		debug.PrintStack()
+		return false
+	}
+
+	// 退避等待后加入任务队列
+	backoff := policy.GetBackoffDuration(attempt)
+	log.Infof("retry task (id: %s, reason: %s) in %.0f sec, attempt: %d/%d", t.Id, reason, backoff.Seconds(), newTask.Attempt, policy.MaxAttempts)
+	if err := AssignTaskAfter(newTask, backoff); err != nil {
+		log.Errorf("retry task error: %s, task id: %s", err.Error(), t.Id)
+		debug.PrintStack()
+		return false
+	}
+
+	return true
+}
+
+// 将节点上运行中的任务置为异常，并按重试策略重新派发
+func HandleAbnormalTasks(nodeId bson.ObjectId) error {
+	// 运行中的任务
+	tasks, err := model.GetTaskList(bson.M{"node_id": nodeId, "status": constants.StatusRunning}, 0, constants.Infinite, "-create_ts")
+	if err != nil {
+		return err
+	}
+
+	// 更新任务状态为异常
+	if err := model.UpdateTaskToAbnormal(nodeId); err != nil {
+		return err
+	}
+
+	for _, t := range tasks {
+		spider, err := t.GetSpider()
+		if err != nil {
+			continue
+		}
+		t.Status = constants.StatusAbnormal
+		RetryTask(t, spider, constants.RetryOnAbnormal, 0)
+		FinishUpTask(spider, t)
+	}
+
+	return nil
+}
+
+// 生成任务并存入数据库（不加入任务队列）
+func CreateTask(t model.Task) (model.Task, error) {
 	// 生成任务ID
 	id := uuid.NewV4()
 	t.Id = id.String()
@@ -847,6 +1564,16 @@ func AddTask(t model.Task) (string, error) {
 	// 设置任务状态
 	t.Status = constants.StatusPending
 
+	// 首次执行
+	if t.Attempt == 0 {
+		t.Attempt = 1
+	}
+
+	// 默认优先级
+	if t.Priority == 0 {
+		t.Priority = constants.TaskPriorityDefault
+	}
+
 	// 如果没有传入node_id，则置为null
 	if t.NodeId.Hex() == "" {
 		t.NodeId = bson.ObjectIdHex(constants.ObjectIdNull)
@@ -856,6 +1583,16 @@ func AddTask(t model.Task) (string, error) {
 	if err := model.AddTask(t); err != nil {
 		log.Errorf(err.Error())
 		debug.PrintStack()
+		return t, err
+	}
+
+	return t, nil
+}
+
+func AddTask(t model.Task) (string, error) {
+	// 将任务存入数据库
+	t, err := CreateTask(t)
+	if err != nil {
 		return t.Id, err
 	}
 
@@ -876,6 +1613,9 @@ func GetTaskEmailMarkdownContent(t model.Task, s model.Spider) string {
 	if t.Status == constants.StatusError {
 		errMsg = " with errors"
 		statusMsg = fmt.Sprintf(`<span style="color:red">%s</span>`, t.Status)
+	} else if t.Status == constants.StatusTimeout {
+		errMsg = " with timeout"
+		statusMsg = fmt.Sprintf(`<span style="color:red">%s</span>`, t.Status)
 	}
 	return fmt.Sprintf(`
 Your task has finished%s. Please find the task info below.
@@ -926,6 +1666,10 @@ func GetTaskMarkdownContent(t model.Task, s model.Spider) string {
 		errMsg = `（有错误）`
 		errLog = fmt.Sprintf(`<font color="#FF0000">%s</font>`, t.Error)
 		statusMsg = fmt.Sprintf(`<font color="#FF0000">%s</font>`, t.Status)
+	} else if t.Status == constants.StatusTimeout {
+		errMsg = `（运行超时）`
+		errLog = fmt.Sprintf(`<font color="#FF0000">%s</font>`, t.Error)
+		statusMsg = fmt.Sprintf(`<font color="#FF0000">%s</font>`, t.Status)
 	}
 	return fmt.Sprintf(`
 您的任务已完成%s，请查看任务信息如下。
@@ -969,6 +1713,8 @@ func SendTaskEmail(u model.User, t model.Task, s model.Spider) {
 	statusMsg := "has finished"
 	if t.Status == constants.StatusError {
 		statusMsg = "has an error"
+	} else if t.Status == constants.StatusTimeout {
+		statusMsg = "has timed out"
 	}
 	title := fmt.Sprintf("[Crawlab] Task for \"%s\" %s", s.Name, statusMsg)
 	if err := notification.SendMail(
@@ -986,6 +1732,8 @@ func SendTaskDingTalk(u model.User, t model.Task, s model.Spider) {
 	statusMsg := "已完成"
 	if t.Status == constants.StatusError {
 		statusMsg = "发生错误"
+	} else if t.Status == constants.StatusTimeout {
+		statusMsg = "运行超时"
 	}
 	title := fmt.Sprintf("[Crawlab] \"%s\" 任务%s", s.Name, statusMsg)
 	content := GetTaskMarkdownContent(t, s)
@@ -1037,12 +1785,14 @@ func SendWebHookRequest(u model.User, t model.Task, s model.Spider) {
 			"Content-Type": "application/json; charset=utf-8",
 		}
 
-		// request body
+		// request body，爬虫敏感配置不发送给外部地址
+		spider := s.Masked()
+		spider.ResultSinks = nil
 		reqBody := RequestBody{
 			Status:   t.Status,
 			UserName: u.Username,
 			Task:     t,
-			Spider:   s,
+			Spider:   spider,
 		}
 
 		// make POST http request
@@ -1068,11 +1818,27 @@ func InitTaskExecutor() error {
 		Cron: c,
 	}
 
+	// 迁移旧版本任务队列
+	if model.IsMaster() {
+		if err := MigrateTaskQueues(); err != nil {
+			log.Errorf("migrate task queues error: %s", err.Error())
+			debug.PrintStack()
+		}
+	}
+
 	// 如果不允许主节点运行任务，则跳过
 	if model.IsMaster() && viper.GetString("setting.runOnMaster") == "N" {
 		return nil
 	}
 
+	// 将本节点上次运行时未确认的任务消息放回队列
+	if node, err := model.GetCurrentNode(); err == nil {
+		if err := RequeueTaskMessages(node.Id); err != nil {
+			log.Errorf("requeue task messages error: %s", err.Error())
+			debug.PrintStack()
+		}
+	}
+
 	// 运行定时任务
 	if err := Exec.Start(); err != nil {
 		return err
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"crawlab/constants"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestGetTaskQueueScore(t *testing.T) {
+	Convey("Test GetTaskQueueScore", t, func() {
+		ts := time.Now()
+		high := GetTaskQueueScore(constants.TaskPriorityHighest, ts.Add(time.Hour))
+		normal := GetTaskQueueScore(constants.TaskPriorityDefault, ts)
+		normalLater := GetTaskQueueScore(constants.TaskPriorityDefault, ts.Add(time.Second))
+		low := GetTaskQueueScore(constants.TaskPriorityLowest, ts)
+
+		// 高优先级的任务先执行
+		So(high, ShouldBeLessThan, normal)
+		So(normal, ShouldBeLessThan, low)
+
+		// 相同优先级按入队时间执行
+		So(normal, ShouldBeLessThan, normalLater)
+
+		// 超出范围的优先级
+		So(GetTaskQueueScore(100, ts), ShouldEqual, GetTaskQueueScore(constants.TaskPriorityHighest, ts))
+		So(GetTaskQueueScore(0, ts), ShouldEqual, GetTaskQueueScore(constants.TaskPriorityLowest, ts))
+	})
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"crawlab/constants"
+	"crawlab/model"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+	"github.com/spf13/viper"
+	"time"
+)
+
+// API Token 权限范围对应的权限
+var tokenScopePermissions = map[string][]string{
+	constants.TokenScopeRead: {
+		constants.PermissionSpiderView,
+	},
+	constants.TokenScopeRun: {
+		constants.PermissionSpiderView,
+		constants.PermissionSpiderRun,
+	},
+	constants.TokenScopeSpiderManage: {
+		constants.PermissionSpiderView,
+		constants.PermissionSpiderEdit,
+		constants.PermissionSpiderDelete,
+		constants.PermissionScheduleManage,
+	},
+}
+
+// 生成 API Token，过期时间与数据库记录一致
+func MakeApiToken(user *model.User, t model.Token) (tokenStr string, err error) {
+	claims := jwt.MapClaims{
+		"id":       user.Id,
+		"username": user.Username,
+		"type":     constants.TokenTypeApi,
+		"tid":      t.Id,
+		"nbf":      time.Now().Unix(),
+	}
+	if !t.ExpireTs.IsZero() {
+		claims["exp"] = t.ExpireTs.Unix()
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	return token.SignedString([]byte(viper.GetString("server.secret")))
+}
+
+func ValidateTokenScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("scopes should not be empty")
+	}
+	for _, scope := range scopes {
+		if _, ok := tokenScopePermissions[scope]; !ok {
+			return errors.New("invalid token scope: " + scope)
+		}
+	}
+	return nil
+}
+
+// 是否不限制权限：登录 token 和未设置权限范围的旧版 Token
+func TokenHasFullAccess(t *model.Token) bool {
+	return t == nil || (t.Legacy && len(t.Scopes) == 0)
+}
+
+// API Token 是否拥有权限，未设置权限范围的新版 Token 没有任何权限
+func TokenHasPermission(t *model.Token, permission string) bool {
+	if TokenHasFullAccess(t) {
+		return true
+	}
+	for _, scope := range t.Scopes {
+		for _, p := range tokenScopePermissions[scope] {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// API Token 是否可以操作该爬虫
+func TokenAllowsSpider(t *model.Token, spider model.Spider) bool {
+	if t == nil || (len(t.SpiderIds) == 0 && len(t.ProjectIds) == 0) {
+		return true
+	}
+	for _, id := range t.SpiderIds {
+		if id == spider.Id {
+			return true
+		}
+	}
+	for _, id := range t.ProjectIds {
+		if id == spider.ProjectId {
+			return true
+		}
+	}
+	return false
+}
+
+// API Token 是否可以操作该项目，只限定了爬虫的 Token 不能操作项目
+func TokenAllowsProject(t *model.Token, projectId bson.ObjectId) bool {
+	if t == nil || (len(t.SpiderIds) == 0 && len(t.ProjectIds) == 0) {
+		return true
+	}
+	for _, id := range t.ProjectIds {
+		if id == projectId {
+			return true
+		}
+	}
+	return false
+}
+
+// 获取当前请求使用的 API Token，登录 token 返回 nil
+func GetCurrentToken(c *gin.Context) *model.Token {
+	data, _ := c.Get(constants.ContextToken)
+	if data == nil {
+		return nil
+	}
+	return data.(*model.Token)
+}
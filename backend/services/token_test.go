@@ -0,0 +1,70 @@
+package services
+
+import (
+	"crawlab/constants"
+	"crawlab/model"
+	"github.com/globalsign/mgo/bson"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+	"testing"
+	"time"
+)
+
+func TestTokenHasPermission(t *testing.T) {
+	Convey("Test TokenHasPermission", t, func() {
+		// 登录 token 和未设置权限范围的旧版 Token 不限制
+		So(TokenHasPermission(nil, constants.PermissionSpiderDelete), ShouldBeTrue)
+		So(TokenHasPermission(&model.Token{Legacy: true}, constants.PermissionSpiderDelete), ShouldBeTrue)
+
+		// 未设置权限范围的新版 Token 没有权限
+		So(TokenHasPermission(&model.Token{}, constants.PermissionSpiderView), ShouldBeFalse)
+
+		token := &model.Token{Scopes: []string{constants.TokenScopeRun}}
+		So(TokenHasPermission(token, constants.PermissionSpiderRun), ShouldBeTrue)
+		So(TokenHasPermission(token, constants.PermissionSpiderEdit), ShouldBeFalse)
+
+		So(ValidateTokenScopes([]string{constants.TokenScopeRead}), ShouldBeNil)
+		So(ValidateTokenScopes([]string{}), ShouldNotBeNil)
+		So(ValidateTokenScopes([]string{"admin"}), ShouldNotBeNil)
+	})
+}
+
+func TestTokenAllowsSpider(t *testing.T) {
+	Convey("Test TokenAllowsSpider", t, func() {
+		projectId := bson.NewObjectId()
+		spider := model.Spider{Id: bson.NewObjectId(), ProjectId: projectId}
+		other := model.Spider{Id: bson.NewObjectId(), ProjectId: bson.NewObjectId()}
+
+		So(TokenAllowsSpider(&model.Token{}, spider), ShouldBeTrue)
+
+		token := &model.Token{ProjectIds: []bson.ObjectId{projectId}}
+		So(TokenAllowsSpider(token, spider), ShouldBeTrue)
+		So(TokenAllowsSpider(token, other), ShouldBeFalse)
+		So(TokenAllowsProject(token, projectId), ShouldBeTrue)
+
+		token = &model.Token{SpiderIds: []bson.ObjectId{other.Id}}
+		So(TokenAllowsSpider(token, other), ShouldBeTrue)
+		So(TokenAllowsSpider(token, spider), ShouldBeFalse)
+		So(TokenAllowsProject(token, projectId), ShouldBeFalse)
+	})
+}
+
+func TestMakeToken(t *testing.T) {
+	viper.Set("server.secret", "test")
+	viper.Set("server.token.expire", 60)
+	user := &model.User{Id: bson.NewObjectId(), Username: "test"}
+
+	Convey("Test MakeToken", t, func() {
+		tokenStr, err := MakeToken(user)
+		So(err, ShouldBeNil)
+
+		claim, err := parseTokenClaims(tokenStr)
+		So(err, ShouldBeNil)
+		So(claim["type"], ShouldEqual, constants.TokenTypeAccess)
+		So(int64(claim["exp"].(float64)), ShouldBeLessThanOrEqualTo, time.Now().Unix()+60)
+
+		// 登录 token 不能用于刷新
+		_, _, err = RefreshToken(tokenStr)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"github.com/globalsign/mgo/bson"
+	uuid "github.com/satori/go.uuid"
 	"github.com/spf13/viper"
 	"strings"
 	"time"
@@ -15,20 +16,59 @@ import (
 
 func InitUserService() error {
 	_ = CreateNewUser("admin", "admin", constants.RoleAdmin, "", bson.ObjectIdHex(constants.ObjectIdNull))
+	if err := model.InitRefreshTokenIndexes(); err != nil {
+		return err
+	}
 	return nil
 }
 
 func MakeToken(user *model.User) (tokenStr string, err error) {
+	expire := viper.GetInt64("server.token.expire")
+	if expire <= 0 {
+		expire = constants.TokenExpireDefault
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"id":       user.Id,
 		"username": user.Username,
+		"type":     constants.TokenTypeAccess,
 		"nbf":      time.Now().Unix(),
+		"exp":      time.Now().Unix() + expire,
 	})
 
 	return token.SignedString([]byte(viper.GetString("server.secret")))
 
 }
 
+// 生成刷新 token，用于在登录 token 过期前后换取新的登录 token
+// 刷新 token 的 jti 存入数据库，登出或修改密码时删除后立即失效
+func MakeRefreshToken(user *model.User) (tokenStr string, err error) {
+	expire := viper.GetInt64("server.token.refreshExpire")
+	if expire <= 0 {
+		expire = constants.TokenRefreshExpireDefault
+	}
+
+	rt := model.RefreshToken{
+		Id:       uuid.NewV4().String(),
+		UserId:   user.Id,
+		ExpireTs: time.Now().Add(time.Duration(expire) * time.Second),
+	}
+	if err := rt.Add(); err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id":       user.Id,
+		"username": user.Username,
+		"type":     constants.TokenTypeRefresh,
+		"jti":      rt.Id,
+		"nbf":      time.Now().Unix(),
+		"exp":      rt.ExpireTs.Unix(),
+	})
+
+	return token.SignedString([]byte(viper.GetString("server.secret")))
+}
+
 //func GetToken(username string) (tokenStr string, err error) {
 //	user, err := model.GetUserByUsername(username)
 //	if err != nil {
@@ -57,6 +97,100 @@ func SecretFunc() jwt.Keyfunc {
 }
 
 func CheckToken(tokenStr string) (user model.User, err error) {
+	user, _, err = ParseToken(tokenStr)
+	return
+}
+
+// 校验 token，API Token 同时返回其数据库记录
+func ParseToken(tokenStr string) (user model.User, apiToken *model.Token, err error) {
+	claim, err := parseTokenClaims(tokenStr)
+	if err != nil {
+		return
+	}
+
+	tokenType, _ := claim["type"].(string)
+	switch tokenType {
+	case constants.TokenTypeAccess:
+		// do nothing
+	case constants.TokenTypeApi, "":
+		// API Token 每次都查询数据库，删除后立即失效
+		t, e := model.GetTokenByTokenStr(tokenStr)
+		if e != nil {
+			if tokenType == "" {
+				err = errors.New("token has no expiry, please login again")
+			} else {
+				err = errors.New("token has been revoked")
+			}
+			return
+		}
+		if t.IsExpired() {
+			err = errors.New("token is expired")
+			return
+		}
+		t.Legacy = tokenType == ""
+		apiToken = &t
+	default:
+		err = errors.New("invalid token type")
+		return
+	}
+
+	user, err = getTokenUser(claim)
+	return
+}
+
+// 使用刷新 token 换取新的登录 token 和刷新 token，旧的刷新 token 随即失效
+func RefreshToken(refreshTokenStr string) (tokenStr string, newRefreshTokenStr string, err error) {
+	claim, err := parseTokenClaims(refreshTokenStr)
+	if err != nil {
+		return
+	}
+
+	if tokenType, _ := claim["type"].(string); tokenType != constants.TokenTypeRefresh {
+		err = errors.New("not a refresh token")
+		return
+	}
+
+	// 用户被删除或用户名变更时失效
+	user, err := getTokenUser(claim)
+	if err != nil {
+		return
+	}
+
+	// 已登出或修改过密码的刷新 token 不在数据库中
+	jti, _ := claim["jti"].(string)
+	rt, err := model.GetRefreshToken(jti)
+	if err != nil || rt.UserId != user.Id {
+		err = errors.New("refresh token has been revoked")
+		return
+	}
+	if err = model.RemoveRefreshToken(jti); err != nil {
+		return
+	}
+
+	if tokenStr, err = MakeToken(&user); err != nil {
+		return
+	}
+	if newRefreshTokenStr, err = MakeRefreshToken(&user); err != nil {
+		return
+	}
+	return
+}
+
+// 登出时使刷新 token 失效
+func RevokeRefreshToken(refreshTokenStr string) error {
+	claim, err := parseTokenClaims(refreshTokenStr)
+	if err != nil {
+		// 已过期或无效的刷新 token 不需要处理
+		return nil
+	}
+	if tokenType, _ := claim["type"].(string); tokenType != constants.TokenTypeRefresh {
+		return errors.New("not a refresh token")
+	}
+	jti, _ := claim["jti"].(string)
+	return model.RemoveRefreshToken(jti)
+}
+
+func parseTokenClaims(tokenStr string) (claim jwt.MapClaims, err error) {
 	token, err := jwt.Parse(tokenStr, SecretFunc())
 	if err != nil {
 		return
@@ -74,9 +208,17 @@ func CheckToken(tokenStr string) (user model.User, err error) {
 		return
 	}
 
-	id := bson.ObjectIdHex(claim["id"].(string))
-	username := claim["username"].(string)
-	user, err = model.GetUser(id)
+	return
+}
+
+func getTokenUser(claim jwt.MapClaims) (user model.User, err error) {
+	idStr, _ := claim["id"].(string)
+	if !bson.IsObjectIdHex(idStr) {
+		err = errors.New("invalid user id")
+		return
+	}
+	username, _ := claim["username"].(string)
+	user, err = model.GetUser(bson.ObjectIdHex(idStr))
 	if err != nil {
 		err = errors.New("cannot get user")
 		return
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"crawlab/model"
+	"crawlab/utils"
+	"github.com/apex/log"
+	"runtime/debug"
+)
+
+// 获取对该爬虫生效的变量，加密变量返回解密后的值
+func GetSpiderVariables(spider model.Spider) []model.Variable {
+	var list []model.Variable
+	for _, variable := range model.GetVariableList() {
+		if !variable.AppliesTo(spider) {
+			continue
+		}
+		value, err := variable.GetValue()
+		if err != nil {
+			log.Errorf("decrypt variable error: %s, key: %s", err.Error(), variable.Key)
+			debug.PrintStack()
+			continue
+		}
+		variable.Value = value
+		list = append(list, variable)
+	}
+	return list
+}
+
+// 生成任务日志的脱敏器，替换日志中出现的加密变量和 Git 密码
+func GetSpiderSecretMasker(spider model.Spider) *utils.SecretMasker {
+	var values []string
+	for _, variable := range GetSpiderVariables(spider) {
+		if variable.Secret {
+			values = append(values, variable.Value)
+		}
+	}
+	if password, err := spider.GetGitPassword(); err == nil && password != "" {
+		values = append(values, password)
+	}
+	return utils.NewSecretMasker(values)
+}
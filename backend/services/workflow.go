@@ -0,0 +1,441 @@
+package services
+
+import (
+	"crawlab/constants"
+	"crawlab/database"
+	"crawlab/model"
+	"errors"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/globalsign/mgo/bson"
+	"regexp"
+	"runtime/debug"
+	"time"
+)
+
+// 工作流步骤标识只允许字母、数字、下划线和中划线
+var workflowStepKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// 校验工作流定义：步骤标识唯一、上游步骤存在、无环
+func ValidateWorkflow(w model.Workflow) error {
+	if len(w.Steps) == 0 {
+		return errors.New("workflow should have at least one step")
+	}
+
+	steps := map[string]model.WorkflowStep{}
+	for _, step := range w.Steps {
+		if !workflowStepKeyRegex.MatchString(step.Key) {
+			return fmt.Errorf("invalid step key: '%s'", step.Key)
+		}
+		if _, ok := steps[step.Key]; ok {
+			return fmt.Errorf("duplicated step key: '%s'", step.Key)
+		}
+		if !step.SpiderId.Valid() {
+			return fmt.Errorf("spider of step '%s' is not set", step.Key)
+		}
+		if step.RunType != constants.RunTypeRandom && step.RunType != constants.RunTypeAllNodes && step.RunType != constants.RunTypeSelectedNodes {
+			return fmt.Errorf("invalid run_type of step '%s'", step.Key)
+		}
+		if err := ValidateLabelSelector(step.LabelSelector); err != nil {
+			return fmt.Errorf("invalid label_selector of step '%s'", step.Key)
+		}
+		if step.Condition != "" && step.Condition != constants.WorkflowConditionSuccess && step.Condition != constants.WorkflowConditionFailure && step.Condition != constants.WorkflowConditionAlways {
+			return fmt.Errorf("invalid condition of step '%s'", step.Key)
+		}
+		steps[step.Key] = step
+	}
+
+	for _, step := range w.Steps {
+		for _, up := range step.Upstreams {
+			if _, ok := steps[up]; !ok {
+				return fmt.Errorf("upstream '%s' of step '%s' not found", up, step.Key)
+			}
+		}
+	}
+
+	// 检查是否有环（深度优先遍历）
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := map[string]int{}
+	var visit func(key string) error
+	visit = func(key string) error {
+		switch states[key] {
+		case visiting:
+			return fmt.Errorf("cycle detected at step '%s'", key)
+		case visited:
+			return nil
+		}
+		states[key] = visiting
+		for _, up := range steps[key].Upstreams {
+			if err := visit(up); err != nil {
+				return err
+			}
+		}
+		states[key] = visited
+		return nil
+	}
+	for _, step := range w.Steps {
+		if err := visit(step.Key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 根据步骤的任务计算步骤状态，重试的任务以最后一次执行为准
+func GetWorkflowStepStatus(tasks []model.Task) string {
+	if len(tasks) == 0 {
+		return constants.WorkflowStepStatusRunning
+	}
+
+	// 每组重试任务中最后一次执行的任务
+	latest := map[string]model.Task{}
+	for _, t := range tasks {
+		parentId := t.ParentId
+		if parentId == "" {
+			parentId = t.Id
+		}
+		if cur, ok := latest[parentId]; !ok || t.Attempt > cur.Attempt {
+			latest[parentId] = t
+		}
+	}
+
+	status := constants.WorkflowStepStatusFinished
+	for _, t := range latest {
+		switch t.Status {
+		case constants.StatusPending, constants.StatusRunning:
+			return constants.WorkflowStepStatusRunning
+		case constants.StatusFinished:
+		default:
+			status = constants.WorkflowStepStatusError
+		}
+	}
+	return status
+}
+
+// 根据上游步骤状态判断步骤是否可以开始，返回（是否已可判断，是否执行）
+func EvaluateWorkflowCondition(condition string, upstreamStatuses []string) (bool, bool) {
+	hasError := false
+	allFinished := true
+	for _, status := range upstreamStatuses {
+		switch status {
+		case constants.WorkflowStepStatusPending, constants.WorkflowStepStatusRunning:
+			return false, false
+		case constants.WorkflowStepStatusError:
+			hasError = true
+			allFinished = false
+		case constants.WorkflowStepStatusSkipped:
+			allFinished = false
+		}
+	}
+
+	switch condition {
+	case constants.WorkflowConditionFailure:
+		return true, hasError
+	case constants.WorkflowConditionAlways:
+		return true, true
+	default:
+		return true, allFinished
+	}
+}
+
+// 按运行方式派发任务，返回任务ID列表，任务的标签选择器在随机和所有节点方式下生效
+func AddTasksByRunType(t model.Task, runType string, nodeIds []bson.ObjectId) ([]string, error) {
+	var taskIds []string
+
+	t.RunType = runType
+	if runType == constants.RunTypeAllNodes {
+		// 所有节点（满足标签选择器）
+		nodes, err := GetNodeListByLabelSelector(t.LabelSelector)
+		if err != nil {
+			return taskIds, err
+		}
+		for _, node := range nodes {
+			t.NodeId = node.Id
+			id, err := AddTask(t)
+			if err != nil {
+				return taskIds, err
+			}
+			taskIds = append(taskIds, id)
+		}
+	} else if runType == constants.RunTypeRandom {
+		// 随机
+		t.NodeId = bson.ObjectIdHex(constants.ObjectIdNull)
+		id, err := AddTask(t)
+		if err != nil {
+			return taskIds, err
+		}
+		taskIds = append(taskIds, id)
+	} else if runType == constants.RunTypeSelectedNodes {
+		// 指定节点
+		for _, nodeId := range nodeIds {
+			t.NodeId = nodeId
+			id, err := AddTask(t)
+			if err != nil {
+				return taskIds, err
+			}
+			taskIds = append(taskIds, id)
+		}
+	} else {
+		return taskIds, errors.New("invalid run_type")
+	}
+
+	return taskIds, nil
+}
+
+// 运行工作流
+func RunWorkflow(w model.Workflow, uid bson.ObjectId) (model.WorkflowRun, error) {
+	run := model.WorkflowRun{
+		WorkflowId: w.Id,
+		Status:     constants.WorkflowRunStatusRunning,
+		Definition: w.Steps,
+		Steps:      map[string]model.WorkflowRunStep{},
+		UserId:     uid,
+	}
+	for _, step := range w.Steps {
+		run.Steps[step.Key] = model.WorkflowRunStep{
+			Status:  constants.WorkflowStepStatusPending,
+			TaskIds: []string{},
+		}
+	}
+	if err := run.Add(); err != nil {
+		return run, err
+	}
+
+	// 开始没有上游的步骤
+	if err := UpdateWorkflowRun(run.Id); err != nil {
+		return run, err
+	}
+
+	return run, nil
+}
+
+// 开始工作流步骤
+func startWorkflowStep(run model.WorkflowRun, step model.WorkflowStep) model.WorkflowRunStep {
+	runStep := run.Steps[step.Key]
+	runStep.Status = constants.WorkflowStepStatusRunning
+	runStep.StartTs = time.Now()
+
+	t := model.Task{
+		SpiderId:      step.SpiderId,
+		Param:         step.Param,
+		UserId:        run.UserId,
+		ScheduleId:    bson.ObjectIdHex(constants.ObjectIdNull),
+		WorkflowRunId: run.Id,
+		WorkflowStep:  step.Key,
+		LabelSelector: step.LabelSelector,
+	}
+	taskIds, err := AddTasksByRunType(t, step.RunType, step.NodeIds)
+	runStep.TaskIds = taskIds
+	if err != nil {
+		runStep.Error = err.Error()
+	} else if len(taskIds) == 0 {
+		runStep.Error = "no task is assigned"
+	}
+	if runStep.Error != "" {
+		runStep.Status = constants.WorkflowStepStatusError
+		runStep.FinishTs = time.Now()
+	}
+	return runStep
+}
+
+// 工作流执行加锁，多个任务同时结束时需要依次处理
+func lockWorkflowRun(id bson.ObjectId) (func(), error) {
+	lockKey := "workflow_runs:" + id.Hex()
+	var lockValue int64
+	var err error
+	for i := 0; i < 60; i++ {
+		if lockValue, err = database.RedisClient.Lock(lockKey); err == nil {
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		database.RedisClient.UnLock(lockKey, lockValue)
+	}, nil
+}
+
+// 更新工作流执行状态
+func UpdateWorkflowRun(id bson.ObjectId) error {
+	unlock, err := lockWorkflowRun(id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return updateWorkflowRun(id)
+}
+
+func updateWorkflowRun(id bson.ObjectId) error {
+	run, err := model.GetWorkflowRun(id)
+	if err != nil {
+		return err
+	}
+	if run.Status != constants.WorkflowRunStatusRunning {
+		return nil
+	}
+
+	// 按步骤分组任务
+	tasks, err := run.GetTasks()
+	if err != nil {
+		return err
+	}
+	stepTasks := map[string][]model.Task{}
+	for _, t := range tasks {
+		stepTasks[t.WorkflowStep] = append(stepTasks[t.WorkflowStep], t)
+	}
+
+	// 更新运行中步骤的状态
+	for key, runStep := range run.Steps {
+		if runStep.Status != constants.WorkflowStepStatusRunning {
+			continue
+		}
+		runStep.Status = GetWorkflowStepStatus(stepTasks[key])
+		if runStep.Status != constants.WorkflowStepStatusRunning {
+			runStep.FinishTs = time.Now()
+		}
+		run.Steps[key] = runStep
+	}
+
+	// 开始或跳过上游已结束的步骤，直到没有步骤状态发生变化
+	for changed := true; changed; {
+		changed = false
+		for _, step := range run.Definition {
+			runStep := run.Steps[step.Key]
+			if runStep.Status != constants.WorkflowStepStatusPending {
+				continue
+			}
+
+			var upstreamStatuses []string
+			for _, up := range step.Upstreams {
+				upstreamStatuses = append(upstreamStatuses, run.Steps[up].Status)
+			}
+			ready, shouldRun := EvaluateWorkflowCondition(step.Condition, upstreamStatuses)
+			if !ready {
+				continue
+			}
+			changed = true
+
+			if !shouldRun {
+				runStep.Status = constants.WorkflowStepStatusSkipped
+				runStep.FinishTs = time.Now()
+				run.Steps[step.Key] = runStep
+				continue
+			}
+
+			// 防止重复开始步骤
+			ok, err := run.StartStep(step.Key)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			run.Steps[step.Key] = startWorkflowStep(run, step)
+		}
+	}
+
+	// 所有步骤结束后更新工作流执行状态
+	status := constants.WorkflowRunStatusFinished
+	for _, runStep := range run.Steps {
+		if runStep.Status == constants.WorkflowStepStatusPending || runStep.Status == constants.WorkflowStepStatusRunning {
+			status = constants.WorkflowRunStatusRunning
+			break
+		}
+		if runStep.Status == constants.WorkflowStepStatusError {
+			status = constants.WorkflowRunStatusError
+		}
+	}
+	run.Status = status
+	if run.Status != constants.WorkflowRunStatusRunning {
+		run.FinishTs = time.Now()
+	}
+
+	return run.Save()
+}
+
+// 取消工作流执行
+func CancelWorkflowRun(id bson.ObjectId) error {
+	unlock, err := lockWorkflowRun(id)
+	if err != nil {
+		return err
+	}
+
+	run, err := model.GetWorkflowRun(id)
+	if err != nil {
+		unlock()
+		return err
+	}
+	if run.Status != constants.WorkflowRunStatusRunning {
+		unlock()
+		return errors.New("workflow run is not cancellable")
+	}
+
+	// 先将状态置为已取消，避免继续开始下游步骤
+	run.Status = constants.WorkflowRunStatusCancelled
+	run.FinishTs = time.Now()
+	if err := run.Save(); err != nil {
+		unlock()
+		return err
+	}
+	unlock()
+
+	// 取消未结束的任务
+	tasks, err := run.GetTasks()
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		if t.Status != constants.StatusPending && t.Status != constants.StatusRunning {
+			continue
+		}
+		if err := CancelTask(t.Id); err != nil {
+			log.Errorf("cancel workflow task error: %s, task_id: %s", err.Error(), t.Id)
+			debug.PrintStack()
+		}
+	}
+
+	return nil
+}
+
+// 获取工作流任务上游步骤中已完成的任务ID
+func GetWorkflowUpstreamTaskIds(t model.Task) []string {
+	var taskIds []string
+
+	run, err := model.GetWorkflowRun(t.WorkflowRunId)
+	if err != nil {
+		return taskIds
+	}
+
+	var upstreams []string
+	for _, step := range run.Definition {
+		if step.Key == t.WorkflowStep {
+			upstreams = step.Upstreams
+			break
+		}
+	}
+	if len(upstreams) == 0 {
+		return taskIds
+	}
+
+	query := bson.M{
+		"workflow_run_id": run.Id,
+		"workflow_step":   bson.M{"$in": upstreams},
+		"status":          constants.StatusFinished,
+	}
+	tasks, err := model.GetTaskList(query, 0, constants.Infinite, "+create_ts")
+	if err != nil {
+		return taskIds
+	}
+	for _, task := range tasks {
+		taskIds = append(taskIds, task.Id)
+	}
+	return taskIds
+}
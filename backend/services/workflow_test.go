@@ -0,0 +1,81 @@
+package services
+
+import (
+	"crawlab/constants"
+	"crawlab/model"
+	"github.com/globalsign/mgo/bson"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestValidateWorkflow(t *testing.T) {
+	step := func(key string, upstreams ...string) model.WorkflowStep {
+		return model.WorkflowStep{
+			Key:       key,
+			SpiderId:  bson.NewObjectId(),
+			RunType:   constants.RunTypeRandom,
+			Upstreams: upstreams,
+		}
+	}
+
+	Convey("Test ValidateWorkflow", t, func() {
+		Convey("valid dag", func() {
+			w := model.Workflow{Steps: []model.WorkflowStep{step("a"), step("b", "a"), step("c", "a", "b")}}
+			So(ValidateWorkflow(w), ShouldBeNil)
+		})
+		Convey("duplicated key", func() {
+			w := model.Workflow{Steps: []model.WorkflowStep{step("a"), step("a")}}
+			So(ValidateWorkflow(w), ShouldNotBeNil)
+		})
+		Convey("upstream not found", func() {
+			w := model.Workflow{Steps: []model.WorkflowStep{step("a", "x")}}
+			So(ValidateWorkflow(w), ShouldNotBeNil)
+		})
+		Convey("cycle", func() {
+			w := model.Workflow{Steps: []model.WorkflowStep{step("a", "c"), step("b", "a"), step("c", "b")}}
+			So(ValidateWorkflow(w), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestGetWorkflowStepStatus(t *testing.T) {
+	Convey("Test GetWorkflowStepStatus", t, func() {
+		// 重试成功以最后一次执行为准
+		tasks := []model.Task{
+			{Id: "t1", Attempt: 1, Status: constants.StatusError},
+			{Id: "t2", ParentId: "t1", Attempt: 2, Status: constants.StatusFinished},
+		}
+		So(GetWorkflowStepStatus(tasks), ShouldEqual, constants.WorkflowStepStatusFinished)
+
+		// 重试中
+		tasks = append(tasks, model.Task{Id: "t3", Attempt: 1, Status: constants.StatusError})
+		tasks = append(tasks, model.Task{Id: "t4", ParentId: "t3", Attempt: 2, Status: constants.StatusPending})
+		So(GetWorkflowStepStatus(tasks), ShouldEqual, constants.WorkflowStepStatusRunning)
+
+		// 最终失败
+		tasks[3].Status = constants.StatusError
+		So(GetWorkflowStepStatus(tasks), ShouldEqual, constants.WorkflowStepStatusError)
+	})
+}
+
+func TestEvaluateWorkflowCondition(t *testing.T) {
+	Convey("Test EvaluateWorkflowCondition", t, func() {
+		ready, _ := EvaluateWorkflowCondition(constants.WorkflowConditionSuccess, []string{constants.WorkflowStepStatusRunning})
+		So(ready, ShouldBeFalse)
+
+		ready, shouldRun := EvaluateWorkflowCondition(constants.WorkflowConditionSuccess, []string{constants.WorkflowStepStatusFinished, constants.WorkflowStepStatusError})
+		So(ready, ShouldBeTrue)
+		So(shouldRun, ShouldBeFalse)
+
+		_, shouldRun = EvaluateWorkflowCondition(constants.WorkflowConditionFailure, []string{constants.WorkflowStepStatusFinished, constants.WorkflowStepStatusError})
+		So(shouldRun, ShouldBeTrue)
+
+		_, shouldRun = EvaluateWorkflowCondition(constants.WorkflowConditionAlways, []string{constants.WorkflowStepStatusSkipped})
+		So(shouldRun, ShouldBeTrue)
+
+		// 没有上游的步骤直接执行
+		ready, shouldRun = EvaluateWorkflowCondition("", nil)
+		So(ready, ShouldBeTrue)
+		So(shouldRun, ShouldBeTrue)
+	})
+}
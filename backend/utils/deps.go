@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"github.com/spf13/viper"
+	"path/filepath"
+)
+
+const (
+	// 未配置时使用的默认依赖源
+	defaultPythonIndexUrl = "https://pypi.tuna.tsinghua.edu.cn/simple"
+	defaultNodejsRegistry = "https://registry.npm.taobao.org"
+)
+
+// Python 依赖源（pip index-url）
+func GetPythonIndexUrl() string {
+	if url := viper.GetString("deps.python.indexUrl"); url != "" {
+		return url
+	}
+	return defaultPythonIndexUrl
+}
+
+// Node.js 依赖源（npm registry）
+func GetNodejsRegistry() string {
+	if url := viper.GetString("deps.nodejs.registry"); url != "" {
+		return url
+	}
+	return defaultNodejsRegistry
+}
+
+// 是否使用主节点的离线依赖缓存安装依赖
+func IsDepCacheEnabled() bool {
+	return viper.GetString("deps.cache.enabled") == "Y"
+}
+
+// 离线依赖缓存目录，Python 为 wheel/源码包目录，Node.js 为 npm 缓存目录
+func GetDepCachePath(lang string) string {
+	root := viper.GetString("deps.cache.path")
+	if root == "" {
+		root = filepath.Join(filepath.Dir(viper.GetString("spider.path")), "deps-cache")
+	}
+	return filepath.Join(root, lang)
+}
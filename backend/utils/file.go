@@ -3,6 +3,7 @@ package utils
 import (
 	"archive/zip"
 	"bufio"
+	"crypto/md5"
 	"fmt"
 	"github.com/apex/log"
 	"io"
@@ -43,6 +44,44 @@ func GetSpiderMd5Str(file string) string {
 	return md5Str
 }
 
+// 计算目录内容的MD5（文件相对路径及内容），excludes 为需要忽略的相对路径（文件或目录）
+func GetDirMd5(dirPath string, excludes []string) (string, error) {
+	h := md5.New()
+	err := filepath.Walk(dirPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dirPath, filePath)
+		if err != nil {
+			return err
+		}
+		if StringArrayContains(excludes, filepath.ToSlash(relPath)) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer Close(f)
+		fh := md5.New()
+		if _, err := io.Copy(fh, f); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(h, "%s %x\n", filepath.ToSlash(relPath), fh.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
 // 创建文件
 func OpenFile(fileName string) *os.File {
 	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, os.ModePerm)
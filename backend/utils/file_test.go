@@ -4,8 +4,10 @@ import (
 	"archive/zip"
 	. "github.com/smartystreets/goconvey/convey"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime/debug"
 	"testing"
 )
@@ -127,3 +129,29 @@ func TestDeCompress(t *testing.T) {
 	_ = os.Remove("demo.zip")
 
 }
+
+func TestGetDirMd5(t *testing.T) {
+	Convey("Test GetDirMd5", t, func() {
+		dir, err := ioutil.TempDir("", "dir_md5")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(filepath.Join(dir, "main.py"), []byte("print(1)"), os.ModePerm), ShouldBeNil)
+		md5Str, err := GetDirMd5(dir, []string{"md5.txt", ".git"})
+		So(err, ShouldBeNil)
+
+		// 忽略的文件和目录不影响结果
+		So(ioutil.WriteFile(filepath.Join(dir, "md5.txt"), []byte("abc"), os.ModePerm), ShouldBeNil)
+		So(os.MkdirAll(filepath.Join(dir, ".git"), os.ModePerm), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, ".git", "FETCH_HEAD"), []byte("abc"), os.ModePerm), ShouldBeNil)
+		md5Str2, err := GetDirMd5(dir, []string{"md5.txt", ".git"})
+		So(err, ShouldBeNil)
+		So(md5Str2, ShouldEqual, md5Str)
+
+		// 文件内容变化
+		So(ioutil.WriteFile(filepath.Join(dir, "main.py"), []byte("print(2)"), os.ModePerm), ShouldBeNil)
+		md5Str3, err := GetDirMd5(dir, []string{"md5.txt", ".git"})
+		So(err, ShouldBeNil)
+		So(md5Str3, ShouldNotEqual, md5Str)
+	})
+}
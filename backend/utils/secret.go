@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/spf13/viper"
+	"io"
+	"sort"
+	"strings"
+)
+
+// 脱敏后返回给前端的值
+const SecretMask = "******"
+
+// 加密值前缀，没有前缀的值视为明文（兼容旧数据）
+const secretPrefix = "enc:v1:"
+
+// 脱敏时忽略过短的值，避免误替换日志内容
+const secretMaskMinLength = 4
+
+// 加密密钥，未配置 secret.masterKey 时使用 server.secret
+func getSecretKey() []byte {
+	key := viper.GetString("secret.masterKey")
+	if key == "" {
+		key = viper.GetString("server.secret")
+	}
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+func IsEncryptedSecret(str string) bool {
+	return strings.HasPrefix(str, secretPrefix)
+}
+
+// 使用 AES-GCM 加密，已加密（可以解密）或为空的值原样返回
+func EncryptSecret(str string) (string, error) {
+	if str == "" {
+		return str, nil
+	}
+	if IsEncryptedSecret(str) {
+		// 带有前缀但无法解密的值视为明文
+		if _, err := DecryptSecret(str); err == nil {
+			return str, nil
+		}
+	}
+
+	block, err := aes.NewCipher(getSecretKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	data := gcm.Seal(nonce, nonce, []byte(str), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// 解密，未加密的值原样返回
+func DecryptSecret(str string) (string, error) {
+	if !IsEncryptedSecret(str) {
+		return str, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(str, secretPrefix))
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(getSecretKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("invalid secret")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// 将字符串中出现的敏感值替换为脱敏值
+type SecretMasker struct {
+	values []string
+}
+
+func NewSecretMasker(values []string) *SecretMasker {
+	var list []string
+	for _, v := range values {
+		if len(v) >= secretMaskMinLength {
+			list = append(list, v)
+		}
+	}
+	// 先替换较长的值，避免部分替换
+	sort.Slice(list, func(i, j int) bool {
+		return len(list[i]) > len(list[j])
+	})
+	return &SecretMasker{values: list}
+}
+
+func (m *SecretMasker) Mask(str string) string {
+	for _, v := range m.values {
+		str = strings.Replace(str, v, SecretMask, -1)
+	}
+	return str
+}
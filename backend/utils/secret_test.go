@@ -0,0 +1,50 @@
+package utils
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestEncryptSecret(t *testing.T) {
+	Convey("Test EncryptSecret", t, func() {
+		encrypted, err := EncryptSecret("my-password")
+		So(err, ShouldBeNil)
+		So(IsEncryptedSecret(encrypted), ShouldBeTrue)
+		So(encrypted, ShouldNotContainSubstring, "my-password")
+
+		Convey("should decrypt to the original value", func() {
+			value, err := DecryptSecret(encrypted)
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "my-password")
+		})
+
+		Convey("should not encrypt twice", func() {
+			value, err := EncryptSecret(encrypted)
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, encrypted)
+		})
+
+		Convey("should encrypt plaintext with the encrypted prefix", func() {
+			value, err := EncryptSecret("enc:v1:my-password")
+			So(err, ShouldBeNil)
+			So(value, ShouldNotEqual, "enc:v1:my-password")
+			plain, err := DecryptSecret(value)
+			So(err, ShouldBeNil)
+			So(plain, ShouldEqual, "enc:v1:my-password")
+		})
+
+		Convey("should pass plaintext through", func() {
+			value, err := DecryptSecret("plain")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "plain")
+		})
+	})
+}
+
+func TestSecretMasker(t *testing.T) {
+	Convey("Test SecretMasker", t, func() {
+		masker := NewSecretMasker([]string{"abc", "token-1234", "token-1234-long"})
+		So(masker.Mask("auth token-1234-long and token-1234"), ShouldEqual, "auth ****** and ******")
+		So(masker.Mask("abc"), ShouldEqual, "abc")
+	})
+}
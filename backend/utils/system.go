@@ -17,7 +17,7 @@ func GetLangList() []entity.Lang {
 			DepExecutablePath: "/usr/local/bin/pip",
 			LockPath:          "/tmp/install-python.lock",
 			DepFileName:       "requirements.txt",
-			InstallDepArgs:    "install -i https://pypi.tuna.tsinghua.edu.cn/simple -r requirements.txt",
+			InstallDepArgs:    "install -r requirements.txt",
 		},
 		{
 			Name:              "Node.js",
@@ -27,7 +27,7 @@ func GetLangList() []entity.Lang {
 			LockPath:          "/tmp/install-nodejs.lock",
 			InstallScript:     "install-nodejs.sh",
 			DepFileName:       "package.json",
-			InstallDepArgs:    "install -g --registry=https://registry.npm.taobao.org",
+			InstallDepArgs:    "install -g",
 		},
 		{
 			Name:            "Java",
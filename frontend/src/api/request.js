@@ -14,18 +14,37 @@ if (!CRAWLAB_API_ADDRESS.match('CRAWLAB_API_ADDRESS')) {
   baseUrl = CRAWLAB_API_ADDRESS
 }
 
+const refreshToken = () => {
+  const refreshTokenStr = window.localStorage.getItem('refresh_token')
+  if (!refreshTokenStr) {
+    return Promise.resolve(false)
+  }
+  return axios.post(baseUrl + '/login/refresh', { refresh_token: refreshTokenStr })
+    .then((response) => {
+      window.localStorage.setItem('token', response.data.data)
+      window.localStorage.setItem('refresh_token', response.data.refresh_token)
+      return true
+    })
+    .catch(() => {
+      window.localStorage.removeItem('refresh_token')
+      return false
+    })
+}
+
 const request = (method, path, params, data, others = {}) => {
   const url = baseUrl + path
   const headers = {
     'Authorization': window.localStorage.getItem('token')
   }
+  const config = { ...others }
+  delete config.isRetry
   return axios({
     method,
     url,
     params,
     data,
     headers,
-    ...others
+    ...config
   }).then((response) => {
     if (response.status === 200) {
       return Promise.resolve(response)
@@ -39,6 +58,18 @@ const request = (method, path, params, data, others = {}) => {
     if (response.status === 400) {
       Message.error(response.data.error)
     }
+    if (response.status === 401 && path !== '/login/refresh' && !others.isRetry) {
+      // 登录 token 过期时尝试使用刷新 token 换取新的 token，并重试请求
+      return refreshToken().then((ok) => {
+        if (ok) {
+          return request(method, path, params, data, { ...others, isRetry: true })
+        }
+        if (router.currentRoute.path !== '/login') {
+          router.push('/login')
+        }
+        return e
+      })
+    }
     if (response.status === 401 && router.currentRoute.path !== '/login') {
       router.push('/login')
     }
@@ -241,6 +241,7 @@ export default {
   'No command line': '没有执行命令',
   'Last Status': '上次运行状态',
   'Remark': '备注',
+  'Secret': '加密',
 
   // 任务
   'Task Info': '任务信息',
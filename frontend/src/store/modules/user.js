@@ -79,6 +79,7 @@ const user = {
         const token = res.data.data
         commit('SET_TOKEN', token)
         window.localStorage.setItem('token', token)
+        window.localStorage.setItem('refresh_token', res.data.refresh_token)
       }
       return res
     },
@@ -116,8 +117,14 @@ const user = {
 
     // 登出
     logout ({ commit, state }) {
+      // 使刷新 token 失效
+      const refreshToken = window.localStorage.getItem('refresh_token')
+      if (refreshToken) {
+        request.post('/logout', { refresh_token: refreshToken }).catch(() => {})
+      }
       return new Promise((resolve, reject) => {
         window.localStorage.removeItem('token')
+        window.localStorage.removeItem('refresh_token')
         window.localStorage.removeItem('user_info')
         commit('SET_USER_INFO', undefined)
         commit('SET_TOKEN', '')